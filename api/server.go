@@ -0,0 +1,470 @@
+// Package api serves a REST interface for starting scans, following their
+// progress and fetching their results.
+//
+//	POST   /api/scans              start a scan, returns its status
+//	GET    /api/scans              list scans
+//	GET    /api/scans/{id}         status and progress
+//	GET    /api/scans/{id}/events  progress and results as Server-Sent Events
+//	GET    /api/scans/{id}/result  the finished report
+//	DELETE /api/scans/{id}         cancel a scan
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"network-scanner/history"
+	"network-scanner/scan"
+)
+
+// Request is the body of POST /api/scans.
+type Request struct {
+	scan.Spec
+	Timing   string  `json:"timing,omitempty"` // profile name, normal if empty
+	Services bool    `json:"services,omitempty"`
+	MaxRate  float64 `json:"max_rate,omitempty"`
+}
+
+// State is where a scan is in its life.
+type State string
+
+const (
+	Queued    State = "queued"
+	Running   State = "running"
+	Done      State = "done"
+	Cancelled State = "cancelled"
+	Failed    State = "failed"
+)
+
+// Status is what GET /api/scans/{id} returns.
+type Status struct {
+	ID        string     `json:"id"`
+	Request   Request    `json:"request"`
+	State     State      `json:"state"`
+	Done      int        `json:"done"`
+	Total     int        `json:"total"`
+	Hosts     int        `json:"hosts"`      // hosts that answered so far
+	OpenPorts int        `json:"open_ports"` // open ports found so far
+	Submitted time.Time  `json:"submitted"`
+	Started   *time.Time `json:"started,omitempty"`
+	Finished  *time.Time `json:"finished,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	HistoryID uint64     `json:"history_id,omitempty"` // ID in the history database once saved
+}
+
+// RunFunc runs one scan. The server uses an engine built from the request;
+// tests can substitute their own.
+type RunFunc func(ctx context.Context, req Request, fn func(scan.Event)) (*scan.Report, error)
+
+// Server is an http.Handler for the scan API.
+type Server struct {
+	// DBPath, if set, is the history database finished scans are saved to.
+	DBPath string
+	// Token, if set, must be sent as "Authorization: Bearer <token>".
+	Token string
+	// MaxRunning caps the scans that run at once; the rest wait in turn.
+	MaxRunning int
+	// KeepFinished is how many finished scans stay queryable.
+	KeepFinished int
+	// Run performs a scan; RunEngine if nil.
+	Run RunFunc
+	// OnResult, if set, is called with the report of every scan that ran.
+	OnResult func(report *scan.Report)
+
+	once   sync.Once
+	slots  chan struct{}
+	mu     sync.Mutex
+	nextID int
+	jobs   map[string]*job
+	order  []string // job IDs, oldest first
+}
+
+// RunEngine runs req with a new engine using the requested profile.
+func RunEngine(ctx context.Context, req Request, fn func(scan.Event)) (*scan.Report, error) {
+	engine, err := req.engine()
+	if err != nil {
+		return nil, err
+	}
+	return engine.Run(ctx, req.Spec, fn)
+}
+
+func (r Request) engine() (*scan.Engine, error) {
+	timing := scan.DefaultTiming
+	if r.Timing != "" {
+		var err error
+		if timing, err = scan.ProfileByName(r.Timing); err != nil {
+			return nil, err
+		}
+	}
+	if r.MaxRate < 0 {
+		return nil, fmt.Errorf("max_rate must not be negative")
+	}
+	timing.MaxRate = r.MaxRate
+	engine := scan.NewEngine(timing)
+	engine.Services = r.Services
+	return engine, nil
+}
+
+func (r *Request) validate() error {
+	if r.Command == "" {
+		// A network is swept, a single host port-scanned.
+		r.Command = "portscan"
+		if strings.Contains(r.Target, "/") {
+			r.Command = "netscan"
+		}
+	}
+	if err := r.Spec.Validate(); err != nil {
+		return err
+	}
+	_, err := r.engine()
+	return err
+}
+
+// job is one submitted scan.
+type job struct {
+	mu      sync.Mutex
+	status  Status
+	found   []scan.Event // results so far, replayed to new event streams
+	report  *scan.Report
+	cancel  context.CancelFunc
+	changed chan struct{} // closed and replaced on every update
+}
+
+// update changes the job under its lock and wakes the event streams.
+func (j *job) update(fn func()) {
+	j.mu.Lock()
+	fn()
+	close(j.changed)
+	j.changed = make(chan struct{})
+	j.mu.Unlock()
+}
+
+func (j *job) finished() bool {
+	switch j.status.State {
+	case Done, Cancelled, Failed:
+		return true
+	}
+	return false
+}
+
+func (s *Server) init() {
+	s.once.Do(func() {
+		if s.MaxRunning < 1 {
+			s.MaxRunning = 4
+		}
+		if s.KeepFinished < 1 {
+			s.KeepFinished = 100
+		}
+		if s.Run == nil {
+			s.Run = RunEngine
+		}
+		s.slots = make(chan struct{}, s.MaxRunning)
+		s.jobs = map[string]*job{}
+	})
+}
+
+// ServeHTTP routes API requests.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.init()
+	if s.Token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+s.Token)) != 1 {
+		writeError(w, http.StatusUnauthorized, "missing or wrong bearer token")
+		return
+	}
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/scans"), "/")
+	if !strings.HasPrefix(r.URL.Path, "/api/scans") {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if path == "" {
+		switch r.Method {
+		case http.MethodGet:
+			s.list(w)
+		case http.MethodPost:
+			s.submit(w, r)
+		default:
+			methodNotAllowed(w, "GET, POST")
+		}
+		return
+	}
+
+	id, action, _ := strings.Cut(path, "/")
+	j := s.job(id)
+	if j == nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("no scan %q", id))
+		return
+	}
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		j.mu.Lock()
+		status := j.status
+		j.mu.Unlock()
+		writeJSON(w, http.StatusOK, status)
+	case action == "" && r.Method == http.MethodDelete:
+		s.cancel(w, j)
+	case action == "":
+		methodNotAllowed(w, "GET, DELETE")
+	case action == "events" && r.Method == http.MethodGet:
+		s.events(w, r, j)
+	case action == "result" && r.Method == http.MethodGet:
+		s.result(w, j)
+	case action == "events" || action == "result":
+		methodNotAllowed(w, "GET")
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// CancelAll cancels every scan that has not finished, for shutdown.
+func (s *Server) CancelAll() {
+	s.init()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, j := range s.jobs {
+		j.cancel()
+	}
+}
+
+func (s *Server) job(id string) *job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.jobs[id]
+}
+
+func (s *Server) submit(w http.ResponseWriter, r *http.Request) {
+	var req Request
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request: "+err.Error())
+		return
+	}
+	if err := req.validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &job{cancel: cancel, changed: make(chan struct{})}
+
+	s.mu.Lock()
+	s.nextID++
+	j.status = Status{ID: strconv.Itoa(s.nextID), Request: req, State: Queued, Submitted: time.Now()}
+	s.jobs[j.status.ID] = j
+	s.order = append(s.order, j.status.ID)
+	s.prune()
+	status := j.status
+	s.mu.Unlock()
+
+	go s.run(ctx, j)
+
+	w.Header().Set("Location", "/api/scans/"+status.ID)
+	writeJSON(w, http.StatusAccepted, status)
+}
+
+// prune forgets the oldest finished scans beyond KeepFinished. s.mu must be
+// held.
+func (s *Server) prune() {
+	finished := 0
+	for i := len(s.order) - 1; i >= 0; i-- {
+		j := s.jobs[s.order[i]]
+		j.mu.Lock()
+		done := j.finished()
+		j.mu.Unlock()
+		if !done {
+			continue
+		}
+		if finished++; finished > s.KeepFinished {
+			delete(s.jobs, s.order[i])
+			s.order = append(s.order[:i], s.order[i+1:]...)
+		}
+	}
+}
+
+// run waits for a free slot and runs the job.
+func (s *Server) run(ctx context.Context, j *job) {
+	defer j.cancel()
+	select {
+	case s.slots <- struct{}{}:
+		defer func() { <-s.slots }()
+	case <-ctx.Done():
+		j.update(func() { j.status.State = Cancelled; j.status.Finished = now() })
+		return
+	}
+
+	j.update(func() { j.status.State = Running; j.status.Started = now() })
+	report, err := s.Run(ctx, j.status.Request, func(ev scan.Event) {
+		j.update(func() {
+			j.status.Done, j.status.Total = ev.Done, ev.Total
+			if !ev.Found {
+				return
+			}
+			j.found = append(j.found, ev)
+			if ev.Port != nil {
+				j.status.OpenPorts++
+			} else {
+				j.status.Hosts++
+			}
+		})
+	})
+
+	if report != nil && s.OnResult != nil {
+		s.OnResult(report)
+	}
+	var historyID uint64
+	if report != nil && s.DBPath != "" {
+		var saveErr error
+		if historyID, saveErr = history.Record(s.DBPath, report); saveErr != nil && err == nil {
+			err = fmt.Errorf("saving to history: %w", saveErr)
+		}
+	}
+
+	j.update(func() {
+		j.report = report
+		j.status.HistoryID = historyID
+		j.status.Finished = now()
+		switch {
+		case errors.Is(err, context.Canceled):
+			j.status.State = Cancelled
+		case err != nil:
+			j.status.State = Failed
+			j.status.Error = err.Error()
+		default:
+			j.status.State = Done
+		}
+		if report != nil {
+			j.status.Hosts = len(report.Hosts)
+			j.status.OpenPorts = report.OpenPorts()
+		}
+	})
+}
+
+func now() *time.Time {
+	t := time.Now()
+	return &t
+}
+
+func (s *Server) list(w http.ResponseWriter) {
+	s.mu.Lock()
+	statuses := make([]Status, 0, len(s.order))
+	for _, id := range s.order {
+		j := s.jobs[id]
+		j.mu.Lock()
+		statuses = append(statuses, j.status)
+		j.mu.Unlock()
+	}
+	s.mu.Unlock()
+	sort.SliceStable(statuses, func(i, k int) bool { return statuses[i].Submitted.After(statuses[k].Submitted) })
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+func (s *Server) cancel(w http.ResponseWriter, j *job) {
+	j.mu.Lock()
+	done := j.finished()
+	status := j.status
+	j.mu.Unlock()
+	if done {
+		writeJSON(w, http.StatusConflict, status)
+		return
+	}
+	j.cancel()
+	writeJSON(w, http.StatusAccepted, status)
+}
+
+func (s *Server) result(w http.ResponseWriter, j *job) {
+	j.mu.Lock()
+	report, status := j.report, j.status
+	done := j.finished()
+	j.mu.Unlock()
+	switch {
+	case !done:
+		writeError(w, http.StatusConflict, fmt.Sprintf("scan %s is still %s", status.ID, status.State))
+	case report == nil:
+		writeError(w, http.StatusNotFound, fmt.Sprintf("scan %s has no result: %s", status.ID, status.Error))
+	default:
+		writeJSON(w, http.StatusOK, report)
+	}
+}
+
+// events streams a scan as Server-Sent Events: every result found so far as
+// a "result" event, then new results as they come, "progress" events at
+// most a few times a second, and a final "status" event when it ends.
+func (s *Server) events(w http.ResponseWriter, r *http.Request, j *job) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	sent := 0
+	var lastProgress time.Time
+	for {
+		j.mu.Lock()
+		found := j.found[sent:]
+		status := j.status
+		done := j.finished()
+		changed := j.changed
+		j.mu.Unlock()
+
+		for _, ev := range found {
+			writeEvent(w, "result", ev)
+		}
+		sent += len(found)
+		if done {
+			writeEvent(w, "status", status)
+			flusher.Flush()
+			return
+		}
+		if time.Since(lastProgress) >= 250*time.Millisecond {
+			writeEvent(w, "progress", progress{Done: status.Done, Total: status.Total})
+			lastProgress = time.Now()
+		}
+		flusher.Flush()
+
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// progress is the data of a "progress" event.
+type progress struct {
+	Done  int `json:"done"`
+	Total int `json:"total"`
+}
+
+func writeEvent(w http.ResponseWriter, name string, v any) {
+	data, _ := json.Marshal(v)
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}
+
+func methodNotAllowed(w http.ResponseWriter, allow string) {
+	w.Header().Set("Allow", allow)
+	writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+}
@@ -0,0 +1,241 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"network-scanner/scan"
+)
+
+const token = "s3cret"
+
+// fakeRun reports host 10.0.0.1 with port 22 open, then waits for release
+// or cancellation before finishing.
+func fakeRun(release <-chan struct{}) RunFunc {
+	return func(ctx context.Context, req Request, fn func(scan.Event)) (*scan.Report, error) {
+		report := scan.NewReport(req.Command, req.Target)
+		port := scan.Port{Number: 22, Protocol: "tcp", State: "open"}
+		report.AddHost("10.0.0.1")
+		fn(scan.Event{Host: "10.0.0.1", Found: true, Done: 1, Total: 2})
+		report.AddPort("10.0.0.1", port)
+		fn(scan.Event{Host: "10.0.0.1", Port: &port, Found: true, Done: 2, Total: 2})
+
+		select {
+		case <-release:
+			report.Finish(2, false)
+			return report, nil
+		case <-ctx.Done():
+			report.Finish(2, true)
+			return report, ctx.Err()
+		}
+	}
+}
+
+func newTestServer(t *testing.T, run RunFunc) *httptest.Server {
+	t.Helper()
+	api := &Server{Token: token, Run: run}
+	srv := httptest.NewServer(api)
+	t.Cleanup(func() {
+		api.CancelAll()
+		srv.Close()
+	})
+	return srv
+}
+
+func do(t *testing.T, srv *httptest.Server, method, path, body string) (int, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, data
+}
+
+func submit(t *testing.T, srv *httptest.Server) Status {
+	t.Helper()
+	code, body := do(t, srv, http.MethodPost, "/api/scans", `{"target": "10.0.0.0/30", "ports": "22"}`)
+	if code != http.StatusAccepted {
+		t.Fatalf("POST /api/scans = %d %s, want 202", code, body)
+	}
+	var status Status
+	if err := json.Unmarshal(body, &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.ID == "" || status.Request.Command != "netscan" {
+		t.Fatalf("submitted %+v, want an ID and the netscan command", status)
+	}
+	return status
+}
+
+// waitState polls the scan until it reaches want.
+func waitState(t *testing.T, srv *httptest.Server, id string, want State) Status {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		code, body := do(t, srv, http.MethodGet, "/api/scans/"+id, "")
+		if code != http.StatusOK {
+			t.Fatalf("GET /api/scans/%s = %d %s", id, code, body)
+		}
+		var status Status
+		if err := json.Unmarshal(body, &status); err != nil {
+			t.Fatal(err)
+		}
+		if status.State == want {
+			return status
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("scan %s is %s, want %s", id, status.State, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	srv := newTestServer(t, fakeRun(nil))
+	for _, auth := range []string{"", "Bearer wrong", token, "Basic " + token} {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/api/scans", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		resp, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Authorization %q: got %d, want 401", auth, resp.StatusCode)
+		}
+	}
+	if code, body := do(t, srv, http.MethodGet, "/api/scans", ""); code != http.StatusOK {
+		t.Errorf("with the token: got %d %s, want 200", code, body)
+	}
+}
+
+func TestScanResult(t *testing.T) {
+	release := make(chan struct{})
+	srv := newTestServer(t, fakeRun(release))
+	id := submit(t, srv).ID
+
+	waitState(t, srv, id, Running)
+	if code, _ := do(t, srv, http.MethodGet, "/api/scans/"+id+"/result", ""); code != http.StatusConflict {
+		t.Errorf("result of a running scan: got %d, want 409", code)
+	}
+	close(release)
+	status := waitState(t, srv, id, Done)
+	if status.Hosts != 1 || status.OpenPorts != 1 || status.Done != 2 || status.Total != 2 {
+		t.Errorf("finished status %+v, want 1 host, 1 open port and 2/2 done", status)
+	}
+
+	code, body := do(t, srv, http.MethodGet, "/api/scans/"+id+"/result", "")
+	if code != http.StatusOK {
+		t.Fatalf("GET result = %d %s, want 200", code, body)
+	}
+	var report scan.Report
+	if err := json.Unmarshal(body, &report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Hosts) != 1 || report.Hosts[0].Address != "10.0.0.1" || len(report.Hosts[0].Ports) != 1 {
+		t.Errorf("result %s, want host 10.0.0.1 with one port", body)
+	}
+
+	code, body = do(t, srv, http.MethodGet, "/api/scans", "")
+	var list []Status
+	if err := json.Unmarshal(body, &list); code != http.StatusOK || err != nil || len(list) != 1 || list[0].ID != id {
+		t.Errorf("GET /api/scans = %d %s, want the one scan", code, body)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	srv := newTestServer(t, fakeRun(nil))
+	id := submit(t, srv).ID
+	waitState(t, srv, id, Running)
+
+	if code, body := do(t, srv, http.MethodDelete, "/api/scans/"+id, ""); code != http.StatusAccepted {
+		t.Fatalf("DELETE = %d %s, want 202", code, body)
+	}
+	waitState(t, srv, id, Cancelled)
+	if code, _ := do(t, srv, http.MethodDelete, "/api/scans/"+id, ""); code != http.StatusConflict {
+		t.Errorf("cancelling twice: got %d, want 409", code)
+	}
+	// The partial report is kept.
+	if code, body := do(t, srv, http.MethodGet, "/api/scans/"+id+"/result", ""); code != http.StatusOK {
+		t.Errorf("result of a cancelled scan: got %d %s, want 200", code, body)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	release := make(chan struct{})
+	srv := newTestServer(t, fakeRun(release))
+	id := submit(t, srv).ID
+	waitState(t, srv, id, Running)
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/api/scans/"+id+"/events", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type %q, want text/event-stream", ct)
+	}
+
+	// Both results found so far are replayed before the scan is released.
+	var events []string
+	results := 0
+	lines := bufio.NewScanner(resp.Body)
+	for lines.Scan() {
+		name, ok := strings.CutPrefix(lines.Text(), "event: ")
+		if !ok {
+			continue
+		}
+		events = append(events, name)
+		if name == "result" {
+			if results++; results == 2 {
+				close(release)
+			}
+		}
+		if name == "status" {
+			break
+		}
+	}
+	if err := lines.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if results != 2 || events[len(events)-1] != "status" {
+		t.Errorf("events %v, want two results and a final status", events)
+	}
+}
+
+func TestBadRequests(t *testing.T) {
+	srv := newTestServer(t, fakeRun(nil))
+	for _, body := range []string{`{`, `{"target": "10.0.0.1", "bogus": 1}`, `{"command": "ping", "target": "10.0.0.1"}`, `{"target": "10.0.0.1", "timing": "warp"}`,
+		`{"command": "netscan", "target": "0.0.0.0/0"}`, `{"command": "netscan", "target": "2001:db8::/64"}`} {
+		if code, resp := do(t, srv, http.MethodPost, "/api/scans", body); code != http.StatusBadRequest {
+			t.Errorf("POST %s: got %d %s, want 400", body, code, resp)
+		}
+	}
+	if code, _ := do(t, srv, http.MethodGet, "/api/scans/99", ""); code != http.StatusNotFound {
+		t.Errorf("unknown scan: got %d, want 404", code)
+	}
+	if code, _ := do(t, srv, http.MethodPut, "/api/scans", ""); code != http.StatusMethodNotAllowed {
+		t.Errorf("PUT /api/scans: got %d, want 405", code)
+	}
+}
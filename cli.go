@@ -1,14 +1,28 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"log"
 	"net"
+	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
-	"sync"
+	"strings"
+	"syscall"
 	"time"
 
-	"github.com/go-ping/ping"
+	"network-scanner/api"
+	"network-scanner/dnsrecon"
+	"network-scanner/history"
+	"network-scanner/metrics"
+	"network-scanner/notify"
+	"network-scanner/scan"
+	"network-scanner/schedule"
 )
 
 func main() {
@@ -17,158 +31,1544 @@ func main() {
 		return
 	}
 
-	command := os.Args[1]
+	// Ctrl-C cancels the scan; the commands still print what they found.
+	// SIGTERM does the same, so serve stops cleanly under a service manager.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	command, args := os.Args[1], os.Args[2:]
 
 	switch command {
 	case "ping":
-		if len(os.Args) < 3 {
-			fmt.Println("Usage: network-scanner-cli ping <host>")
+		runPing(ctx, args)
+
+	case "traceroute":
+		runTraceroute(ctx, args)
+
+	case "mtu":
+		runMTU(ctx, args)
+
+	case "portscan":
+		runPortscan(ctx, args)
+
+	case "netscan":
+		runNetscan(ctx, args)
+
+	case "dns":
+		runDNS(ctx, args)
+
+	case "history":
+		runHistory(args)
+
+	case "diff":
+		runDiff(args)
+
+	case "serve":
+		runServe(ctx, args)
+
+	case "notify-test":
+		runNotifyTest(ctx, args)
+
+	default:
+		printUsage()
+	}
+
+	if ctx.Err() != nil {
+		os.Exit(130)
+	}
+}
+
+func runPing(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("ping", flag.ExitOnError)
+	newEngine := addEngineFlags(fs)
+	count := fs.Int("c", 1, "echoes to send; when given, prints each reply and latency statistics, 0 pings until interrupted")
+	interval := fs.Duration("i", time.Second, "wait between echoes")
+	args = parseArgs(fs, args)
+
+	if len(args) < 1 || *count < 0 {
+		fmt.Println("Usage: network-scanner-cli ping <host> [-c <count>] [-i <interval>]")
+		return
+	}
+	engine := mustEngine(newEngine)
+	mustICMP(engine)
+
+	host := args[0]
+	series := false
+	fs.Visit(func(f *flag.Flag) { series = series || f.Name == "c" })
+	if series {
+		pingMonitor(ctx, engine, host, *count, *interval)
+		return
+	}
+	r := engine.PingHost(ctx, host)
+	switch {
+	case r.Alive():
+		fmt.Printf("Host %s: ALIVE\n", host)
+	case ctx.Err() != nil:
+		fmt.Printf("Host %s: INTERRUPTED\n", host)
+	case r.Status == scan.PingTimeout, r.Status == scan.PingUnreachable:
+		fmt.Printf("Host %s: NOT REACHABLE (%s)\n", host, r)
+	case r.Status == scan.PingResolve:
+		fmt.Printf("Host %s: UNKNOWN HOST (%s)\n", host, r)
+	case r.Status == scan.PingDenied:
+		fmt.Printf("Host %s: PING NOT PERMITTED (%s)\n", host, r)
+	default:
+		fmt.Printf("Host %s: PING FAILED (%s)\n", host, r)
+	}
+	printRetrySummary(engine)
+	if ctx.Err() == nil && !r.Alive() {
+		os.Exit(pingExit[r.Status])
+	}
+}
+
+// pingExit is the exit status of ping, mtu and netscan for each way a ping
+// can fail. 2 is left for usage errors, as in the other commands.
+var pingExit = map[scan.PingStatus]int{
+	scan.PingTimeout:     1,
+	scan.PingUnreachable: 3,
+	scan.PingResolve:     4,
+	scan.PingDenied:      5,
+	scan.PingFailed:      6,
+}
+
+// pingMonitor prints every echo to host as it is answered or lost and,
+// at the end, the latency statistics, like ping(8).
+func pingMonitor(ctx context.Context, engine *scan.Engine, host string, count int, interval time.Duration) {
+	fmt.Printf("PING %s\n", host)
+	stats, err := engine.PingSeries(ctx, host, count, interval, func(e scan.Echo) {
+		if e.Unreachable != "" {
+			from := e.From
+			if from == "" {
+				from = "local stack"
+			}
+			fmt.Printf("From %s: seq=%d %s\n", from, e.Seq, e.Unreachable)
 			return
 		}
-		host := os.Args[2]
-		if pingHost(host) {
-			fmt.Printf("Host %s: ALIVE\n", host)
-		} else {
-			fmt.Printf("Host %s: NOT REACHABLE\n", host)
+		if e.Lost {
+			fmt.Printf("Request timeout for seq=%d\n", e.Seq)
+			return
 		}
+		fmt.Printf("Reply from %s: seq=%d ttl=%d time=%s ms\n", e.Addr, e.Seq, e.TTL, millis(e.RTT))
+	})
+	if err != nil && ctx.Err() == nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(pingExit[scan.PingErrorStatus(err)])
+	}
 
-	case "portscan":
-		if len(os.Args) < 5 {
-			fmt.Println("Usage: network-scanner-cli portscan <host> <start_port> <end_port>")
-			return
+	fmt.Printf("\n--- %s ping statistics ---\n", host)
+	fmt.Printf("%d sent, %d received, %.1f%% loss\n", stats.Sent, stats.Received, stats.Loss*100)
+	if stats.Up() {
+		fmt.Printf("rtt min/avg/max/stddev = %s/%s/%s/%s ms, jitter %s ms\n",
+			millis(stats.Min), millis(stats.Avg), millis(stats.Max), millis(stats.StdDev), millis(stats.Jitter))
+	}
+	if !stats.Up() && ctx.Err() == nil {
+		os.Exit(pingExit[stats.Status()])
+	}
+}
+
+// millis formats d as milliseconds with three decimals.
+func millis(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
+}
+
+// runTraceroute prints the path to a host hop by hop, like traceroute(8).
+func runTraceroute(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("traceroute", flag.ExitOnError)
+	newEngine := addEngineFlags(fs)
+	var opts scan.TraceOptions
+	fs.StringVar(&opts.Method, "method", scan.TraceUDP, "probe with udp, icmp or tcp (tcp needs root or CAP_NET_RAW)")
+	fs.IntVar(&opts.Port, "port", 0, "first UDP port (default 33434) or the TCP port (default 80)")
+	fs.IntVar(&opts.MaxHops, "max-hops", 30, "give up after this many hops")
+	fs.IntVar(&opts.Probes, "probes", 3, "probes per hop")
+	args = parseArgs(fs, args)
+
+	if len(args) < 1 {
+		fmt.Println("Usage: network-scanner-cli traceroute <host> [--method udp|icmp|tcp] [--port <n>] [--max-hops <n>] [--probes <n>]")
+		return
+	}
+	engine := mustEngine(newEngine)
+
+	host := args[0]
+	fmt.Printf("traceroute to %s, %d hops max, %s probes\n", host, opts.MaxHops, opts.Method)
+	route, err := engine.Traceroute(ctx, host, opts, func(h scan.Hop) {
+		fmt.Printf("%2d  %s\n", h.TTL, h)
+	})
+	if err != nil && ctx.Err() == nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if route != nil && !route.Reached && ctx.Err() == nil {
+		fmt.Printf("%s (%s) did not answer\n", host, route.Addr)
+		os.Exit(1)
+	}
+}
+
+// runMTU finds the path MTU to a host.
+func runMTU(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("mtu", flag.ExitOnError)
+	newEngine := addEngineFlags(fs)
+	args = parseArgs(fs, args)
+
+	if len(args) < 1 {
+		fmt.Println("Usage: network-scanner-cli mtu <host>")
+		return
+	}
+	engine := mustEngine(newEngine)
+	mustICMP(engine)
+
+	host := args[0]
+	fmt.Printf("Probing the path MTU to %s with don't-fragment echoes\n", host)
+	result, err := engine.PathMTU(ctx, host, func(size int, fits bool) {
+		outcome := "too big"
+		if fits {
+			outcome = "ok"
+		}
+		fmt.Printf("  %5d bytes: %s\n", size, outcome)
+	})
+	if err != nil {
+		if ctx.Err() == nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	fmt.Printf("Path MTU to %s (%s): %d bytes (%d-byte ICMP payload), link MTU %d, %d probes\n",
+		host, result.Addr, result.MTU, result.MTU-28, result.LinkMTU, result.Probes)
+}
+
+// runDNS prints the records of a domain, tries zone transfers from its name
+// servers and, with a wordlist, looks for subdomains.
+func runDNS(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("dns", flag.ExitOnError)
+	resolver := fs.String("resolver", "", "resolver to query, host[:port] (default the first nameserver in /etc/resolv.conf)")
+	typeList := fs.String("types", strings.Join(dnsrecon.Types, ","), "record types to look up")
+	noAXFR := fs.Bool("no-axfr", false, "do not try zone transfers from the name servers")
+	wordlist := fs.String("wordlist", "", "file of subdomain labels to try, one per line")
+	concurrency := fs.Int("concurrency", 20, "subdomain lookups at a time")
+	timeout := fs.Duration("timeout", 3*time.Second, "wait for each answer")
+	format := fs.String("format", "text", "output format: text or json")
+	output := fs.String("o", "", "write the addresses found to this file, one per line, for netscan @<file>")
+	args = parseArgs(fs, args)
+
+	if len(args) < 1 {
+		fmt.Println("Usage: network-scanner-cli dns <domain> [--resolver <addr>] [--wordlist <file>] [-o <targets_file>]")
+		return
+	}
+	domain := strings.TrimSuffix(args[0], ".")
+	types, err := dnsrecon.ParseTypes(*typeList)
+	if err == nil && *format != "text" && *format != "json" {
+		err = fmt.Errorf("unknown format %q (want text or json)", *format)
+	}
+	var words []string
+	if err == nil && *wordlist != "" {
+		words, err = dnsrecon.ReadWordlist(*wordlist)
+	}
+	var client *dnsrecon.Client
+	if err == nil {
+		client, err = dnsrecon.NewClient(*resolver, *timeout)
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(2)
+	}
+	text := *format == "text"
+
+	result := &dnsrecon.Result{Domain: domain, Server: client.Server}
+	if text {
+		fmt.Printf("DNS records for %s (resolver %s):\n", domain, client.Server)
+	}
+	result.Records, result.Failures, err = client.Records(ctx, domain, types)
+	if err != nil && ctx.Err() == nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if text {
+		for _, r := range result.Records {
+			fmt.Printf("  %s\n", r)
+		}
+		if len(result.Records) == 0 {
+			fmt.Println("  none")
 		}
-		host := os.Args[2]
-		startPort, err1 := strconv.Atoi(os.Args[3])
-		endPort, err2 := strconv.Atoi(os.Args[4])
+		for _, f := range result.Failures {
+			fmt.Printf("  %s %s: no answer (%s)\n", f.Name, f.Type, f.Error)
+		}
+	}
+
+	if !*noAXFR && ctx.Err() == nil {
+		for _, ns := range result.Records {
+			if ns.Type != "NS" || ns.Name != domain {
+				continue
+			}
+			t := dnsrecon.Transfer{Server: ns.Value}
+			t.Records, err = client.Transfer(ctx, domain, ns.Value)
+			if err != nil {
+				t.Error = err.Error()
+			}
+			result.Transfers = append(result.Transfers, t)
+			if !text {
+				continue
+			}
+			if err != nil {
+				fmt.Printf("Zone transfer from %s: failed (%v)\n", ns.Value, err)
+				continue
+			}
+			fmt.Printf("Zone transfer from %s: %d records\n", ns.Value, len(t.Records))
+			for _, r := range t.Records {
+				fmt.Printf("  %s\n", r)
+			}
+		}
+	}
+
+	if len(words) > 0 && ctx.Err() == nil {
+		if text {
+			fmt.Printf("Trying %d subdomains of %s...\n", len(words), domain)
+		}
+		result.Subdomains, result.Wildcard, err = client.Brute(ctx, domain, words, *concurrency, func(r dnsrecon.Record) {
+			if text {
+				fmt.Printf("  %s  %s  %s\n", r.Name, r.Type, r.Value)
+			}
+		})
+		if err != nil && ctx.Err() == nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if text && len(result.Wildcard) > 0 {
+			fmt.Printf("Wildcard: any name under %s resolves to %s; those answers were left out\n", domain, strings.Join(result.Wildcard, ", "))
+		}
+	}
+
+	addrs := result.Addresses()
+	if text {
+		fmt.Printf("\n%d addresses found\n", len(addrs))
+	} else {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(result)
+	}
+	if *output != "" {
+		data := strings.Join(addrs, "\n")
+		if len(addrs) > 0 {
+			data += "\n"
+		}
+		if err := os.WriteFile(*output, []byte(data), 0o644); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if text {
+			fmt.Printf("Wrote them to %s; scan them with: network-scanner-cli netscan @%s\n", *output, *output)
+		}
+	}
+}
+
+func runPortscan(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("portscan", flag.ExitOnError)
+	newEngine := addEngineFlags(fs)
+	ck := addCheckpointFlags(fs)
+	hist := addHistoryFlags(fs)
+	pol := addPolicyFlags(fs)
+	osopt := addOSFlags(fs)
+	services := fs.Bool("services", false, "identify the service, banner and TLS certificate on each open port")
+	args = parseArgs(fs, args)
+
+	args = ck.load("portscan", args)
+	if len(args) < 3 {
+		fmt.Println("Usage: network-scanner-cli portscan <host> <start_port> <end_port>")
+		return
+	}
+	host := args[0]
+	if strings.HasPrefix(host, "@") {
+		fmt.Printf("Error: portscan takes one host; scan the hosts in %s with: network-scanner-cli netscan %s --ports <list>\n", host[1:], host)
+		os.Exit(2)
+	}
+	startPort, err1 := strconv.Atoi(args[1])
+	endPort, err2 := strconv.Atoi(args[2])
+
+	if err1 != nil || err2 != nil {
+		fmt.Println("Error: Invalid port numbers")
+		return
+	}
+	if err := scan.CheckPortRange(startPort, endPort); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	engine := mustEngine(newEngine)
+	// Banners are one of the signals OS guesses go by.
+	engine.Services = *services || *osopt.on
+	pol.load()
+	osopt.load()
+	scanPorts(ctx, engine, host, startPort, endPort, ck, hist, pol, osopt)
+}
+
+func runHistory(args []string) {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	db := fs.String("db", history.DefaultPath(), "history database file")
+	limit := fs.Int("limit", 20, "number of scans to list, 0 for all")
+	format := fs.String("format", "text", "output format for show: "+strings.Join(scan.Formats, ", "))
+	output := fs.String("o", "", "write show output to this file instead of stdout")
+	args = parseArgs(fs, args)
+
+	if len(args) < 1 {
+		fmt.Println("Usage: network-scanner-cli history list|show <id>|delete <id>")
+		return
+	}
+
+	store, err := history.Open(*db)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer store.Close()
 
-		if err1 != nil || err2 != nil {
-			fmt.Println("Error: Invalid port numbers")
+	switch args[0] {
+	case "list":
+		reports, err := store.List(*limit)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if len(reports) == 0 {
+			fmt.Printf("No scans in %s\n", *db)
 			return
 		}
+		fmt.Printf("%-6s %-19s %-9s %-24s %s\n", "ID", "STARTED", "COMMAND", "TARGET", "RESULT")
+		for _, r := range reports {
+			fmt.Printf("%-6d %-19s %-9s %-24s %s\n", r.ID, r.Started.Format("2006-01-02 15:04:05"), r.Command, r.Target, reportSummary(r))
+		}
 
-		scanPorts(host, startPort, endPort)
+	case "show", "delete":
+		if len(args) < 2 {
+			fmt.Printf("Usage: network-scanner-cli history %s <id>\n", args[0])
+			return
+		}
+		id, err := strconv.ParseUint(args[1], 10, 64)
+		if err != nil {
+			fmt.Printf("Error: invalid scan ID %q\n", args[1])
+			os.Exit(2)
+		}
 
-	case "netscan":
-		if len(os.Args) < 3 {
-			fmt.Println("Usage: network-scanner-cli netscan <network_cidr>")
+		if args[0] == "delete" {
+			if err := store.Delete(id); err != nil {
+				fmt.Printf("Error: scan %d: %v\n", id, err)
+				os.Exit(1)
+			}
+			fmt.Printf("Deleted scan %d\n", id)
 			return
 		}
-		network := os.Args[2]
-		scanNetwork(network)
+
+		r, err := store.Get(id)
+		if err != nil {
+			fmt.Printf("Error: scan %d: %v\n", id, err)
+			os.Exit(1)
+		}
+		if err := writeReport(r, *format, *output); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
 
 	default:
-		printUsage()
+		fmt.Println("Usage: network-scanner-cli history list|show <id>|delete <id>")
+	}
+}
+
+// runDiff compares two scans, each given as a history ID or a JSON/XML
+// file. With a single ID it compares that scan with the previous run
+// against the same target. It exits 1 when something changed, like diff(1).
+func runDiff(args []string) {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	db := fs.String("db", history.DefaultPath(), "history database file")
+	format := fs.String("format", "text", "output format: "+strings.Join(scan.DiffFormats, ", "))
+	output := fs.String("o", "", "write the change report to this file instead of stdout")
+	args = parseArgs(fs, args)
+
+	if len(args) < 1 || len(args) > 2 {
+		fmt.Println("Usage: network-scanner-cli diff <old> <new>   (history IDs or JSON/XML files)")
+		fmt.Println("       network-scanner-cli diff <id>          (against the previous run of the same target)")
+		os.Exit(2)
+	}
+
+	var store *history.Store
+	openStore := func() *history.Store {
+		if store == nil {
+			var err error
+			if store, err = history.Open(*db); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(2)
+			}
+		}
+		return store
+	}
+	defer func() {
+		if store != nil {
+			store.Close()
+		}
+	}()
+
+	load := func(arg string) *scan.Report {
+		if _, err := os.Stat(arg); err == nil {
+			r, err := scan.ReadReportFile(arg)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(2)
+			}
+			return r
+		}
+		id, err := strconv.ParseUint(arg, 10, 64)
+		if err != nil {
+			fmt.Printf("Error: %q is neither a file nor a scan ID\n", arg)
+			os.Exit(2)
+		}
+		r, err := openStore().Get(id)
+		if err != nil {
+			fmt.Printf("Error: scan %d: %v\n", id, err)
+			os.Exit(2)
+		}
+		return r
+	}
+
+	var old, new *scan.Report
+	if len(args) == 2 {
+		old, new = load(args[0]), load(args[1])
+	} else {
+		new = load(args[0])
+		var err error
+		if old, err = openStore().Previous(new); err != nil {
+			fmt.Printf("Error: no earlier %s of %s to compare with: %v\n", new.Command, new.Target, err)
+			os.Exit(2)
+		}
+	}
+
+	d := scan.Compare(old, new)
+	w := os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(2)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := scan.WriteDiff(w, d, *format); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(2)
+	}
+	if !d.Empty() {
+		os.Exit(1)
+	}
+}
+
+func reportSummary(r *scan.Report) string {
+	summary := fmt.Sprintf("%d hosts up", len(r.Hosts))
+	if r.Command == "portscan" {
+		summary = fmt.Sprintf("%d open ports", r.OpenPorts())
+	}
+	if r.Interrupted {
+		summary += " (interrupted)"
+	}
+	return summary
+}
+
+// writeReport writes r in format to the file at path, or to stdout when
+// path is empty.
+func writeReport(r *scan.Report, format, path string) error {
+	if path == "" {
+		return scan.WriteReport(os.Stdout, r, format)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := scan.WriteReport(f, r, format); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func runNetscan(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("netscan", flag.ExitOnError)
+	newEngine := addEngineFlags(fs)
+	ck := addCheckpointFlags(fs)
+	hist := addHistoryFlags(fs)
+	pol := addPolicyFlags(fs)
+	disc := addDiscoveryFlags(fs)
+	osopt := addOSFlags(fs)
+	portSpec := fs.String("ports", "", "ports to probe on each live host (with --policy, default the policy's ports and well-known ports)")
+	args = parseArgs(fs, args)
+
+	args = ck.load("netscan", args)
+	if len(args) < 1 {
+		fmt.Println("Usage: network-scanner-cli netscan <network_cidr>|@<targets_file>")
+		return
+	}
+	network := args[0]
+	engine := mustEngine(newEngine)
+	mustICMP(engine)
+	pol.load()
+	disc.check()
+	osopt.load()
+
+	var ports []int
+	if *portSpec != "" {
+		var err error
+		if ports, err = scan.ParsePorts(*portSpec); err != nil {
+			fmt.Printf("Error: --ports: %v\n", err)
+			os.Exit(2)
+		}
+	} else if pol.policy != nil {
+		ports = scan.UniquePorts(append(pol.policy.Ports(), scan.WellKnownPorts()...))
+	}
+	if osopt.rules != nil {
+		// Which of the ports the rules know are open, and the banners
+		// behind them, are part of the guess.
+		ports = scan.UniquePorts(append(ports, osopt.rules.Ports()...))
+		engine.Services = true
+	}
+	scanNetwork(ctx, engine, network, ports, ck, hist, pol, disc, osopt)
+}
+
+// loopback reports whether the listen address addr only accepts
+// connections from this host.
+func loopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// runServe runs the scheduled jobs in the jobs file until interrupted and,
+// with --listen, serves the HTTP API alongside them.
+func runServe(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	jobs := fs.String("jobs", schedule.DefaultPath(), "jobs file with the scans to run and their schedules")
+	db := fs.String("db", history.DefaultPath(), "history database to store results in")
+	listen := fs.String("listen", "", "serve the HTTP API on this address, e.g. :8080")
+	token := fs.String("token", os.Getenv("NETSCAN_API_TOKEN"), "bearer token API clients must send (default $NETSCAN_API_TOKEN)")
+	maxRunning := fs.Int("max-running", 4, "API scans that may run at once")
+	monitorTargets := fs.String("monitor", "", "comma-separated hosts or networks to ping for /metrics")
+	monitorPorts := fs.String("monitor-ports", "", "TCP ports to check on every monitored host, e.g. 22,80,443")
+	monitorInterval := fs.Duration("monitor-interval", time.Minute, "time between monitoring rounds")
+	monitorCount := fs.Int("monitor-count", 3, "ICMP echoes per host per monitoring round")
+	notifyPath := fs.String("notify", notify.DefaultPath(), "notifications file; alerts are off if it does not exist")
+	newEngine := addEngineFlags(fs)
+	parseArgs(fs, args)
+
+	if *listen != "" && *token == "" && !loopback(*listen) {
+		// Anyone who can reach the port could start scans from this host.
+		fmt.Printf("Error: --listen %s accepts connections from other hosts; set --token (or NETSCAN_API_TOKEN),\n", *listen)
+		fmt.Println("or listen on a loopback address such as 127.0.0.1:8080")
+		os.Exit(2)
+	}
+
+	logger := log.New(os.Stdout, "", log.LstdFlags)
+	monitor := &metrics.Monitor{Interval: *monitorInterval, Count: *monitorCount, Log: logger}
+	if *monitorTargets != "" {
+		if *listen == "" {
+			fmt.Println("Error: --monitor needs --listen to serve /metrics")
+			os.Exit(2)
+		}
+		for _, t := range strings.Split(*monitorTargets, ",") {
+			if t = strings.TrimSpace(t); t == "" {
+				continue
+			}
+			if err := monitor.AddTarget(t); err != nil {
+				fmt.Printf("Error: --monitor: %v\n", err)
+				os.Exit(2)
+			}
+		}
+		ports, err := scan.ParsePorts(*monitorPorts)
+		if err != nil {
+			fmt.Printf("Error: --monitor-ports: %v\n", err)
+			os.Exit(2)
+		}
+		monitor.Ports = ports
+		monitor.Timing = mustEngine(newEngine).Timing
+	}
+
+	var alerts *notify.Config
+	if _, err := os.Stat(*notifyPath); err == nil {
+		if alerts, err = notify.Load(*notifyPath); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(2)
+		}
+		logger.Printf("sending alerts as set up in %s", *notifyPath)
+	}
+
+	d := &schedule.Daemon{
+		JobsPath: *jobs,
+		DBPath:   *db,
+		Log:      logger,
+		OnResult: func(job schedule.Job, report, prev *scan.Report) {
+			monitor.RecordScan(job.Name, report)
+			if alerts != nil {
+				if err := alerts.Notify(ctx, prev, report); err != nil {
+					logger.Printf("%s: sending alerts: %v", job.Name, err)
+				}
+			}
+		},
+	}
+
+	if *listen != "" {
+		apiServer := &api.Server{
+			DBPath:     *db,
+			Token:      *token,
+			MaxRunning: *maxRunning,
+			OnResult:   func(report *scan.Report) { monitor.RecordScan("", report) },
+		}
+		mux := http.NewServeMux()
+		mux.Handle("/api/", apiServer)
+		mux.Handle("/metrics", monitor)
+		if len(monitor.Targets) > 0 {
+			go monitor.Run(ctx)
+		}
+		srv := &http.Server{Addr: *listen, Handler: mux}
+
+		ln, err := net.Listen("tcp", *listen)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(2)
+		}
+		logger.Printf("API listening on %s", ln.Addr())
+		go func() {
+			if err := srv.Serve(ln); err != http.ErrServerClosed {
+				logger.Printf("API server: %v", err)
+			}
+		}()
+		defer func() {
+			apiServer.CancelAll()
+			shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			srv.Shutdown(shutdown)
+		}()
+	}
+
+	if err := d.Run(ctx); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(2)
+	}
+}
+
+// runNotifyTest sends a sample alert through every channel in the
+// notifications file.
+func runNotifyTest(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("notify-test", flag.ExitOnError)
+	path := fs.String("notify", notify.DefaultPath(), "notifications file")
+	parseArgs(fs, args)
+
+	cfg, err := notify.Load(*path)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(2)
+	}
+	if err := cfg.Test(ctx); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
 	}
+	fmt.Printf("Sent a test alert through %d channels\n", len(cfg.Channels))
 }
 
 func printUsage() {
 	fmt.Println("Network Scanner CLI")
 	fmt.Println("Usage:")
-	fmt.Println("  network-scanner-cli ping <host>")
+	fmt.Println("  network-scanner-cli ping <host> [-c <count>] [-i <interval>]")
+	fmt.Println("  network-scanner-cli traceroute <host> [--method udp|icmp|tcp] [--max-hops <n>] [--probes <n>]")
+	fmt.Println("  network-scanner-cli mtu <host>")
 	fmt.Println("  network-scanner-cli portscan <host> <start_port> <end_port>")
-	fmt.Println("  network-scanner-cli netscan <network_cidr>")
+	fmt.Println("  network-scanner-cli netscan <network_cidr>|@<targets_file>")
+	fmt.Println("  network-scanner-cli dns <domain> [--resolver <addr>] [--wordlist <file>] [-o <targets_file>]")
+	fmt.Println("  network-scanner-cli history list|show <id>|delete <id>")
+	fmt.Println("  network-scanner-cli diff <old> <new>|<id>")
+	fmt.Println("  network-scanner-cli serve [--jobs <file>] [--db <file>] [--listen <addr>]")
+	fmt.Println("  network-scanner-cli notify-test [--notify <file>]")
+	fmt.Println("")
+	fmt.Println("Options:")
+	fmt.Println("  -T, --timing <profile>  paranoid, polite, normal, aggressive or insane (default normal)")
+	fmt.Println("  --adaptive              tune timeouts to the measured round-trip time of each host")
+	fmt.Println("  --retries <n>           retries for unanswered probes (default from the timing profile)")
+	fmt.Println("  --icmp-retries <n>      override --retries for ICMP echoes")
+	fmt.Println("  --tcp-retries <n>       override --retries for TCP connects")
+	fmt.Println("  --udp-retries <n>       override --retries for UDP probes")
+	fmt.Println("  --backoff <duration>    wait before the first retry, doubled for each one after (default 100ms)")
+	fmt.Println("  --max-rate <pps>        never send more than this many probes per second")
+	fmt.Println("  --min-rate <pps>        try to send at least this many probes per second")
+	fmt.Println("  --scan-mode syn|connect probe TCP ports half-open with raw SYNs (Linux, root or CAP_NET_RAW) or")
+	fmt.Println("                          with full connections; by default SYN when allowed, connect otherwise")
+	fmt.Println("  --privileged            send ICMP echoes from a raw socket (root or CAP_NET_RAW); by default")
+	fmt.Println("                          unprivileged ping sockets are used where the system allows them")
+	fmt.Println("")
+	fmt.Println("ping -c <n> sends n echoes -i apart, printing each reply, then min/avg/max/stddev RTT, jitter")
+	fmt.Println("and loss; -c 0 keeps going until Ctrl-C. Without -c it reports ALIVE, or why the host did not")
+	fmt.Println("answer. ping exits 1 when no reply came, 3 when the host was reported unreachable, 4 when its")
+	fmt.Println("name does not resolve and 6 on other failures. ping, mtu and netscan exit 5 when the system")
+	fmt.Println("allows no ICMP socket: run them as root, with CAP_NET_RAW, or with your group in sysctl")
+	fmt.Println("net.ipv4.ping_group_range.")
+	fmt.Println("")
+	fmt.Println("traceroute shows each hop's address, name and round-trip times. UDP and ICMP work unprivileged")
+	fmt.Println("on Linux; --method tcp sends SYNs to --port and needs root or CAP_NET_RAW.")
+	fmt.Println("")
+	fmt.Println("mtu finds the largest packet that reaches the host unfragmented (Linux only).")
+	fmt.Println("")
+	fmt.Println("portscan and netscan also accept:")
+	fmt.Println("  --checkpoint <file>     where to save progress when interrupted (default scan-checkpoint.json)")
+	fmt.Println("  --resume <file>         continue an interrupted scan, skipping targets already done")
+	fmt.Println("  --db <file>             history database (default in the user config directory)")
+	fmt.Println("  --no-history            do not record the scan in the history database")
+	fmt.Println("  --notify <file>         send alerts for new hosts, new ports and expiring certificates")
+	fmt.Println("")
+	fmt.Println("  --policy <file>         check the results against a YAML policy; exit 1 on violations")
+	fmt.Println("  --os                    guess each live host's OS family, with a confidence, from the echo TTL,")
+	fmt.Println("                          the SYN-ACK's window and options (as root), open ports and banners")
+	fmt.Println("  --os-rules <file>       extra rules for --os (default osrules.yaml in the user config directory)")
+	fmt.Println("")
+	fmt.Println("portscan --services identifies the service, banner and TLS certificate on open ports.")
+	fmt.Println("netscan --ports <list> probes those ports on every live host (e.g. 22,80,8000-8100); with --policy")
+	fmt.Println("it defaults to the policy's ports and well-known ports. @<file> sweeps the addresses and networks")
+	fmt.Println("listed in the file instead of one network; only netscan reads such files, portscan takes one host.")
+	fmt.Println("After the sweep, netscan can ask devices on the local network to describe themselves; hosts")
+	fmt.Println("that do so from a target address count as live even when they ignore pings:")
+	fmt.Println("  --mdns active|passive   browse multicast DNS services for --mdns-wait (default 3s)")
+	fmt.Println("  --ssdp                  search for UPnP devices for --ssdp-wait (default 3s) and read their descriptions")
+	fmt.Println("  --netbios               ask every target for its NetBIOS names and every live host for its SMB dialects")
+	fmt.Println("  --snmp                  try --snmp-communities (default public,private; comma list or @file) on live")
+	fmt.Println("                          hosts and read the system group and interface table of agents that answer")
+	fmt.Println("")
+	fmt.Println("dns looks up A, AAAA, CNAME, MX, NS, SOA, TXT and SRV records (--types), tries a zone transfer")
+	fmt.Println("from each name server (--no-axfr to skip), and with --wordlist tries subdomains --concurrency at")
+	fmt.Println("a time, leaving out wildcard answers. -o writes the addresses found for netscan @<file>.")
+	fmt.Println("")
+	fmt.Println("history accepts --db, --limit <n> for list, and --format text|json|xml|csv and -o <file> for show.")
+	fmt.Println("diff compares history IDs or exported JSON/XML files; --format text|json|markdown, -o <file>.")
+	fmt.Println("It exits 1 when the scans differ.")
+	fmt.Println("serve runs the scans in the jobs file on their schedules until interrupted, storing each in")
+	fmt.Println("the history database and logging changes since the previous run; the file is reloaded on edit.")
+	fmt.Println("With --listen it also serves the REST API under /api/scans (--token, --max-running) and Prometheus")
+	fmt.Println("metrics on /metrics; --monitor <targets> pings hosts every --monitor-interval for up, RTT and loss,")
+	fmt.Println("and --monitor-ports counts open ports on them. Alerts are sent as set up in --notify, which")
+	fmt.Println("defaults to notify.yaml in the user config directory; notify-test sends a sample through each channel.")
+	fmt.Println("Without --token, serve refuses a --listen address other hosts can reach.")
 	fmt.Println("")
 	fmt.Println("Examples:")
 	fmt.Println("  network-scanner-cli ping google.com")
+	fmt.Println("  network-scanner-cli ping -c 0 -i 500ms 192.168.1.1")
+	fmt.Println("  network-scanner-cli traceroute --method tcp --port 443 example.com")
 	fmt.Println("  network-scanner-cli portscan 192.168.1.1 1 1000")
 	fmt.Println("  network-scanner-cli netscan 192.168.1.0/24")
+	fmt.Println("  network-scanner-cli portscan -T aggressive --adaptive 192.168.1.1 1 65535")
+	fmt.Println("  network-scanner-cli portscan --resume scan-checkpoint.json")
+	fmt.Println("  network-scanner-cli history show 12 --format json -o scan12.json")
+	fmt.Println("  network-scanner-cli diff 12 --format markdown")
+	fmt.Println("  network-scanner-cli netscan 10.1.2.0/24 --policy baseline.yaml")
+	fmt.Println("  network-scanner-cli dns example.com --wordlist subdomains.txt -o targets.txt")
+	fmt.Println("  network-scanner-cli netscan @targets.txt --ports 22,80,443")
+	fmt.Println("  network-scanner-cli netscan 192.168.1.0/24 --mdns active --ssdp")
+	fmt.Println("  network-scanner-cli netscan 10.1.2.0/24 --netbios")
+	fmt.Println("  network-scanner-cli netscan 10.1.2.0/24 --snmp --snmp-communities @communities.txt")
+	fmt.Println("  sudo network-scanner-cli netscan 192.168.1.0/24 --os --ports 22,80,443")
 }
 
-func pingHost(host string) bool {
-	pinger, err := ping.NewPinger(host)
+// addEngineFlags registers the timing and retry options on fs. The
+// returned function builds an engine from them once fs has been parsed.
+func addEngineFlags(fs *flag.FlagSet) func() (*scan.Engine, error) {
+	timingName := fs.String("timing", "normal", "timing profile: paranoid, polite, normal, aggressive, insane (or 0-4)")
+	fs.StringVar(timingName, "T", "normal", "shorthand for --timing")
+	adaptive := fs.Bool("adaptive", false, "tune probe timeouts from measured round-trip times")
+	retries := fs.Int("retries", -1, "retries for unanswered probes (default from the timing profile)")
+	perProbe := map[scan.ProbeKind]*int{
+		scan.ProbeICMP: fs.Int("icmp-retries", -1, "override --retries for ICMP echoes"),
+		scan.ProbeTCP:  fs.Int("tcp-retries", -1, "override --retries for TCP connects"),
+		scan.ProbeUDP:  fs.Int("udp-retries", -1, "override --retries for UDP probes"),
+	}
+	backoff := fs.Duration("backoff", scan.DefaultRetryPolicy.Backoff, "wait before the first retry, doubled for each one after")
+	maxRate := fs.Float64("max-rate", 0, "never send more than this many probes per second")
+	minRate := fs.Float64("min-rate", 0, "try to send at least this many probes per second")
+	scanMode := fs.String("scan-mode", "", "how to probe TCP ports: syn (half-open, needs root or CAP_NET_RAW on Linux) or connect (default syn when allowed)")
+	privileged := fs.Bool("privileged", false, "send ICMP echoes from a raw socket (root or CAP_NET_RAW) even where unprivileged ping sockets are allowed")
+
+	return func() (*scan.Engine, error) {
+		timing, err := scan.ProfileByName(*timingName)
+		if err != nil {
+			return nil, err
+		}
+		timing.Adaptive = *adaptive
+		if *retries >= 0 {
+			timing.Retries = *retries
+		}
+		timing.MaxRate = *maxRate
+		timing.MinRate = *minRate
+
+		engine := scan.NewEngine(timing)
+		engine.ScanMode = *scanMode
+		if err := engine.CheckScanMode(); err != nil {
+			return nil, err
+		}
+		engine.Privileged = *privileged
+		engine.Retry.Backoff = *backoff
+		engine.Retry.Retries = map[scan.ProbeKind]int{}
+		for kind, n := range perProbe {
+			if *n >= 0 {
+				engine.Retry.Retries[kind] = *n
+			}
+		}
+		return engine, nil
+	}
+}
+
+func mustEngine(newEngine func() (*scan.Engine, error)) *scan.Engine {
+	engine, err := newEngine()
 	if err != nil {
-		return false
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(2)
 	}
+	return engine
+}
 
-	pinger.SetPrivileged(false)
-	pinger.Count = 1
-	pinger.Timeout = 1 * time.Second
+// mustICMP exits when engine cannot send ICMP echoes at all, rather than
+// reporting every host as not reachable.
+func mustICMP(engine *scan.Engine) {
+	if _, err := engine.ICMPMode(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(pingExit[scan.PingDenied])
+	}
+}
+
+// checkpointing carries the --checkpoint and --resume options of a scan.
+type checkpointing struct {
+	path       *string
+	resumePath *string
+	resume     *scan.Checkpoint // loaded from resumePath, nil for a fresh scan
+}
 
-	err = pinger.Run()
+func addCheckpointFlags(fs *flag.FlagSet) *checkpointing {
+	return &checkpointing{
+		path:       fs.String("checkpoint", "scan-checkpoint.json", "where to save progress when the scan is interrupted"),
+		resumePath: fs.String("resume", "", "continue the scan saved in this checkpoint file"),
+	}
+}
+
+// load reads the --resume checkpoint, if any, and returns the positional
+// arguments to scan with: the checkpoint's when args is empty, otherwise
+// args, which must then match the checkpoint.
+func (ck *checkpointing) load(command string, args []string) []string {
+	if *ck.resumePath == "" {
+		return args
+	}
+	cp, err := scan.LoadCheckpoint(*ck.resumePath)
 	if err != nil {
-		return false
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(2)
+	}
+	if cp.Command != command {
+		fmt.Printf("Error: %s is a %s checkpoint, not %s\n", *ck.resumePath, cp.Command, command)
+		os.Exit(2)
+	}
+	if len(args) > 0 && strings.Join(args, " ") != strings.Join(cp.Args, " ") {
+		fmt.Printf("Error: %s was saved for \"%s %s\"\n", *ck.resumePath, command, strings.Join(cp.Args, " "))
+		os.Exit(2)
+	}
+	ck.resume = cp
+	return cp.Args
+}
+
+// remaining drops the targets the resumed checkpoint has already done.
+func (ck *checkpointing) remaining(targets []string) []string {
+	if ck.resume == nil {
+		return targets
+	}
+	return ck.resume.Remaining(targets)
+}
+
+// finish saves a checkpoint when the scan was interrupted, or removes the
+// resumed checkpoint once the scan has completed.
+func (ck *checkpointing) finish(interrupted bool, cp *scan.Checkpoint) {
+	if !interrupted {
+		if ck.resume != nil {
+			os.Remove(*ck.resumePath)
+		}
+		return
+	}
+	if ck.resume != nil {
+		cp.Done = append(ck.resume.Done, cp.Done...)
+	}
+	if err := cp.Save(*ck.path); err != nil {
+		fmt.Printf("Error saving checkpoint: %v\n", err)
+		return
+	}
+	fmt.Printf("Progress saved to %s. Continue with: network-scanner-cli %s --resume %s\n", *ck.path, cp.Command, *ck.path)
+}
+
+// historyOptions carries the --db, --no-history and --notify options of a
+// scan.
+type historyOptions struct {
+	db     *string
+	off    *bool
+	notify *string
+}
+
+func addHistoryFlags(fs *flag.FlagSet) *historyOptions {
+	return &historyOptions{
+		db:     fs.String("db", history.DefaultPath(), "history database file"),
+		off:    fs.Bool("no-history", false, "do not record the scan in the history database"),
+		notify: fs.String("notify", "", "send alerts about new hosts, ports and expiring certificates as set up in this file"),
+	}
+}
+
+// save records r in the history database and sends the alerts for what is
+// new since the previous run.
+func (h *historyOptions) save(ctx context.Context, r *scan.Report) {
+	if !*h.off {
+		id, err := history.Record(*h.db, r)
+		if err != nil {
+			fmt.Printf("Error saving scan to history: %v\n", err)
+		} else {
+			fmt.Printf("Saved as scan #%d in %s\n", id, *h.db)
+		}
+	}
+	if *h.notify == "" || r.Interrupted {
+		return
+	}
+
+	cfg, err := notify.Load(*h.notify)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	var prev *scan.Report
+	if store, err := history.Open(*h.db); err == nil {
+		prev, _ = store.Previous(r)
+		store.Close()
+	}
+	if prev != nil && prev.Interrupted {
+		prev = nil
+	}
+	if err := cfg.Notify(ctx, prev, r); err != nil {
+		fmt.Printf("Error sending alerts: %v\n", err)
+	}
+}
+
+// discoveryOptions carries the netscan options that ask devices on the
+// local network to describe themselves.
+type discoveryOptions struct {
+	mdns     *string
+	mdnsWait *time.Duration
+	ssdp     *bool
+	ssdpWait *time.Duration
+	netbios  *bool
+	snmp     *bool
+	snmpList *string
+	// communities is read from snmpList by check.
+	communities []string
+}
+
+func addDiscoveryFlags(fs *flag.FlagSet) *discoveryOptions {
+	return &discoveryOptions{
+		mdns:     fs.String("mdns", "", "browse multicast DNS services after the sweep: active (query) or passive (listen only)"),
+		mdnsWait: fs.Duration("mdns-wait", scan.MDNSDefaultWait, "how long to browse mDNS"),
+		ssdp:     fs.Bool("ssdp", false, "search for UPnP devices with SSDP after the sweep and fetch their descriptions"),
+		ssdpWait: fs.Duration("ssdp-wait", scan.SSDPDefaultWait, "how long to collect SSDP answers"),
+		netbios:  fs.Bool("netbios", false, "ask every target for its NetBIOS names (UDP 137) and live hosts for their SMB dialects (TCP 445)"),
+		snmp:     fs.Bool("snmp", false, "try the SNMP community strings on live hosts and read their system and interfaces"),
+		snmpList: fs.String("snmp-communities", strings.Join(scan.DefaultCommunities, ","), "community strings to try, comma-separated or @file"),
+	}
+}
+
+func (d *discoveryOptions) check() {
+	switch *d.mdns {
+	case "", "active", "passive":
+	default:
+		fmt.Printf("Error: --mdns: unknown mode %q (want active or passive)\n", *d.mdns)
+		os.Exit(2)
+	}
+	if *d.snmp {
+		communities, err := scan.ReadCommunities(*d.snmpList)
+		if err == nil && len(communities) == 0 {
+			err = errors.New("no community strings")
+		}
+		if err != nil {
+			fmt.Printf("Error: --snmp-communities: %v\n", err)
+			os.Exit(2)
+		}
+		d.communities = communities
+	}
+}
+
+// discover runs the discovery protocols asked for once the sweep is done.
+// Hosts that describe themselves from an address among targets join
+// alive, even when they ignored the pings.
+func (d *discoveryOptions) discover(ctx context.Context, engine *scan.Engine, r *scan.Report, targets, alive []string) ([]string, error) {
+	wanted := make(map[string]bool, len(targets))
+	for _, ip := range targets {
+		wanted[ip] = true
+	}
+	found := make(map[string]bool, len(alive))
+	for _, ip := range alive {
+		found[ip] = true
+	}
+	merge := func(addr, how string) bool {
+		if !wanted[addr] {
+			return false
+		}
+		if !found[addr] {
+			found[addr] = true
+			alive = append(alive, addr)
+			fmt.Printf("Host %s: FOUND via %s\n", addr, how)
+		}
+		return true
+	}
+
+	if *d.mdns != "" {
+		r.Params = append(r.Params, scan.Param{Name: "mdns", Value: *d.mdns})
+		fmt.Printf("Browsing mDNS services (%s, %s)...\n", *d.mdns, *d.mdnsWait)
+		services, err := scan.BrowseMDNS(ctx, *d.mdnsWait, *d.mdns == "passive", func(s scan.MDNSService) {
+			fmt.Printf("  mDNS: %s\n", s)
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return alive, err
+			}
+			fmt.Printf("Error browsing mDNS: %v\n", err)
+		}
+		outside := 0
+		for _, s := range services {
+			merged := false
+			for _, addr := range s.Addrs {
+				if merge(addr, "mDNS") {
+					r.AddMDNS(addr, s)
+					merged = true
+				}
+			}
+			if !merged {
+				outside++
+			}
+		}
+		fmt.Printf("mDNS: %d services", len(services))
+		if outside > 0 {
+			fmt.Printf(", %d without an address in %s", outside, r.Target)
+		}
+		fmt.Println()
+	}
+
+	if *d.ssdp {
+		r.Params = append(r.Params, scan.Param{Name: "ssdp", Value: "on"})
+		fmt.Printf("Searching for UPnP devices with SSDP (%s)...\n", *d.ssdpWait)
+		devices, err := scan.DiscoverSSDP(ctx, *d.ssdpWait, func(addr string, dev scan.UPnPDevice) {
+			fmt.Printf("  UPnP %s: %s\n", addr, dev)
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return alive, err
+			}
+			fmt.Printf("Error searching SSDP: %v\n", err)
+		}
+		outside, total := 0, 0
+		for addr, devs := range devices {
+			total += len(devs)
+			if !merge(addr, "SSDP") {
+				outside += len(devs)
+				continue
+			}
+			for _, dev := range devs {
+				r.AddUPnP(addr, dev)
+			}
+		}
+		fmt.Printf("SSDP: %d devices", total)
+		if outside > 0 {
+			fmt.Printf(", %d outside %s", outside, r.Target)
+		}
+		fmt.Println()
+	}
+
+	if *d.netbios {
+		r.Params = append(r.Params, scan.Param{Name: "netbios", Value: "on"})
+		fmt.Printf("Querying NetBIOS names on %d hosts...\n", len(targets))
+		named := 0
+		err := engine.NetBIOSSweep(ctx, targets, func(ip string, info scan.NetBIOSInfo) {
+			named++
+			fmt.Printf("  NetBIOS %s: %s\n", ip, info)
+			merge(ip, "NetBIOS")
+			r.SetNetBIOS(ip, info)
+		})
+		if err != nil {
+			return alive, err
+		}
+
+		fmt.Printf("Probing SMB on %d live hosts...\n", len(alive))
+		smb := 0
+		err = engine.SMBSweep(ctx, alive, func(ip string, info scan.SMBInfo) {
+			smb++
+			fmt.Printf("  SMB %s: %s\n", ip, info)
+			r.SetSMB(ip, info)
+		})
+		if err != nil {
+			return alive, err
+		}
+		fmt.Printf("NetBIOS: %d hosts answered; SMB: %d servers\n", named, smb)
+	}
+
+	if *d.snmp {
+		// The community strings themselves stay out of the report's
+		// parameters; a host's record names the one it accepted.
+		r.Params = append(r.Params, scan.Param{Name: "snmp", Value: strconv.Itoa(len(d.communities)) + " communities"})
+		fmt.Printf("Trying %d SNMP community strings on %d live hosts...\n", len(d.communities), len(alive))
+		agents := 0
+		err := engine.SNMPSweep(ctx, alive, d.communities, func(ip string, info scan.SNMPInfo) {
+			agents++
+			fmt.Printf("  SNMP %s: %s\n", ip, info)
+			for _, i := range info.Interfaces {
+				fmt.Printf("    if %s\n", i)
+			}
+			r.SetSNMP(ip, info)
+		})
+		if err != nil {
+			return alive, err
+		}
+		fmt.Printf("SNMP: %d agents answered\n", agents)
 	}
+	return alive, nil
+}
 
-	stats := pinger.Statistics()
-	return stats.PacketsRecv > 0
+// policyOptions carries the --policy option of a scan.
+type policyOptions struct {
+	path   *string
+	policy *scan.Policy // loaded from path, nil when no policy is checked
 }
 
-func scanPorts(host string, startPort, endPort int) {
-	fmt.Printf("Scanning ports %d-%d on %s...\n", startPort, endPort, host)
+func addPolicyFlags(fs *flag.FlagSet) *policyOptions {
+	return &policyOptions{
+		path: fs.String("policy", "", "check the results against this YAML policy and exit 1 on violations"),
+	}
+}
+
+func (p *policyOptions) load() {
+	if *p.path == "" {
+		return
+	}
+	policy, err := scan.LoadPolicy(*p.path)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(2)
+	}
+	p.policy = policy
+}
+
+// check prints the policy violations in a finished scan of targets, nil
+// for the report's own target, and exits 1 if there are any. An
+// interrupted scan is not checked.
+func (p *policyOptions) check(r *scan.Report, targets []string) {
+	if p.policy == nil {
+		return
+	}
+	if r.Interrupted {
+		fmt.Println("Policy not checked: the scan was interrupted.")
+		return
+	}
+	violations := p.policy.Check(r, targets)
+	if len(violations) == 0 {
+		fmt.Printf("Policy %s: no violations.\n", *p.path)
+		return
+	}
+	fmt.Printf("Policy %s: %d violations\n", *p.path, len(violations))
+	for _, v := range violations {
+		fmt.Printf("  %s\n", v)
+	}
+	os.Exit(1)
+}
+
+// osOptions carries the --os options of a scan.
+type osOptions struct {
+	on    *bool
+	path  *string
+	rules *scan.OSRules // loaded by load, nil when no guesses are made
+}
+
+func addOSFlags(fs *flag.FlagSet) *osOptions {
+	return &osOptions{
+		on:   fs.Bool("os", false, "guess the operating system of each live host from TTLs, SYN-ACKs, open ports and banners"),
+		path: fs.String("os-rules", "", "extra OS rules to add to the built-in ones (default "+scan.DefaultOSRulesPath()+" if it exists)"),
+	}
+}
+
+func (o *osOptions) load() {
+	if !*o.on {
+		return
+	}
+	path := *o.path
+	if path == "" {
+		if _, err := os.Stat(scan.DefaultOSRulesPath()); err == nil {
+			path = scan.DefaultOSRulesPath()
+		}
+	}
+	rules, err := scan.LoadOSRules(path)
+	if err != nil {
+		fmt.Printf("Error: --os-rules: %v\n", err)
+		os.Exit(2)
+	}
+	o.rules = rules
+}
+
+// guess prints and records a guess at the operating system of every host
+// in r.
+func (o *osOptions) guess(ctx context.Context, engine *scan.Engine, r *scan.Report) error {
+	if o.rules == nil || len(r.Hosts) == 0 {
+		return nil
+	}
+	r.Params = append(r.Params, scan.Param{Name: "os", Value: "on"})
+	fmt.Printf("Guessing the OS of %d hosts...\n", len(r.Hosts))
+	guessed := 0
+	err := engine.OSSweep(ctx, r.Hosts, o.rules, func(ip string, g scan.OSGuess) {
+		guessed++
+		fmt.Printf("  OS %s: %s\n", ip, g)
+		r.SetOS(ip, g)
+	})
+	fmt.Printf("OS: %d of %d hosts guessed\n", guessed, len(r.Hosts))
+	return err
+}
+
+func printRetrySummary(engine *scan.Engine) {
+	if summary := engine.RetrySummary(); summary != "" {
+		fmt.Printf("Retries: %s\n", summary)
+	}
+}
+
+func rateLimitNote(engine *scan.Engine) string {
+	if engine.Timing.MaxRate > 0 {
+		return fmt.Sprintf(", max %.0f probes/s", engine.Timing.MaxRate)
+	}
+	return ""
+}
+
+// parseArgs parses fs from args, allowing flags to appear before, between
+// or after the positional arguments, and returns the positional ones.
+func parseArgs(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		fs.Parse(args)
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func scanPorts(ctx context.Context, engine *scan.Engine, host string, startPort, endPort int, ck *checkpointing, hist *historyOptions, pol *policyOptions, osopt *osOptions) {
+	fmt.Printf("Scanning ports %d-%d on %s (%s timing%s)...\n", startPort, endPort, host, engine.Timing.Name, rateLimitNote(engine))
+
+	report := scan.NewReport("portscan", host, append(engine.Params(), scan.PortParams(fmt.Sprintf("%d-%d", startPort, endPort))...)...)
+	report.AddHost(host)
 
 	openPorts := []int{}
 	totalPorts := endPort - startPort + 1
 	scannedPorts := 0
 
+	var targets []string
 	for port := startPort; port <= endPort; port++ {
-		address := fmt.Sprintf("%s:%d", host, port)
-
-		conn, err := net.DialTimeout("tcp", address, 1*time.Second)
-		if err == nil {
-			conn.Close()
+		targets = append(targets, strconv.Itoa(port))
+	}
+	var ports []int
+	for _, t := range ck.remaining(targets) {
+		port, _ := strconv.Atoi(t)
+		ports = append(ports, port)
+	}
+	if ck.resume != nil {
+		for _, t := range ck.resume.Found {
+			port, _ := strconv.Atoi(t)
 			openPorts = append(openPorts, port)
-			fmt.Printf("Port %d: OPEN\n", port)
+			report.AddPort(host, scan.Port{Number: port, Protocol: "tcp", State: "open", Service: scan.ServiceName(port)})
 		}
+		scannedPorts = totalPorts - len(ports)
+		fmt.Printf("Resuming: %d/%d ports already scanned, %d open\n", scannedPorts, totalPorts, len(openPorts))
+	}
 
+	var done []string
+	mode, err := engine.ScanPortList(ctx, host, ports, func(p scan.Port, open bool) {
+		if open {
+			openPorts = append(openPorts, p.Number)
+			report.AddPort(host, p)
+			fmt.Printf("Port %d: OPEN%s\n", p.Number, serviceNote(p))
+		}
+
+		done = append(done, strconv.Itoa(p.Number))
 		scannedPorts++
 		if scannedPorts%100 == 0 {
-			fmt.Printf("Progress: %d/%d ports scanned\n", scannedPorts, totalPorts)
+			fmt.Printf("Progress: %d/%d ports scanned (%.0f probes/s)\n", scannedPorts, totalPorts, engine.Rate())
 		}
+	})
+
+	report.AddScanMode(mode)
+	warnScanMode(engine, host, mode)
+	if err != nil {
+		fmt.Printf("\nScan interrupted (%s scan). Found %d open ports out of %d scanned (%d requested).\n", mode, len(openPorts), scannedPorts, totalPorts)
+	} else {
+		fmt.Printf("\nScan complete (%s scan). Found %d open ports out of %d scanned.\n", mode, len(openPorts), totalPorts)
+		err = osopt.guess(ctx, engine, report)
+	}
+	printRetrySummary(engine)
+
+	report.Finish(scannedPorts, err != nil)
+	hist.save(ctx, report)
+
+	found := make([]string, len(openPorts))
+	for i, port := range openPorts {
+		found[i] = strconv.Itoa(port)
 	}
+	ck.finish(err != nil, &scan.Checkpoint{
+		Command: "portscan",
+		Args:    []string{host, strconv.Itoa(startPort), strconv.Itoa(endPort)},
+		Done:    done,
+		Found:   found,
+	})
+	pol.check(report, nil)
+}
+
+// warnScanMode warns when --scan-mode syn was asked for but host's ports
+// were probed with connect scans, which happens when it has no IPv4
+// address to send raw SYNs to.
+func warnScanMode(engine *scan.Engine, host, mode string) {
+	if engine.ScanMode == scan.ScanSYN && mode == scan.ScanConnect {
+		fmt.Printf("Warning: %s cannot be SYN scanned (it needs an IPv4 address); its ports were probed with connect scans.\n", host)
+	}
+}
 
-	fmt.Printf("\nScan complete. Found %d open ports out of %d scanned.\n", len(openPorts), totalPorts)
+func serviceNote(p scan.Port) string {
+	note := ""
+	if p.Service != "" {
+		note += "  " + p.Service
+	}
+	if p.Version != "" {
+		note += "  " + p.Version
+	}
+	if p.CertExpires != nil {
+		note += "  (cert expires " + p.CertExpires.Format("2006-01-02") + ")"
+	}
+	return note
 }
 
-func scanNetwork(network string) {
-	fmt.Printf("Scanning network %s...\n", network)
+// scanNetwork sweeps network for live hosts and, when ports is not empty,
+// then probes those ports on every host that answered.
+func scanNetwork(ctx context.Context, engine *scan.Engine, network string, ports []int, ck *checkpointing, hist *historyOptions, pol *policyOptions, disc *discoveryOptions, osopt *osOptions) {
+	fmt.Printf("Scanning network %s (%s timing%s)...\n", network, engine.Timing.Name, rateLimitNote(engine))
+
+	report := scan.NewReport("netscan", network, engine.Params()...)
 
-	_, ipNet, err := net.ParseCIDR(network)
+	ips, err := targetHosts(network)
 	if err != nil {
 		fmt.Printf("Error parsing network: %v\n", err)
 		return
 	}
 
-	var ips []string
-	for ip := ipNet.IP.Mask(ipNet.Mask); ipNet.Contains(ip); inc(ip) {
-		ips = append(ips, ip.String())
-	}
-
 	totalIPs := len(ips)
 	aliveHosts := []string{}
-	var mu sync.Mutex
-	var wg sync.WaitGroup
+	scannedIPs := 0
 
-	semaphore := make(chan struct{}, 50)
+	remaining := ck.remaining(ips)
+	if ck.resume != nil {
+		aliveHosts = append(aliveHosts, ck.resume.Found...)
+		for _, ip := range ck.resume.Found {
+			report.AddHost(ip)
+		}
+		scannedIPs = totalIPs - len(remaining)
+		fmt.Printf("Resuming: %d/%d hosts already scanned, %d alive\n", scannedIPs, totalIPs, len(aliveHosts))
+	}
 
-	for i, ip := range ips {
-		wg.Add(1)
-		go func(ip string, index int) {
-			defer wg.Done()
-			semaphore <- struct{}{}
-			defer func() { <-semaphore }()
+	var done []string
+	err = engine.PingSweep(ctx, remaining, func(r scan.PingResult) {
+		if r.Alive() {
+			aliveHosts = append(aliveHosts, r.Host)
+			report.AddPinged(r)
+			fmt.Printf("Host %s: ALIVE\n", r.Host)
+		}
 
-			if pingHost(ip) {
-				mu.Lock()
-				aliveHosts = append(aliveHosts, ip)
-				fmt.Printf("Host %s: ALIVE\n", ip)
-				mu.Unlock()
-			}
+		done = append(done, r.Host)
+		scannedIPs++
+		if scannedIPs%50 == 0 {
+			fmt.Printf("Progress: %d/%d hosts scanned (%.0f probes/s)\n", scannedIPs, totalIPs, engine.Rate())
+		}
+	})
 
-			if (index+1)%50 == 0 {
-				fmt.Printf("Progress: %d/%d hosts scanned\n", index+1, totalIPs)
+	if err != nil {
+		fmt.Printf("\nNetwork scan interrupted. Found %d alive hosts out of %d scanned (%d requested).\n", len(aliveHosts), scannedIPs, totalIPs)
+	} else {
+		fmt.Printf("\nNetwork scan complete. Found %d alive hosts out of %d scanned.\n", len(aliveHosts), totalIPs)
+	}
+	if err == nil {
+		aliveHosts, err = disc.discover(ctx, engine, report, ips, aliveHosts)
+	}
+
+	if err == nil && len(ports) > 0 && len(aliveHosts) > 0 {
+		report.Params = append(report.Params, scan.PortParams(scan.FormatPorts(ports))...)
+		fmt.Printf("Probing %d ports on %d live hosts...\n", len(ports), len(aliveHosts))
+		for _, ip := range aliveHosts {
+			var mode string
+			mode, err = engine.ScanPortList(ctx, ip, ports, func(p scan.Port, open bool) {
+				if open {
+					report.AddPort(ip, p)
+					fmt.Printf("Host %s port %d: OPEN%s\n", ip, p.Number, serviceNote(p))
+				}
+			})
+			report.AddScanMode(mode)
+			warnScanMode(engine, ip, mode)
+			if err != nil {
+				fmt.Println("\nPort probing interrupted.")
+				break
 			}
-		}(ip, i)
+		}
+		fmt.Printf("Ports probed with %s scan.\n", strings.ReplaceAll(report.Param("scan_mode"), ",", " and "))
+	}
+	if err == nil {
+		err = osopt.guess(ctx, engine, report)
 	}
+	printRetrySummary(engine)
 
-	wg.Wait()
-	fmt.Printf("\nNetwork scan complete. Found %d alive hosts out of %d scanned.\n", len(aliveHosts), totalIPs)
+	report.Finish(scannedIPs, err != nil)
+	hist.save(ctx, report)
+
+	ck.finish(err != nil, &scan.Checkpoint{
+		Command: "netscan",
+		Args:    []string{network},
+		Done:    done,
+		Found:   aliveHosts,
+	})
+	pol.check(report, ips)
 }
 
-func inc(ip net.IP) {
-	for j := len(ip) - 1; j >= 0; j-- {
-		ip[j]++
-		if ip[j] > 0 {
-			break
+// targetHosts lists the addresses netscan sweeps for target: every address
+// of a CIDR network, or the addresses and networks listed one per line in
+// the file after an @, such as the output of dns -o.
+func targetHosts(target string) ([]string, error) {
+	if !strings.HasPrefix(target, "@") {
+		return scan.CIDRHosts(target)
+	}
+	data, err := os.ReadFile(target[1:])
+	if err != nil {
+		return nil, err
+	}
+	var ips []string
+	seen := map[string]bool{}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		hosts := []string{line}
+		if strings.Contains(line, "/") {
+			if hosts, err = scan.CIDRHosts(line); err != nil {
+				return nil, fmt.Errorf("%s: %w", target[1:], err)
+			}
+		} else if net.ParseIP(line) == nil {
+			return nil, fmt.Errorf("%s: %q is not an address or network", target[1:], line)
+		}
+		for _, h := range hosts {
+			if !seen[h] {
+				seen[h] = true
+				ips = append(ips, h)
+			}
 		}
 	}
+	return ips, nil
 }
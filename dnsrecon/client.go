@@ -0,0 +1,324 @@
+// Package dnsrecon gathers what DNS gives away about a domain: its
+// records, zone transfers left open by its name servers and subdomains
+// found by trying names from a wordlist. The addresses it finds can be
+// scanned like any other targets.
+package dnsrecon
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Record is one resource record, with its data as text.
+type Record struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	TTL   uint32 `json:"ttl"`
+	Value string `json:"value"`
+}
+
+func (r Record) String() string {
+	return fmt.Sprintf("%s  %s  %s  (TTL %d)", r.Name, r.Type, r.Value, r.TTL)
+}
+
+// Client sends queries to one resolver.
+type Client struct {
+	Server  string        // host:port
+	Timeout time.Duration // per query
+}
+
+// NewClient returns a client for server, a host or host:port; port 53 is
+// assumed. An empty server means DefaultServer.
+func NewClient(server string, timeout time.Duration) (*Client, error) {
+	if server == "" {
+		var err error
+		if server, err = DefaultServer(); err != nil {
+			return nil, err
+		}
+	}
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(strings.Trim(server, "[]"), "53")
+	}
+	if timeout <= 0 {
+		timeout = 3 * time.Second
+	}
+	return &Client{Server: server, Timeout: timeout}, nil
+}
+
+// DefaultServer is the first name server in /etc/resolv.conf.
+func DefaultServer() (string, error) {
+	f, err := os.Open("/etc/resolv.conf")
+	if err != nil {
+		return "", fmt.Errorf("no resolver configured, name one: %w", err)
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			return net.JoinHostPort(fields[1], "53"), nil
+		}
+	}
+	return "", errors.New("no nameserver in /etc/resolv.conf, name a resolver")
+}
+
+// Types are the record types Records asks for by default.
+var Types = []string{"A", "AAAA", "CNAME", "MX", "NS", "SOA", "TXT", "SRV"}
+
+var typeByName = map[string]dnsmessage.Type{
+	"A":     dnsmessage.TypeA,
+	"AAAA":  dnsmessage.TypeAAAA,
+	"CNAME": dnsmessage.TypeCNAME,
+	"MX":    dnsmessage.TypeMX,
+	"NS":    dnsmessage.TypeNS,
+	"SOA":   dnsmessage.TypeSOA,
+	"TXT":   dnsmessage.TypeTXT,
+	"SRV":   dnsmessage.TypeSRV,
+	"PTR":   dnsmessage.TypePTR,
+}
+
+// srvServices are the SRV names looked up under a domain, since SRV
+// records only live under service labels.
+var srvServices = []string{
+	"_ldap._tcp", "_ldap._tcp.dc._msdcs", "_gc._tcp", "_kerberos._tcp", "_kerberos._udp", "_kpasswd._tcp",
+	"_sip._tcp", "_sip._udp", "_sips._tcp", "_xmpp-client._tcp", "_xmpp-server._tcp",
+	"_autodiscover._tcp", "_submission._tcp", "_imaps._tcp", "_pop3s._tcp",
+	"_caldav._tcp", "_caldavs._tcp", "_carddav._tcp", "_carddavs._tcp", "_http._tcp", "_minecraft._tcp",
+}
+
+// ParseTypes checks a comma-separated list of record types.
+func ParseTypes(list string) ([]string, error) {
+	var types []string
+	for _, t := range strings.Split(list, ",") {
+		t = strings.ToUpper(strings.TrimSpace(t))
+		if t == "" {
+			continue
+		}
+		if _, ok := typeByName[t]; !ok {
+			return nil, fmt.Errorf("unknown record type %q (want %s)", t, strings.Join(Types, ", "))
+		}
+		types = append(types, t)
+	}
+	return types, nil
+}
+
+// Failure is a lookup that got no usable answer, such as one that timed
+// out or that the server refused.
+type Failure struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Error string `json:"error"`
+}
+
+// Records looks up the records of the given types for domain; SRV looks
+// up a list of common services under it. Names that do not exist or have
+// no records of a type are not errors. A lookup that fails is listed in
+// failures and the others go on, unless nothing has been answered yet:
+// then the resolver is taken to be unusable and its error is returned.
+func (c *Client) Records(ctx context.Context, domain string, types []string) (records []Record, failures []Failure, err error) {
+	answered := false
+	for _, t := range types {
+		names := []string{domain}
+		if t == "SRV" {
+			names = names[:0]
+			for _, s := range srvServices {
+				names = append(names, s+"."+domain)
+			}
+		}
+		for _, name := range names {
+			rs, err := c.Query(ctx, name, t)
+			if err != nil {
+				var rerr rcodeError
+				switch {
+				case ctx.Err() != nil:
+					return records, failures, ctx.Err()
+				case !answered && !errors.As(err, &rerr):
+					return records, failures, fmt.Errorf("%s %s: %w", name, t, err)
+				}
+				answered = true
+				failures = append(failures, Failure{Name: name, Type: t, Error: err.Error()})
+				continue
+			}
+			answered = true
+			records = append(records, rs...)
+		}
+	}
+	return records, failures, nil
+}
+
+// Query asks for the records of type t for name and returns the answers,
+// CNAMEs leading to them included. A name that does not exist has none.
+func (c *Client) Query(ctx context.Context, name, t string) ([]Record, error) {
+	qtype, ok := typeByName[t]
+	if !ok {
+		return nil, fmt.Errorf("unknown record type %q", t)
+	}
+	q, err := question(name, qtype)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.exchange(ctx, "udp", q)
+	if err == nil && resp.Truncated {
+		resp, err = c.exchange(ctx, "tcp", q)
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch resp.RCode {
+	case dnsmessage.RCodeSuccess, dnsmessage.RCodeNameError:
+	default:
+		return nil, rcodeError(resp.RCode)
+	}
+	var records []Record
+	for _, a := range resp.Answers {
+		records = append(records, record(a))
+	}
+	return records, nil
+}
+
+// rcodeError is a server answering with an error code.
+type rcodeError dnsmessage.RCode
+
+func (rc rcodeError) Error() string {
+	return "server answered " + strings.TrimPrefix(dnsmessage.RCode(rc).String(), "RCode")
+}
+
+func question(name string, t dnsmessage.Type) (dnsmessage.Question, error) {
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	n, err := dnsmessage.NewName(name)
+	if err != nil {
+		return dnsmessage.Question{}, fmt.Errorf("bad name %q: %w", name, err)
+	}
+	return dnsmessage.Question{Name: n, Type: t, Class: dnsmessage.ClassINET}, nil
+}
+
+// exchange sends q to the resolver over network and waits for the answer.
+func (c *Client) exchange(ctx context.Context, network string, q dnsmessage.Question) (*dnsmessage.Message, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, c.Server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	id := uint16(rand.Intn(1 << 16))
+	msg := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{q},
+	}
+	if err := writeMessage(conn, network, msg); err != nil {
+		return nil, err
+	}
+	for {
+		resp, err := readMessage(conn, network)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, err
+		}
+		if resp.ID == id && resp.Response && len(resp.Questions) == 1 && resp.Questions[0] == q {
+			return resp, nil
+		}
+		// A late answer to an earlier query on a reused port; keep reading.
+	}
+}
+
+// writeMessage sends msg, with a length prefix over TCP.
+func writeMessage(conn net.Conn, network string, msg dnsmessage.Message) error {
+	b, err := msg.Pack()
+	if err != nil {
+		return err
+	}
+	if network == "tcp" {
+		b = append(binary.BigEndian.AppendUint16(nil, uint16(len(b))), b...)
+	}
+	_, err = conn.Write(b)
+	return err
+}
+
+func readMessage(conn net.Conn, network string) (*dnsmessage.Message, error) {
+	var b []byte
+	if network == "tcp" {
+		var size [2]byte
+		if _, err := io.ReadFull(conn, size[:]); err != nil {
+			return nil, err
+		}
+		b = make([]byte, binary.BigEndian.Uint16(size[:]))
+		if _, err := io.ReadFull(conn, b); err != nil {
+			return nil, err
+		}
+	} else {
+		b = make([]byte, 65535)
+		n, err := conn.Read(b)
+		if err != nil {
+			return nil, err
+		}
+		b = b[:n]
+	}
+	var msg dnsmessage.Message
+	if err := msg.Unpack(b); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// record turns a resource into a Record.
+func record(r dnsmessage.Resource) Record {
+	rec := Record{
+		Name: strings.TrimSuffix(r.Header.Name.String(), "."),
+		Type: strings.TrimPrefix(r.Header.Type.String(), "Type"),
+		TTL:  r.Header.TTL,
+	}
+	host := func(n dnsmessage.Name) string { return strings.TrimSuffix(n.String(), ".") }
+	switch b := r.Body.(type) {
+	case *dnsmessage.AResource:
+		rec.Value = net.IP(b.A[:]).String()
+	case *dnsmessage.AAAAResource:
+		rec.Value = net.IP(b.AAAA[:]).String()
+	case *dnsmessage.CNAMEResource:
+		rec.Value = host(b.CNAME)
+	case *dnsmessage.NSResource:
+		rec.Value = host(b.NS)
+	case *dnsmessage.PTRResource:
+		rec.Value = host(b.PTR)
+	case *dnsmessage.MXResource:
+		rec.Value = fmt.Sprintf("%d %s", b.Pref, host(b.MX))
+	case *dnsmessage.SRVResource:
+		rec.Value = fmt.Sprintf("%d %d %d %s", b.Priority, b.Weight, b.Port, host(b.Target))
+	case *dnsmessage.SOAResource:
+		rec.Value = fmt.Sprintf("%s %s %d %d %d %d %d", host(b.NS), host(b.MBox), b.Serial, b.Refresh, b.Retry, b.Expire, b.MinTTL)
+	case *dnsmessage.TXTResource:
+		quoted := make([]string, len(b.TXT))
+		for i, s := range b.TXT {
+			quoted[i] = fmt.Sprintf("%q", s)
+		}
+		rec.Value = strings.Join(quoted, " ")
+	case *dnsmessage.UnknownResource:
+		rec.Type = fmt.Sprintf("TYPE%d", uint16(r.Header.Type))
+		rec.Value = fmt.Sprintf("\\# %d %x", len(b.Data), b.Data)
+	default:
+		rec.Value = fmt.Sprint(r.Body)
+	}
+	return rec
+}
@@ -0,0 +1,274 @@
+package dnsrecon
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// server is a stand-in authoritative name server for zone, answering over
+// UDP and TCP on the same loopback port.
+type server struct {
+	zone     string // with the trailing dot
+	records  []dnsmessage.Resource
+	axfr     bool            // allow zone transfers
+	wildcard []byte          // answer A queries for any other name in the zone with this address
+	fail     map[string]bool // names answered with SERVFAIL
+	truncate bool            // answer TXT queries over UDP truncated
+	addr     string
+}
+
+func rr(name string, t dnsmessage.Type, body dnsmessage.ResourceBody) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Type: t, Class: dnsmessage.ClassINET, TTL: 300},
+		Body:   body,
+	}
+}
+
+func a(ip string) *dnsmessage.AResource {
+	var r dnsmessage.AResource
+	copy(r.A[:], net.ParseIP(ip).To4())
+	return &r
+}
+
+// exampleZone is example.test with a name server, mail, a service and an
+// address for www.
+func exampleZone() *server {
+	soa := &dnsmessage.SOAResource{NS: dnsmessage.MustNewName("ns1.example.test."), MBox: dnsmessage.MustNewName("hostmaster.example.test."),
+		Serial: 2024050101, Refresh: 3600, Retry: 600, Expire: 86400, MinTTL: 300}
+	return &server{
+		zone: "example.test.",
+		records: []dnsmessage.Resource{
+			rr("example.test.", dnsmessage.TypeSOA, soa),
+			rr("example.test.", dnsmessage.TypeNS, &dnsmessage.NSResource{NS: dnsmessage.MustNewName("ns1.example.test.")}),
+			rr("example.test.", dnsmessage.TypeA, a("192.0.2.1")),
+			rr("example.test.", dnsmessage.TypeMX, &dnsmessage.MXResource{Pref: 10, MX: dnsmessage.MustNewName("mail.example.test.")}),
+			rr("example.test.", dnsmessage.TypeTXT, &dnsmessage.TXTResource{TXT: []string{"v=spf1 -all"}}),
+			rr("ns1.example.test.", dnsmessage.TypeA, a("192.0.2.53")),
+			rr("mail.example.test.", dnsmessage.TypeA, a("192.0.2.25")),
+			rr("www.example.test.", dnsmessage.TypeA, a("192.0.2.80")),
+			rr("_ldap._tcp.example.test.", dnsmessage.TypeSRV, &dnsmessage.SRVResource{Priority: 0, Weight: 5, Port: 389, Target: dnsmessage.MustNewName("dc.example.test.")}),
+		},
+	}
+}
+
+// start serves s until the test ends and returns a client for it.
+func (s *server) start(t *testing.T) *Client {
+	t.Helper()
+	var udp net.PacketConn
+	var tcp net.Listener
+	for tries := 0; ; tries++ {
+		var err error
+		if udp, err = net.ListenPacket("udp", "127.0.0.1:0"); err != nil {
+			t.Fatal(err)
+		}
+		if tcp, err = net.Listen("tcp", udp.LocalAddr().String()); err == nil {
+			break
+		}
+		udp.Close()
+		if tries == 10 {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() {
+		udp.Close()
+		tcp.Close()
+	})
+	s.addr = udp.LocalAddr().String()
+
+	go func() {
+		b := make([]byte, 65535)
+		for {
+			n, from, err := udp.ReadFrom(b)
+			if err != nil {
+				return
+			}
+			var req dnsmessage.Message
+			if req.Unpack(b[:n]) != nil || len(req.Questions) != 1 {
+				continue
+			}
+			resp := s.answer(req)
+			if s.truncate && req.Questions[0].Type == dnsmessage.TypeTXT {
+				resp.Truncated = true
+				resp.Answers = nil
+			}
+			if out, err := resp.Pack(); err == nil {
+				udp.WriteTo(out, from)
+			}
+		}
+	}()
+	go func() {
+		for {
+			conn, err := tcp.Accept()
+			if err != nil {
+				return
+			}
+			go s.serveTCP(conn)
+		}
+	}()
+
+	c, err := NewClient(s.addr, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func (s *server) serveTCP(conn net.Conn) {
+	defer conn.Close()
+	for {
+		req, err := readMessage(conn, "tcp")
+		if err != nil || len(req.Questions) != 1 {
+			return
+		}
+		if req.Questions[0].Type != dnsmessage.TypeAXFR {
+			writeMessage(conn, "tcp", s.answer(*req))
+			continue
+		}
+		resp := dnsmessage.Message{Header: dnsmessage.Header{ID: req.ID, Response: true, Authoritative: true}, Questions: req.Questions}
+		if !s.axfr {
+			resp.RCode = dnsmessage.RCodeRefused
+			writeMessage(conn, "tcp", resp)
+			continue
+		}
+		// The zone in two messages, between copies of its SOA record.
+		soa, rest := s.records[0], s.records[1:]
+		resp.Answers = append([]dnsmessage.Resource{soa}, rest[:len(rest)/2]...)
+		writeMessage(conn, "tcp", resp)
+		resp.Answers = append(rest[len(rest)/2:len(rest):len(rest)], soa)
+		writeMessage(conn, "tcp", resp)
+	}
+}
+
+func (s *server) answer(req dnsmessage.Message) dnsmessage.Message {
+	q := req.Questions[0]
+	resp := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: req.ID, Response: true, Authoritative: true, RecursionDesired: req.RecursionDesired},
+		Questions: req.Questions,
+	}
+	name := strings.ToLower(q.Name.String())
+	if s.fail[name] {
+		resp.RCode = dnsmessage.RCodeServerFailure
+		return resp
+	}
+	exists := false
+	for _, r := range s.records {
+		if strings.EqualFold(r.Header.Name.String(), name) {
+			exists = true
+			if r.Header.Type == q.Type {
+				resp.Answers = append(resp.Answers, r)
+			}
+		}
+	}
+	if !exists && s.wildcard != nil && strings.HasSuffix(name, "."+s.zone) {
+		exists = true
+		if q.Type == dnsmessage.TypeA {
+			resp.Answers = append(resp.Answers, rr(name, dnsmessage.TypeA, a(net.IP(s.wildcard).String())))
+		}
+	}
+	if !exists {
+		resp.RCode = dnsmessage.RCodeNameError
+	}
+	return resp
+}
+
+func values(records []Record) []string {
+	out := []string{}
+	for _, r := range records {
+		out = append(out, r.Name+" "+r.Type+" "+r.Value)
+	}
+	return out
+}
+
+func TestQuery(t *testing.T) {
+	s := exampleZone()
+	s.truncate = true
+	s.fail = map[string]bool{"broken.example.test.": true}
+	c := s.start(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name, typ string
+		want      []string
+	}{
+		{"www.example.test", "A", []string{"www.example.test A 192.0.2.80"}},
+		{"example.test", "MX", []string{"example.test MX 10 mail.example.test"}},
+		{"_ldap._tcp.example.test", "SRV", []string{"_ldap._tcp.example.test SRV 0 5 389 dc.example.test"}},
+		{"example.test", "TXT", []string{`example.test TXT "v=spf1 -all"`}}, // over TCP after truncation
+		{"www.example.test", "AAAA", []string{}},                            // no records of the type
+		{"nope.example.test", "A", []string{}},                              // NXDOMAIN
+	}
+	for _, tt := range tests {
+		rs, err := c.Query(ctx, tt.name, tt.typ)
+		if err != nil {
+			t.Errorf("Query(%s, %s): %v", tt.name, tt.typ, err)
+			continue
+		}
+		if got := values(rs); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Query(%s, %s) = %v, want %v", tt.name, tt.typ, got, tt.want)
+		}
+	}
+
+	var rerr rcodeError
+	if _, err := c.Query(ctx, "broken.example.test", "A"); !errors.As(err, &rerr) || dnsmessage.RCode(rerr) != dnsmessage.RCodeServerFailure {
+		t.Errorf("Query of a SERVFAIL name: %v, want a server failure", err)
+	}
+	if _, err := c.Query(ctx, "example.test", "HINFO"); err == nil {
+		t.Errorf("Query of an unknown type succeeded")
+	}
+}
+
+func TestRecords(t *testing.T) {
+	s := exampleZone()
+	s.fail = map[string]bool{"_sip._udp.example.test.": true}
+	c := s.start(t)
+
+	records, failures, err := c.Records(context.Background(), "example.test", []string{"A", "MX", "SRV"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"example.test A 192.0.2.1", "example.test MX 10 mail.example.test", "_ldap._tcp.example.test SRV 0 5 389 dc.example.test"}
+	if got := values(records); !reflect.DeepEqual(got, want) {
+		t.Errorf("Records = %v, want %v", got, want)
+	}
+	// The failing service name is reported and the others still looked up.
+	if len(failures) != 1 || failures[0].Name != "_sip._udp.example.test" || failures[0].Type != "SRV" {
+		t.Errorf("failures %+v, want only _sip._udp.example.test SRV", failures)
+	}
+
+	// A resolver that answers nothing is an error straight away.
+	dead, err := NewClient("127.0.0.1:1", 200*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := dead.Records(context.Background(), "example.test", Types); err == nil {
+		t.Errorf("Records from a dead resolver succeeded")
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	for server, want := range map[string]string{
+		"192.0.2.53":       "192.0.2.53:53",
+		"192.0.2.53:5353":  "192.0.2.53:5353",
+		"2001:db8::53":     "[2001:db8::53]:53",
+		"[2001:db8::53]":   "[2001:db8::53]:53",
+		"[2001:db8::53]:5": "[2001:db8::53]:5",
+	} {
+		c, err := NewClient(server, 0)
+		if err != nil || c.Server != want || c.Timeout != 3*time.Second {
+			t.Errorf("NewClient(%q) = %+v, %v, want server %s", server, c, err, want)
+		}
+	}
+	if _, err := ParseTypes("a, mx,PTR"); err != nil {
+		t.Errorf("ParseTypes: %v", err)
+	}
+	if _, err := ParseTypes("A,HINFO"); err == nil {
+		t.Errorf("ParseTypes accepted HINFO")
+	}
+}
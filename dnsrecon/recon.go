@@ -0,0 +1,263 @@
+package dnsrecon
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Transfer is the outcome of a zone transfer attempt from one server.
+type Transfer struct {
+	Server  string   `json:"server"`
+	Records []Record `json:"records,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// Result is everything found about a domain.
+type Result struct {
+	Domain     string     `json:"domain"`
+	Server     string     `json:"server"`
+	Records    []Record   `json:"records"`
+	Failures   []Failure  `json:"failures,omitempty"` // lookups of records that got no answer
+	Transfers  []Transfer `json:"transfers,omitempty"`
+	Subdomains []Record   `json:"subdomains,omitempty"`
+	Wildcard   []string   `json:"wildcard,omitempty"` // addresses any name under the domain resolves to
+}
+
+// Addresses returns every IPv4 and IPv6 address found, sorted, ready to be
+// scanned.
+func (r *Result) Addresses() []string {
+	seen := map[string]bool{}
+	add := func(records []Record) {
+		for _, rec := range records {
+			if rec.Type == "A" || rec.Type == "AAAA" {
+				seen[rec.Value] = true
+			}
+		}
+	}
+	add(r.Records)
+	for _, t := range r.Transfers {
+		add(t.Records)
+	}
+	add(r.Subdomains)
+
+	addrs := make([]string, 0, len(seen))
+	for a := range seen {
+		addrs = append(addrs, a)
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		a, b := net.ParseIP(addrs[i]), net.ParseIP(addrs[j])
+		if (a.To4() == nil) != (b.To4() == nil) {
+			return a.To4() != nil
+		}
+		return string(a.To16()) < string(b.To16())
+	})
+	return addrs
+}
+
+// Transfer asks server, a name server's host name or address with an
+// optional port (53 if left out), for a full copy of zone (AXFR). Most
+// servers refuse; one that complies hands over every name in the zone.
+func (c *Client) Transfer(ctx context.Context, zone, server string) ([]Record, error) {
+	port := "53"
+	if host, p, err := net.SplitHostPort(server); err == nil {
+		server, port = host, p
+	}
+	addr := server
+	if net.ParseIP(server) == nil {
+		rs, err := c.Query(ctx, server, "A")
+		if err != nil {
+			return nil, err
+		}
+		addr = ""
+		for _, r := range rs {
+			if r.Type == "A" {
+				addr = r.Value
+				break
+			}
+		}
+		if addr == "" {
+			return nil, fmt.Errorf("%s has no address", server)
+		}
+	}
+	q, err := question(zone, dnsmessage.TypeAXFR)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*c.Timeout)
+	defer cancel()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(addr, port))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	id := uint16(rand.Intn(1 << 16))
+	if err := writeMessage(conn, "tcp", dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id},
+		Questions: []dnsmessage.Question{q},
+	}); err != nil {
+		return nil, err
+	}
+
+	// The zone comes in as many messages as it takes, starting and ending
+	// with its SOA record.
+	var records []Record
+	soas := 0
+	for soas < 2 {
+		msg, err := readMessage(conn, "tcp")
+		if err != nil {
+			if ctx.Err() != nil {
+				return records, ctx.Err()
+			}
+			return records, err
+		}
+		if msg.ID != id {
+			continue
+		}
+		if msg.RCode != dnsmessage.RCodeSuccess {
+			return records, rcodeError(msg.RCode)
+		}
+		if len(msg.Answers) == 0 {
+			return records, fmt.Errorf("transfer ended early")
+		}
+		for _, a := range msg.Answers {
+			if a.Header.Type == dnsmessage.TypeSOA {
+				soas++
+				if soas == 2 {
+					break
+				}
+			}
+			records = append(records, record(a))
+		}
+	}
+	return records, nil
+}
+
+// Brute looks up word.domain for every word, concurrency names at a time,
+// and returns the A and AAAA records of those that exist, under the names
+// asked for. A domain with a wildcard record answers for any name, so
+// random names are looked up first: names that resolve only to the
+// addresses they did are left out, and those addresses are returned as
+// wildcard. fn, if not nil, is called with each record as it is found.
+func (c *Client) Brute(ctx context.Context, domain string, words []string, concurrency int, fn func(Record)) (found []Record, wildcard []string, err error) {
+	if concurrency < 1 {
+		concurrency = 20
+	}
+	resolve := func(name string) ([]Record, error) {
+		var addrs []Record
+		for _, t := range []string{"A", "AAAA"} {
+			rs, err := c.Query(ctx, name, t)
+			if err != nil {
+				return addrs, err
+			}
+			for _, r := range rs {
+				if r.Type == t {
+					r.Name = name
+					addrs = append(addrs, r)
+				}
+			}
+		}
+		return addrs, nil
+	}
+
+	wild := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		rs, err := resolve(fmt.Sprintf("%s.%s", randomLabel(), domain))
+		if err != nil {
+			return nil, nil, fmt.Errorf("wildcard check: %w", err)
+		}
+		for _, r := range rs {
+			if !wild[r.Value] {
+				wild[r.Value] = true
+				wildcard = append(wildcard, r.Value)
+			}
+		}
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	names := make(chan string)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range names {
+				// A name that fails to resolve is as good as missing here.
+				rs, _ := resolve(name)
+				real := false
+				for _, r := range rs {
+					real = real || !wild[r.Value]
+				}
+				if !real {
+					continue
+				}
+				mu.Lock()
+				for _, r := range rs {
+					found = append(found, r)
+					if fn != nil {
+						fn(r)
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, w := range words {
+		select {
+		case names <- w + "." + domain:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(names)
+	wg.Wait()
+
+	sort.SliceStable(found, func(i, j int) bool { return found[i].Name < found[j].Name })
+	return found, wildcard, ctx.Err()
+}
+
+func randomLabel() string {
+	return "nx" + strconv.FormatUint(rand.Uint64(), 36)
+}
+
+// ReadWordlist reads subdomain labels from path, one per line. Blank lines
+// and lines starting with # are skipped.
+func ReadWordlist(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var words []string
+	seen := map[string]bool{}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		w := strings.ToLower(strings.TrimSpace(sc.Text()))
+		if w == "" || strings.HasPrefix(w, "#") || seen[w] {
+			continue
+		}
+		seen[w] = true
+		words = append(words, w)
+	}
+	return words, sc.Err()
+}
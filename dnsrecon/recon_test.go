@@ -0,0 +1,113 @@
+package dnsrecon
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestTransfer(t *testing.T) {
+	s := exampleZone()
+	s.axfr = true
+	c := s.start(t)
+
+	records, err := c.Transfer(context.Background(), "example.test", s.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every record once, the SOA only at the start.
+	if len(records) != len(s.records) || records[0].Type != "SOA" {
+		t.Fatalf("Transfer = %v, want the %d records of the zone", values(records), len(s.records))
+	}
+	for _, r := range records[1:] {
+		if r.Type == "SOA" {
+			t.Errorf("Transfer repeated the SOA: %v", values(records))
+		}
+	}
+	if got := values(records)[0]; got != "example.test SOA ns1.example.test hostmaster.example.test 2024050101 3600 600 86400 300" {
+		t.Errorf("SOA %s", got)
+	}
+}
+
+func TestTransferRefused(t *testing.T) {
+	s := exampleZone()
+	c := s.start(t)
+	records, err := c.Transfer(context.Background(), "example.test", s.addr)
+	if err == nil || !strings.Contains(err.Error(), "Refused") || len(records) != 0 {
+		t.Errorf("Transfer = %v, %v, want refused", values(records), err)
+	}
+}
+
+func TestBrute(t *testing.T) {
+	words := []string{"www", "mail", "nope", "ns1"}
+
+	s := exampleZone()
+	c := s.start(t)
+	var seen []string
+	found, wildcard, err := c.Brute(context.Background(), "example.test", words, 2, func(r Record) { seen = append(seen, r.Name) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"mail.example.test A 192.0.2.25", "ns1.example.test A 192.0.2.53", "www.example.test A 192.0.2.80"}
+	if got := values(found); !reflect.DeepEqual(got, want) || len(wildcard) != 0 {
+		t.Errorf("Brute = %v, wildcard %v, want %v and none", got, wildcard, want)
+	}
+	if len(seen) != len(want) {
+		t.Errorf("fn saw %v, want every record found", seen)
+	}
+}
+
+func TestBruteWildcard(t *testing.T) {
+	s := exampleZone()
+	s.wildcard = []byte{192, 0, 2, 99}
+	// mail resolves to the wildcard address, so it cannot be told from a
+	// name that does not exist.
+	for i, r := range s.records {
+		if r.Header.Name.String() == "mail.example.test." {
+			s.records[i] = rr("mail.example.test.", dnsmessage.TypeA, a("192.0.2.99"))
+		}
+	}
+	c := s.start(t)
+
+	found, wildcard, err := c.Brute(context.Background(), "example.test", []string{"www", "mail", "nope"}, 4, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := values(found), []string{"www.example.test A 192.0.2.80"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Brute = %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(wildcard, []string{"192.0.2.99"}) {
+		t.Errorf("wildcard %v, want 192.0.2.99", wildcard)
+	}
+}
+
+func TestAddresses(t *testing.T) {
+	r := Result{
+		Records:    []Record{{Type: "A", Value: "192.0.2.80"}, {Type: "AAAA", Value: "2001:db8::1"}, {Type: "MX", Value: "10 mail"}},
+		Transfers:  []Transfer{{Records: []Record{{Type: "A", Value: "192.0.2.25"}, {Type: "A", Value: "192.0.2.80"}}}},
+		Subdomains: []Record{{Type: "A", Value: "192.0.2.9"}},
+	}
+	want := []string{"192.0.2.9", "192.0.2.25", "192.0.2.80", "2001:db8::1"}
+	if got := r.Addresses(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Addresses = %v, want %v", got, want)
+	}
+}
+
+func TestReadWordlist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "words.txt")
+	if err := os.WriteFile(path, []byte("# common\nwww\n\nMail\n  vpn  \nwww\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	words, err := ReadWordlist(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"www", "mail", "vpn"}; !reflect.DeepEqual(words, want) {
+		t.Errorf("ReadWordlist = %v, want %v", words, want)
+	}
+}
@@ -0,0 +1,178 @@
+// Package history keeps past scan reports in an embedded bbolt database.
+package history
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"network-scanner/scan"
+)
+
+var scansBucket = []byte("scans")
+
+// ErrNotFound is returned for a scan ID that is not in the store.
+var ErrNotFound = errors.New("scan not found")
+
+// Store is an open history database.
+type Store struct {
+	db *bolt.DB
+}
+
+// DefaultPath is where the CLI and GUI keep their history unless told
+// otherwise: history.db under the user's configuration directory.
+func DefaultPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = "."
+	}
+	return filepath.Join(dir, "network-scanner", "history.db")
+}
+
+// Open opens or creates the database at path. The file is locked while it
+// is open, so callers should Close it as soon as they are done and not hold
+// it for the length of a scan.
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("opening history %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(scansBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+// Close releases the database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+func key(id uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, id)
+	return k
+}
+
+// Save stores r under a new ID, which is also set on r.
+func (s *Store) Save(r *scan.Report) (uint64, error) {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(scansBucket)
+		id, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		r.ID = id
+		data, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		return b.Put(key(id), data)
+	})
+	if err != nil {
+		r.ID = 0
+		return 0, err
+	}
+	return r.ID, nil
+}
+
+// Get returns the scan with the given ID.
+func (s *Store) Get(id uint64) (*scan.Report, error) {
+	var r scan.Report
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(scansBucket).Get(key(id))
+		if data == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(data, &r)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// List returns up to limit scans, newest first. A limit of 0 returns all.
+func (s *Store) List(limit int) ([]*scan.Report, error) {
+	var out []*scan.Report
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(scansBucket).Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var r scan.Report
+			if err := json.Unmarshal(v, &r); err != nil {
+				return fmt.Errorf("scan %d: %w", binary.BigEndian.Uint64(k), err)
+			}
+			out = append(out, &r)
+			if limit > 0 && len(out) >= limit {
+				break
+			}
+		}
+		return nil
+	})
+	return out, err
+}
+
+// Delete removes a scan.
+func (s *Store) Delete(id uint64) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(scansBucket)
+		if b.Get(key(id)) == nil {
+			return ErrNotFound
+		}
+		return b.Delete(key(id))
+	})
+}
+
+// Record opens the database at path, saves r and closes it again.
+func Record(path string, r *scan.Report) (uint64, error) {
+	s, err := Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer s.Close()
+	return s.Save(r)
+}
+
+// Previous returns the most recent scan before r with the same command and
+// target, or ErrNotFound if r is the first.
+func (s *Store) Previous(r *scan.Report) (*scan.Report, error) {
+	var prev *scan.Report
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(scansBucket).Cursor()
+		k, v := c.Last()
+		if r.ID != 0 {
+			k, v = c.Seek(key(r.ID))
+			if k == nil {
+				k, v = c.Last()
+			} else {
+				k, v = c.Prev()
+			}
+		}
+		for ; k != nil; k, v = c.Prev() {
+			var candidate scan.Report
+			if err := json.Unmarshal(v, &candidate); err != nil {
+				return fmt.Errorf("scan %d: %w", binary.BigEndian.Uint64(k), err)
+			}
+			if candidate.Command == r.Command && candidate.Target == r.Target {
+				prev = &candidate
+				return nil
+			}
+		}
+		return ErrNotFound
+	})
+	return prev, err
+}
@@ -1,9 +1,15 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"image/color"
 	"net"
+	"os"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -13,10 +19,16 @@ import (
 	"fyne.io/fyne/v2/app"
 	"fyne.io/fyne/v2/canvas"
 	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/layout"
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
-	"github.com/go-ping/ping"
+	"gopkg.in/yaml.v3"
+
+	"network-scanner/history"
+	"network-scanner/notify"
+	"network-scanner/scan"
+	"network-scanner/schedule"
 )
 
 // Custom theme for better colors
@@ -61,14 +73,28 @@ func (m myTheme) Size(name fyne.ThemeSizeName) float32 {
 }
 
 type Scanner struct {
-	results      *widget.List
-	resultData   []ScanResult
-	progress     *widget.ProgressBar
-	status       *widget.Label
-	mu           sync.Mutex
-	isScanning   bool
-	scanningBtn  *widget.Button
-	stopScanning chan bool
+	results     *widget.List
+	resultData  []ScanResult
+	progress    *widget.ProgressBar
+	status      *widget.Label
+	mu          sync.Mutex
+	isScanning  bool
+	scanningBtn *widget.Button
+	cancel      context.CancelFunc
+	engine      *scan.Engine // engine of the running scan, for pause/resume
+	pauseBtn    *widget.Button
+
+	onHistorySaved func()
+	timing         scan.Timing
+	retries        int     // overrides timing.Retries when >= 0
+	maxRate        float64 // probes per second, 0 for no limit
+	services       bool    // identify services on open ports
+	mdns           string  // "active" or "passive" to browse mDNS after a network scan
+	ssdp           bool    // search for UPnP devices after a network scan
+	netbios        bool    // query NetBIOS names and SMB dialects after a network scan
+	snmp           string  // community strings to try on live hosts after a network scan, "" for none
+	osGuess        bool    // guess the operating system of live hosts after a network scan
+	privileged     bool    // send ICMP echoes from a raw socket even where ping sockets are allowed
 }
 
 type ScanResult struct {
@@ -79,10 +105,11 @@ type ScanResult struct {
 
 func NewScanner() *Scanner {
 	s := &Scanner{
-		resultData:   []ScanResult{},
-		status:       widget.NewLabelWithStyle("🚀 Ready to scan networks", fyne.TextAlignLeading, fyne.TextStyle{}),
-		progress:     widget.NewProgressBar(),
-		stopScanning: make(chan bool),
+		resultData: []ScanResult{},
+		status:     widget.NewLabelWithStyle("🚀 Ready to scan networks", fyne.TextAlignLeading, fyne.TextStyle{}),
+		progress:   widget.NewProgressBar(),
+		timing:     scan.DefaultTiming,
+		retries:    -1,
 	}
 
 	// Enhanced progress bar
@@ -190,6 +217,21 @@ func (s *Scanner) setScanning(scanning bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.isScanning = scanning
+	if !scanning && s.cancel != nil {
+		s.cancel()
+		s.cancel = nil
+	}
+	if !scanning {
+		s.engine = nil
+	}
+	if s.pauseBtn != nil {
+		s.pauseBtn.SetText("⏸️ Pause")
+		if scanning {
+			s.pauseBtn.Enable()
+		} else {
+			s.pauseBtn.Disable()
+		}
+	}
 	if s.scanningBtn != nil {
 		if scanning {
 			s.scanningBtn.SetText("⏹️ Stop Scan")
@@ -201,203 +243,544 @@ func (s *Scanner) setScanning(scanning bool) {
 	}
 }
 
-func (s *Scanner) scanPorts(host string, startPort, endPort int) {
-	s.clearResults()
+// beginScan marks a scan started from btn as running and returns the
+// context it should run under. It is called on the UI thread before the
+// scan goroutine starts so a second click always sees isScanning.
+func (s *Scanner) beginScan(btn *widget.Button) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.mu.Lock()
+	s.cancel = cancel
+	s.scanningBtn = btn
+	s.mu.Unlock()
 	s.setScanning(true)
-	s.updateStatus("🔍 Scanning ports...")
-	s.addResult(fmt.Sprintf("🎯 Starting port scan on %s (ports %d-%d)", host, startPort, endPort), "info")
+	return ctx
+}
 
-	totalPorts := endPort - startPort + 1
-	scannedPorts := 0
-	openPorts := 0
+func (s *Scanner) scanning() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.isScanning
+}
 
-	for port := startPort; port <= endPort; port++ {
-		select {
-		case <-s.stopScanning:
-			s.addResult("⏹️ Scan stopped by user", "warning")
-			s.setScanning(false)
-			s.updateStatus("⏹️ Scan stopped")
-			return
-		default:
+// stopScan cancels the running scan. The scan goroutine reports the stop
+// and clears the scanning state once its probes have wound down.
+func (s *Scanner) stopScan() {
+	s.mu.Lock()
+	cancel := s.cancel
+	s.mu.Unlock()
+	if cancel != nil {
+		cancel()
+		s.updateStatus("⏳ Stopping scan...")
+	}
+}
+
+// togglePause pauses the running scan, or resumes it if it is paused.
+func (s *Scanner) togglePause() {
+	s.mu.Lock()
+	engine := s.engine
+	s.mu.Unlock()
+	if engine == nil {
+		return
+	}
+
+	if engine.Paused() {
+		engine.Resume()
+		s.pauseBtn.SetText("⏸️ Pause")
+		s.addResult("▶️ Scan resumed", "info")
+		s.updateStatus("▶️ Scan resumed")
+	} else {
+		engine.Pause()
+		s.pauseBtn.SetText("▶️ Resume")
+		s.addResult("⏸️ Scan paused - probes already sent will still report", "warning")
+		s.updateStatus("⏸️ Scan paused")
+	}
+}
+
+// newScanEngine builds the engine for a scan and remembers it so the pause
+// button can reach it.
+func (s *Scanner) newScanEngine() *scan.Engine {
+	engine := s.newEngine()
+	s.mu.Lock()
+	s.engine = engine
+	s.mu.Unlock()
+	return engine
+}
+
+func (s *Scanner) newEngine() *scan.Engine {
+	timing := s.timing
+	if s.retries >= 0 {
+		timing.Retries = s.retries
+	}
+	timing.MaxRate = s.maxRate
+	engine := scan.NewEngine(timing)
+	engine.Services = s.services
+	engine.Privileged = s.privileged
+	return engine
+}
+
+// checkICMP reports why engine cannot send ICMP echoes, if it cannot, so
+// that a sweep does not show every host as down.
+func (s *Scanner) checkICMP(engine *scan.Engine) bool {
+	mode, err := engine.ICMPMode()
+	if err != nil {
+		s.addResult(fmt.Sprintf("❌ Cannot ping: %v", err), "error")
+		s.updateStatus("❌ ICMP not permitted")
+		return false
+	}
+	s.addResult(fmt.Sprintf("📡 Sending ICMP echoes from a %s socket", mode), "info")
+	return true
+}
+
+func (s *Scanner) reportRetries(engine *scan.Engine) {
+	if summary := engine.RetrySummary(); summary != "" {
+		s.addResult("🔁 Retries: "+summary, "info")
+	}
+}
+
+// saveHistory records a finished scan in the history database and
+// highlights what changed since the previous run of the same scan.
+func (s *Scanner) saveHistory(report *scan.Report) {
+	store, err := history.Open(history.DefaultPath())
+	if err != nil {
+		s.addResult(fmt.Sprintf("⚠️ Could not save scan to history: %v", err), "warning")
+		return
+	}
+	defer store.Close()
+	id, err := store.Save(report)
+	if err != nil {
+		s.addResult(fmt.Sprintf("⚠️ Could not save scan to history: %v", err), "warning")
+		return
+	}
+	s.addResult(fmt.Sprintf("🗄️ Saved as scan #%d in history", id), "info")
+	prev, err := store.Previous(report)
+	if err != nil || prev.Interrupted {
+		prev = nil
+	}
+	if prev != nil && !report.Interrupted {
+		s.showChanges(scan.Compare(prev, report))
+	}
+	s.sendAlerts(prev, report)
+	if s.onHistorySaved != nil {
+		s.onHistorySaved()
+	}
+}
+
+// sendAlerts notifies the channels in the notifications file, if there is
+// one, about what is new in report.
+func (s *Scanner) sendAlerts(prev, report *scan.Report) {
+	if report.Interrupted {
+		return
+	}
+	if _, err := os.Stat(notify.DefaultPath()); err != nil {
+		return
+	}
+	cfg, err := notify.Load(notify.DefaultPath())
+	if err != nil {
+		s.addResult(fmt.Sprintf("⚠️ %v", err), "warning")
+		return
+	}
+	go func() {
+		if err := cfg.Notify(context.Background(), prev, report); err != nil {
+			s.addResult(fmt.Sprintf("⚠️ Could not send alerts: %v", err), "warning")
 		}
+	}()
+}
 
-		address := fmt.Sprintf("%s:%d", host, port)
+// showChanges adds a result line for each difference from the previous scan.
+func (s *Scanner) showChanges(d *scan.Diff) {
+	if d.Empty() {
+		s.addResult(fmt.Sprintf("🟰 No changes since scan #%d", d.Old.ID), "info")
+		return
+	}
+	s.addResult(fmt.Sprintf("🔀 Changes since scan #%d:", d.Old.ID), "info")
+	for _, h := range d.NewHosts {
+		s.addResult("🆕 New host "+h, "warning")
+	}
+	for _, h := range d.GoneHosts {
+		s.addResult("👻 Host gone "+h, "error")
+	}
+	for _, c := range d.Opened {
+		s.addResult("🆕 Newly open port "+c.String(), "warning")
+	}
+	for _, c := range d.Closed {
+		s.addResult("🚪 Port closed "+c.String(), "error")
+	}
+	for _, c := range d.Changed {
+		s.addResult("✏️ Changed "+c.String(), "warning")
+	}
+}
 
-		conn, err := net.DialTimeout("tcp", address, 1*time.Second)
-		if err == nil {
-			conn.Close()
+func (s *Scanner) scanPorts(ctx context.Context, host string, startPort, endPort int) {
+	defer s.setScanning(false)
+	s.clearResults()
+	s.updateStatus("🔍 Scanning ports...")
+	engine := s.newScanEngine()
+	s.addResult(fmt.Sprintf("🎯 Starting port scan on %s (ports %d-%d, %s timing)", host, startPort, endPort, s.timing.Name), "info")
+	report := scan.NewReport("portscan", host, append(engine.Params(), scan.PortParams(fmt.Sprintf("%d-%d", startPort, endPort))...)...)
+	report.AddHost(host)
+	totalPorts := endPort - startPort + 1
+	scannedPorts := 0
+	openPorts := 0
+
+	mode, err := engine.ScanPorts(ctx, host, startPort, endPort, func(p scan.Port, open bool) {
+		if open {
 			openPorts++
-			s.addResult(fmt.Sprintf("✅ Port %d: OPEN", port), "success")
+			report.AddPort(host, p)
+			msg := fmt.Sprintf("✅ Port %d: OPEN", p.Number)
+			if p.Service != "" {
+				msg += " (" + p.Service + ")"
+			}
+			if p.Version != "" {
+				msg += " " + p.Version
+			}
+			s.addResult(msg, "success")
 		}
 
 		scannedPorts++
-		progress := float64(scannedPorts) / float64(totalPorts)
-		s.updateProgress(progress)
-
+		s.updateProgress(float64(scannedPorts) / float64(totalPorts))
 		if scannedPorts%25 == 0 {
-			s.updateStatus(fmt.Sprintf("🔍 Scanning... %d/%d ports (%d open)", scannedPorts, totalPorts, openPorts))
+			s.updateStatus(fmt.Sprintf("🔍 Scanning... %d/%d ports (%d open) • %.0f probes/s", scannedPorts, totalPorts, openPorts, engine.Rate()))
 		}
-	}
+	})
 
-	s.setScanning(false)
-	s.addResult(fmt.Sprintf("🎉 Scan complete! Found %d open ports out of %d scanned", openPorts, totalPorts), "info")
+	s.reportRetries(engine)
+	report.AddScanMode(mode)
+	report.Finish(scannedPorts, err != nil)
+	s.saveHistory(report)
+	if err != nil {
+		s.addResult(fmt.Sprintf("⏹️ Scan stopped by user after %d of %d ports (%d open, %s scan)", scannedPorts, totalPorts, openPorts, mode), "warning")
+		s.updateStatus("⏹️ Scan stopped")
+		return
+	}
+	s.addResult(fmt.Sprintf("🎉 Scan complete! Found %d open ports out of %d scanned (%s scan)", openPorts, totalPorts, mode), "info")
 	s.updateStatus(fmt.Sprintf("✅ Scan complete. %d open ports found.", openPorts))
 }
 
-func (s *Scanner) scanNetwork(network string) {
+// traceroute shows the path to host hop by hop.
+func (s *Scanner) traceroute(ctx context.Context, host, method string) {
+	defer s.setScanning(false)
+	s.clearResults()
+	s.updateStatus("🧭 Tracing route...")
+	s.addResult(fmt.Sprintf("🧭 Traceroute to %s with %s probes", host, method), "info")
+
+	route, err := s.newScanEngine().Traceroute(ctx, host, scan.TraceOptions{Method: method}, func(h scan.Hop) {
+		resultType := "info"
+		for _, p := range h.Probes {
+			if p.Flag != "" {
+				resultType = "warning"
+			}
+		}
+		s.addResult(fmt.Sprintf("%2d  %s", h.TTL, h), resultType)
+		s.updateProgress(float64(h.TTL) / 30)
+	})
+	s.updateProgress(1)
+	switch {
+	case ctx.Err() != nil:
+		s.addResult("⏹️ Traceroute stopped by user", "warning")
+		s.updateStatus("⏹️ Traceroute stopped")
+	case err != nil:
+		s.addResult(fmt.Sprintf("❌ Traceroute failed: %v", err), "error")
+		s.updateStatus("❌ Traceroute failed")
+	case route.Reached:
+		s.addResult(fmt.Sprintf("🎉 Reached %s in %d hops", route.Addr, len(route.Hops)), "success")
+		s.updateStatus(fmt.Sprintf("✅ Reached %s in %d hops", host, len(route.Hops)))
+	default:
+		s.addResult(fmt.Sprintf("❌ %s (%s) did not answer within %d hops", host, route.Addr, len(route.Hops)), "error")
+		s.updateStatus("✅ Traceroute complete")
+	}
+}
+
+func (s *Scanner) scanNetwork(ctx context.Context, network string) {
+	defer s.setScanning(false)
 	s.clearResults()
-	s.setScanning(true)
 	s.updateStatus("🌐 Scanning network...")
 	s.addResult(fmt.Sprintf("🌍 Starting network discovery on %s", network), "info")
 
-	_, ipNet, err := net.ParseCIDR(network)
+	ips, err := scan.CIDRHosts(network)
 	if err != nil {
 		s.addResult(fmt.Sprintf("❌ Error parsing network: %v", err), "error")
-		s.setScanning(false)
 		return
 	}
 
-	var ips []string
-	for ip := ipNet.IP.Mask(ipNet.Mask); ipNet.Contains(ip); inc(ip) {
-		ips = append(ips, ip.String())
+	engine := s.newScanEngine()
+	if !s.checkICMP(engine) {
+		return
 	}
-
+	report := scan.NewReport("netscan", network, engine.Params()...)
 	totalIPs := len(ips)
 	scannedIPs := 0
 	aliveHosts := 0
 
-	var wg sync.WaitGroup
-	semaphore := make(chan struct{}, 50)
+	err = engine.PingSweep(ctx, ips, func(r scan.PingResult) {
+		if r.Alive() {
+			aliveHosts++
+			report.AddPinged(r)
+			s.addResult(fmt.Sprintf("💚 Host %s: ALIVE", r.Host), "success")
+		}
 
-	for _, ip := range ips {
-		select {
-		case <-s.stopScanning:
-			s.addResult("⏹️ Scan stopped by user", "warning")
-			s.setScanning(false)
-			s.updateStatus("⏹️ Scan stopped")
-			return
-		default:
+		scannedIPs++
+		s.updateProgress(float64(scannedIPs) / float64(totalIPs))
+		if scannedIPs%10 == 0 {
+			s.updateStatus(fmt.Sprintf("🌐 Scanning... %d/%d hosts (%d alive) • %.0f probes/s", scannedIPs, totalIPs, aliveHosts, engine.Rate()))
 		}
+	})
 
-		wg.Add(1)
-		go func(ip string) {
-			defer wg.Done()
-			semaphore <- struct{}{}
-			defer func() { <-semaphore }()
+	if err == nil {
+		var found int
+		found, err = s.discover(ctx, engine, report, ips)
+		aliveHosts += found
+	}
+	if err == nil && s.osGuess {
+		err = s.guessOS(ctx, engine, report)
+	}
 
-			if s.pingHost(ip) {
-				s.mu.Lock()
-				aliveHosts++
-				s.mu.Unlock()
-				s.addResult(fmt.Sprintf("💚 Host %s: ALIVE", ip), "success")
+	s.reportRetries(engine)
+	report.Finish(scannedIPs, err != nil)
+	s.saveHistory(report)
+	if err != nil {
+		s.addResult(fmt.Sprintf("⏹️ Scan stopped by user after %d of %d hosts (%d alive)", scannedIPs, totalIPs, aliveHosts), "warning")
+		s.updateStatus("⏹️ Scan stopped")
+		return
+	}
+	s.addResult(fmt.Sprintf("🎉 Network scan complete! Found %d alive hosts out of %d scanned", aliveHosts, totalIPs), "info")
+	s.updateStatus(fmt.Sprintf("✅ Network scan complete. %d hosts found.", aliveHosts))
+}
+
+// discover asks the devices on the local network to describe themselves
+// with the discovery protocols turned on, adding what they say to report.
+// It returns how many hosts among targets turned up that had not answered
+// the sweep.
+func (s *Scanner) discover(ctx context.Context, engine *scan.Engine, report *scan.Report, targets []string) (int, error) {
+	wanted := make(map[string]bool, len(targets))
+	for _, ip := range targets {
+		wanted[ip] = true
+	}
+	known := make(map[string]bool, len(report.Hosts))
+	for _, h := range report.Hosts {
+		known[h.Address] = true
+	}
+	found := 0
+	merge := func(addr, how string) bool {
+		if !wanted[addr] {
+			return false
+		}
+		if !known[addr] {
+			known[addr] = true
+			found++
+			s.addResult(fmt.Sprintf("💚 Host %s: FOUND via %s", addr, how), "success")
+		}
+		return true
+	}
+
+	if s.mdns != "" {
+		report.Params = append(report.Params, scan.Param{Name: "mdns", Value: s.mdns})
+		s.updateStatus("📡 Browsing mDNS services...")
+		services, err := scan.BrowseMDNS(ctx, scan.MDNSDefaultWait, s.mdns == "passive", func(svc scan.MDNSService) {
+			s.addResult("📡 mDNS: "+svc.String(), "info")
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return found, err
 			}
+			s.addResult(fmt.Sprintf("❌ mDNS browse failed: %v", err), "error")
+		}
+		for _, svc := range services {
+			for _, addr := range svc.Addrs {
+				if merge(addr, "mDNS") {
+					report.AddMDNS(addr, svc)
+				}
+			}
+		}
+	}
 
-			s.mu.Lock()
-			scannedIPs++
-			progress := float64(scannedIPs) / float64(totalIPs)
-			s.updateProgress(progress)
-			if scannedIPs%10 == 0 {
-				s.updateStatus(fmt.Sprintf("🌐 Scanning... %d/%d hosts (%d alive)", scannedIPs, totalIPs, aliveHosts))
+	if s.ssdp {
+		report.Params = append(report.Params, scan.Param{Name: "ssdp", Value: "on"})
+		s.updateStatus("📺 Searching for UPnP devices...")
+		devices, err := scan.DiscoverSSDP(ctx, scan.SSDPDefaultWait, func(addr string, dev scan.UPnPDevice) {
+			s.addResult(fmt.Sprintf("📺 UPnP %s: %s", addr, dev), "info")
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return found, err
 			}
-			s.mu.Unlock()
-		}(ip)
+			s.addResult(fmt.Sprintf("❌ SSDP search failed: %v", err), "error")
+		}
+		for addr, devs := range devices {
+			if !merge(addr, "SSDP") {
+				continue
+			}
+			for _, dev := range devs {
+				report.AddUPnP(addr, dev)
+			}
+		}
 	}
 
-	wg.Wait()
-	s.setScanning(false)
-	s.addResult(fmt.Sprintf("🎉 Network scan complete! Found %d alive hosts out of %d scanned", aliveHosts, totalIPs), "info")
-	s.updateStatus(fmt.Sprintf("✅ Network scan complete. %d hosts found.", aliveHosts))
-}
+	if s.netbios {
+		report.Params = append(report.Params, scan.Param{Name: "netbios", Value: "on"})
+		s.updateStatus("🪟 Querying NetBIOS names...")
+		err := engine.NetBIOSSweep(ctx, targets, func(ip string, info scan.NetBIOSInfo) {
+			s.addResult(fmt.Sprintf("🪟 NetBIOS %s: %s", ip, info), "info")
+			merge(ip, "NetBIOS")
+			report.SetNetBIOS(ip, info)
+		})
+		if err != nil {
+			return found, err
+		}
 
-func (s *Scanner) pingHost(host string) bool {
-	pinger, err := ping.NewPinger(host)
-	if err != nil {
-		return false
+		s.updateStatus("🪟 Probing SMB...")
+		var live []string
+		for _, h := range report.Hosts {
+			live = append(live, h.Address)
+		}
+		err = engine.SMBSweep(ctx, live, func(ip string, info scan.SMBInfo) {
+			resultType := "info"
+			if info.SMBv1 {
+				resultType = "warning"
+			}
+			s.addResult(fmt.Sprintf("🗂️ SMB %s: %s", ip, info), resultType)
+			report.SetSMB(ip, info)
+		})
+		if err != nil {
+			return found, err
+		}
 	}
 
-	pinger.SetPrivileged(false)
-	pinger.Count = 1
-	pinger.Timeout = 1 * time.Second
+	if s.snmp != "" {
+		communities, err := scan.ReadCommunities(s.snmp)
+		if err == nil && len(communities) == 0 {
+			err = fmt.Errorf("no community strings given")
+		}
+		if err != nil {
+			s.addResult(fmt.Sprintf("❌ SNMP communities: %v", err), "error")
+			return found, nil
+		}
+		report.Params = append(report.Params, scan.Param{Name: "snmp", Value: strconv.Itoa(len(communities)) + " communities"})
+		s.updateStatus(fmt.Sprintf("🛰️ Trying %d SNMP community strings...", len(communities)))
+		var live []string
+		for _, h := range report.Hosts {
+			live = append(live, h.Address)
+		}
+		err = engine.SNMPSweep(ctx, live, communities, func(ip string, info scan.SNMPInfo) {
+			// A default community is as good as no password.
+			resultType := "info"
+			if slices.Contains(scan.DefaultCommunities, info.Community) {
+				resultType = "warning"
+			}
+			s.addResult(fmt.Sprintf("🛰️ SNMP %s: %s", ip, info), resultType)
+			for _, ifc := range info.Interfaces {
+				s.addResult(fmt.Sprintf("    ↳ if %s", ifc), "info")
+			}
+			report.SetSNMP(ip, info)
+		})
+		if err != nil {
+			return found, err
+		}
+	}
+	return found, nil
+}
 
-	err = pinger.Run()
+// guessOS probes the live hosts in report for the ports the OS rules look
+// for, reading their banners, and adds a guess at each host's operating
+// system to report. Rules in the configuration directory add to the
+// built-in ones.
+func (s *Scanner) guessOS(ctx context.Context, engine *scan.Engine, report *scan.Report) error {
+	path := scan.DefaultOSRulesPath()
+	if _, err := os.Stat(path); err != nil {
+		path = ""
+	}
+	rules, err := scan.LoadOSRules(path)
 	if err != nil {
-		return false
+		s.addResult(fmt.Sprintf("❌ OS rules: %v", err), "error")
+		return nil
+	}
+	report.Params = append(report.Params, scan.Param{Name: "os", Value: "on"})
+
+	ports := rules.Ports()
+	report.Params = append(report.Params, scan.PortParams(scan.FormatPorts(ports))...)
+	engine.Services = true
+	var live []string
+	for _, h := range report.Hosts {
+		live = append(live, h.Address)
+	}
+	for i, ip := range live {
+		s.updateStatus(fmt.Sprintf("🖥️ Probing OS ports on %s (%d/%d)...", ip, i+1, len(live)))
+		mode, err := engine.ScanPortList(ctx, ip, ports, func(p scan.Port, open bool) {
+			if !open {
+				return
+			}
+			report.AddPort(ip, p)
+			msg := fmt.Sprintf("✅ Host %s port %d: OPEN", ip, p.Number)
+			if p.Service != "" {
+				msg += " (" + p.Service + ")"
+			}
+			if p.Version != "" {
+				msg += " " + p.Version
+			}
+			s.addResult(msg, "success")
+		})
+		report.AddScanMode(mode)
+		if err != nil {
+			return err
+		}
 	}
 
-	stats := pinger.Statistics()
-	return stats.PacketsRecv > 0
+	s.updateStatus("🖥️ Guessing operating systems...")
+	return engine.OSSweep(ctx, report.Hosts, rules, func(ip string, g scan.OSGuess) {
+		s.addResult(fmt.Sprintf("🖥️ OS %s: %s", ip, g), "info")
+		report.SetOS(ip, g)
+	})
 }
 
-func (s *Scanner) pingNetwork(network string) {
+func (s *Scanner) pingNetwork(ctx context.Context, network string) {
+	defer s.setScanning(false)
 	s.clearResults()
-	s.setScanning(true)
 	s.updateStatus("🌐 Pinging network range...")
 	s.addResult(fmt.Sprintf("🌍 Starting ping sweep on %s", network), "info")
 
-	_, ipNet, err := net.ParseCIDR(network)
+	ips, err := scan.CIDRHosts(network)
 	if err != nil {
 		s.addResult(fmt.Sprintf("❌ Error parsing network: %v", err), "error")
-		s.setScanning(false)
 		return
 	}
 
-	var ips []string
-	for ip := ipNet.IP.Mask(ipNet.Mask); ipNet.Contains(ip); inc(ip) {
-		ips = append(ips, ip.String())
+	engine := s.newScanEngine()
+	if !s.checkICMP(engine) {
+		return
 	}
-
+	report := scan.NewReport("pingsweep", network, engine.Params()...)
 	totalIPs := len(ips)
 	scannedIPs := 0
 	aliveHosts := 0
 
-	var wg sync.WaitGroup
-	semaphore := make(chan struct{}, 50)
-
-	for _, ip := range ips {
-		select {
-		case <-s.stopScanning:
-			s.addResult("⏹️ Ping sweep stopped by user", "warning")
-			s.setScanning(false)
-			s.updateStatus("⏹️ Ping sweep stopped")
-			return
-		default:
+	err = engine.PingSweep(ctx, ips, func(r scan.PingResult) {
+		if r.Alive() {
+			aliveHosts++
+			report.AddPinged(r)
 		}
+		s.addPingResult(r)
 
-		wg.Add(1)
-		go func(ip string) {
-			defer wg.Done()
-			semaphore <- struct{}{}
-			defer func() { <-semaphore }()
-
-			if s.pingHost(ip) {
-				s.mu.Lock()
-				aliveHosts++
-				s.mu.Unlock()
-				s.addResult(fmt.Sprintf("🟢 %s: ALIVE (ping successful)", ip), "success")
-			} else {
-				s.addResult(fmt.Sprintf("🔴 %s: No response", ip), "error")
-			}
+		scannedIPs++
+		s.updateProgress(float64(scannedIPs) / float64(totalIPs))
+		if scannedIPs%5 == 0 {
+			s.updateStatus(fmt.Sprintf("🌐 Pinging... %d/%d hosts (%d responding) • %.0f probes/s", scannedIPs, totalIPs, aliveHosts, engine.Rate()))
+		}
+	})
 
-			s.mu.Lock()
-			scannedIPs++
-			progress := float64(scannedIPs) / float64(totalIPs)
-			s.updateProgress(progress)
-			if scannedIPs%5 == 0 {
-				s.updateStatus(fmt.Sprintf("🌐 Pinging... %d/%d hosts (%d responding)", scannedIPs, totalIPs, aliveHosts))
-			}
-			s.mu.Unlock()
-		}(ip)
+	s.reportRetries(engine)
+	report.Finish(scannedIPs, err != nil)
+	s.saveHistory(report)
+	if err != nil {
+		s.addResult(fmt.Sprintf("⏹️ Ping sweep stopped by user after %d of %d hosts (%d responding)", scannedIPs, totalIPs, aliveHosts), "warning")
+		s.updateStatus("⏹️ Ping sweep stopped")
+		return
 	}
-
-	wg.Wait()
-	s.setScanning(false)
 	s.addResult(fmt.Sprintf("🎉 Ping sweep complete! %d hosts responded out of %d pinged", aliveHosts, totalIPs), "info")
 	s.updateStatus(fmt.Sprintf("✅ Ping sweep complete. %d hosts responding.", aliveHosts))
 }
 
-func (s *Scanner) pingRange(rangeStr string) {
+func (s *Scanner) pingRange(ctx context.Context, rangeStr string) {
+	defer s.setScanning(false)
 	s.clearResults()
-	s.setScanning(true)
 	s.updateStatus("🎯 Pinging custom range...")
 	s.addResult(fmt.Sprintf("🎯 Starting ping sweep on range %s", rangeStr), "info")
 
@@ -405,7 +788,6 @@ func (s *Scanner) pingRange(rangeStr string) {
 	parts := strings.Split(rangeStr, "-")
 	if len(parts) != 2 {
 		s.addResult("❌ Error: Invalid range format. Use: IP1-IP2 (e.g., 192.168.1.1-192.168.1.50)", "error")
-		s.setScanning(false)
 		return
 	}
 
@@ -414,7 +796,6 @@ func (s *Scanner) pingRange(rangeStr string) {
 
 	if startIP == nil || endIP == nil {
 		s.addResult("❌ Error: Invalid IP addresses in range", "error")
-		s.setScanning(false)
 		return
 	}
 
@@ -428,7 +809,7 @@ func (s *Scanner) pingRange(rangeStr string) {
 		if current.Equal(endIP) {
 			break
 		}
-		inc(current)
+		scan.IncIP(current)
 		// Safety check to prevent infinite loops
 		if len(ips) > 1000 {
 			s.addResult("⚠️ Warning: Range too large (max 1000 IPs), truncating", "warning")
@@ -436,62 +817,850 @@ func (s *Scanner) pingRange(rangeStr string) {
 		}
 	}
 
+	engine := s.newScanEngine()
+	if !s.checkICMP(engine) {
+		return
+	}
+	report := scan.NewReport("pingsweep", rangeStr, engine.Params()...)
 	totalIPs := len(ips)
 	scannedIPs := 0
 	aliveHosts := 0
 
-	var wg sync.WaitGroup
-	semaphore := make(chan struct{}, 50)
+	err := engine.PingSweep(ctx, ips, func(r scan.PingResult) {
+		if r.Alive() {
+			aliveHosts++
+			report.AddPinged(r)
+		}
+		s.addPingResult(r)
+
+		scannedIPs++
+		s.updateProgress(float64(scannedIPs) / float64(totalIPs))
+		if scannedIPs%5 == 0 {
+			s.updateStatus(fmt.Sprintf("🎯 Range ping... %d/%d IPs (%d responding) • %.0f probes/s", scannedIPs, totalIPs, aliveHosts, engine.Rate()))
+		}
+	})
+
+	s.reportRetries(engine)
+	report.Finish(scannedIPs, err != nil)
+	s.saveHistory(report)
+	if err != nil {
+		s.addResult(fmt.Sprintf("⏹️ Range ping stopped by user after %d of %d IPs (%d responding)", scannedIPs, totalIPs, aliveHosts), "warning")
+		s.updateStatus("⏹️ Range ping stopped")
+		return
+	}
+	s.addResult(fmt.Sprintf("🎉 Range ping complete! %d hosts responded out of %d pinged", aliveHosts, totalIPs), "info")
+	s.updateStatus(fmt.Sprintf("✅ Range ping complete. %d hosts responding.", aliveHosts))
+}
+
+// addPingResult shows whether a host answered a ping and, if not, why.
+func (s *Scanner) addPingResult(r scan.PingResult) {
+	switch r.Status {
+	case scan.PingAlive:
+		s.addResult(fmt.Sprintf("🟢 %s: ALIVE (ping successful)", r.Host), "success")
+	case scan.PingTimeout:
+		s.addResult(fmt.Sprintf("🔴 %s: No response", r.Host), "error")
+	case scan.PingUnreachable:
+		s.addResult(fmt.Sprintf("🚫 %s: Unreachable (%s)", r.Host, r), "error")
+	case scan.PingResolve:
+		s.addResult(fmt.Sprintf("❓ %s: Unknown host (%s)", r.Host, r), "error")
+	case scan.PingDenied:
+		s.addResult(fmt.Sprintf("🔒 %s: Ping not permitted (%s)", r.Host, r), "error")
+	default:
+		s.addResult(fmt.Sprintf("⚠️ %s: Ping failed (%s)", r.Host, r), "warning")
+	}
+}
+
+// historyView is the History tab: past scans on the left and the selected
+// one on the right, with buttons to export it again.
+type historyView struct {
+	window   fyne.Window
+	reports  []*scan.Report
+	selected *scan.Report
+	list     *widget.List
+	details  *widget.Label
+}
 
-	for _, ip := range ips {
-		select {
-		case <-s.stopScanning:
-			s.addResult("⏹️ Range ping stopped by user", "warning")
-			s.setScanning(false)
-			s.updateStatus("⏹️ Range ping stopped")
+func newHistoryView(window fyne.Window) *historyView {
+	hv := &historyView{
+		window:  window,
+		details: widget.NewLabelWithStyle("Select a scan to see its results", fyne.TextAlignLeading, fyne.TextStyle{Monospace: true}),
+	}
+	hv.details.Wrapping = fyne.TextWrapWord
+
+	hv.list = widget.NewList(
+		func() int {
+			return len(hv.reports)
+		},
+		func() fyne.CanvasObject {
+			return widget.NewLabel("#0000 2006-01-02 15:04 portscan 255.255.255.255/32")
+		},
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			if i >= len(hv.reports) {
+				return
+			}
+			r := hv.reports[i]
+			o.(*widget.Label).SetText(fmt.Sprintf("#%d %s %s %s", r.ID, r.Started.Format("2006-01-02 15:04"), r.Command, r.Target))
+		},
+	)
+	hv.list.OnSelected = func(i widget.ListItemID) {
+		if i >= len(hv.reports) {
 			return
-		default:
 		}
+		hv.selected = hv.reports[i]
+		var b strings.Builder
+		scan.WriteReport(&b, hv.selected, "text")
+		hv.details.SetText(b.String())
+	}
 
-		wg.Add(1)
-		go func(ip string) {
-			defer wg.Done()
-			semaphore <- struct{}{}
-			defer func() { <-semaphore }()
+	return hv
+}
 
-			if s.pingHost(ip) {
-				s.mu.Lock()
-				aliveHosts++
-				s.mu.Unlock()
-				s.addResult(fmt.Sprintf("🟢 %s: ALIVE (ping successful)", ip), "success")
-			} else {
-				s.addResult(fmt.Sprintf("🔴 %s: No response", ip), "error")
+// refresh reloads the list of scans from the history database.
+func (hv *historyView) refresh() {
+	store, err := history.Open(history.DefaultPath())
+	if err != nil {
+		hv.details.SetText(fmt.Sprintf("❌ Could not open history: %v", err))
+		return
+	}
+	reports, err := store.List(500)
+	store.Close()
+	if err != nil {
+		hv.details.SetText(fmt.Sprintf("❌ Could not read history: %v", err))
+		return
+	}
+
+	hv.reports = reports
+	hv.selected = nil
+	hv.list.UnselectAll()
+	hv.list.Refresh()
+	hv.details.SetText(fmt.Sprintf("%d scans in history. Select one to see its results.", len(reports)))
+}
+
+// compare shows what changed between the selected scan and the run of the
+// same scan before it.
+func (hv *historyView) compare() {
+	r := hv.selected
+	if r == nil {
+		dialog.ShowInformation("Compare", "Select a scan first.", hv.window)
+		return
+	}
+	store, err := history.Open(history.DefaultPath())
+	if err != nil {
+		dialog.ShowError(err, hv.window)
+		return
+	}
+	prev, err := store.Previous(r)
+	store.Close()
+	if errors.Is(err, history.ErrNotFound) {
+		dialog.ShowInformation("Compare", fmt.Sprintf("Scan #%d has no earlier run to compare with.", r.ID), hv.window)
+		return
+	}
+	if err != nil {
+		dialog.ShowError(err, hv.window)
+		return
+	}
+
+	var b strings.Builder
+	scan.WriteDiff(&b, scan.Compare(prev, r), "text")
+	hv.details.SetText(b.String())
+}
+
+// export saves the selected scan in format through a file dialog.
+func (hv *historyView) export(format string) {
+	r := hv.selected
+	if r == nil {
+		dialog.ShowInformation("Export", "Select a scan first.", hv.window)
+		return
+	}
+	save := dialog.NewFileSave(func(w fyne.URIWriteCloser, err error) {
+		if err != nil || w == nil {
+			return
+		}
+		defer w.Close()
+		if err := scan.WriteReport(w, r, format); err != nil {
+			dialog.ShowError(err, hv.window)
+		}
+	}, hv.window)
+	save.SetFileName(fmt.Sprintf("scan-%d.%s", r.ID, format))
+	save.Show()
+}
+
+func (hv *historyView) content() fyne.CanvasObject {
+	buttons := container.NewHBox(
+		widget.NewButtonWithIcon("Refresh", theme.ViewRefreshIcon(), hv.refresh),
+		widget.NewButtonWithIcon("Compare with previous", theme.ViewRestoreIcon(), hv.compare),
+		widget.NewButtonWithIcon("JSON", theme.DocumentSaveIcon(), func() { hv.export("json") }),
+		widget.NewButtonWithIcon("XML", theme.DocumentSaveIcon(), func() { hv.export("xml") }),
+		widget.NewButtonWithIcon("CSV", theme.DocumentSaveIcon(), func() { hv.export("csv") }),
+	)
+	split := container.NewHSplit(hv.list, container.NewVScroll(hv.details))
+	split.Offset = 0.4
+	return container.NewBorder(buttons, nil, nil, nil, split)
+}
+
+// jobsView is the Schedule tab: the jobs the serve command runs, with a form
+// to add, change or remove them.
+type jobsView struct {
+	window   fyne.Window
+	path     string
+	jobs     []schedule.Job
+	selected int // index into jobs, -1 for a new job
+	list     *widget.List
+
+	name, target, ports, cron *widget.Entry
+	command, timing           *widget.Select
+	services, disabled        *widget.Check
+	status                    *widget.Label
+}
+
+func newJobsView(window fyne.Window) *jobsView {
+	jv := &jobsView{
+		window:   window,
+		path:     schedule.DefaultPath(),
+		selected: -1,
+		name:     widget.NewEntry(),
+		target:   widget.NewEntry(),
+		ports:    widget.NewEntry(),
+		cron:     widget.NewEntry(),
+		command:  widget.NewSelect([]string{"portscan", "netscan"}, nil),
+		timing:   widget.NewSelect(scan.ProfileNames(), nil),
+		services: widget.NewCheck("Detect services", nil),
+		disabled: widget.NewCheck("Disabled", nil),
+		status:   widget.NewLabel(""),
+	}
+	jv.name.SetPlaceHolder("office-lan")
+	jv.target.SetPlaceHolder("192.168.1.0/24 or a host for portscan")
+	jv.ports.SetPlaceHolder("22,80,443 or 1-1024")
+	jv.cron.SetPlaceHolder("*/30 * * * *, @hourly or @every 15m")
+	jv.status.Wrapping = fyne.TextWrapWord
+
+	jv.list = widget.NewList(
+		func() int {
+			return len(jv.jobs)
+		},
+		func() fyne.CanvasObject {
+			return widget.NewLabel("office-lan netscan 255.255.255.255/32 */30 * * * *")
+		},
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			if i >= len(jv.jobs) {
+				return
+			}
+			j := jv.jobs[i]
+			text := fmt.Sprintf("%s  %s %s  [%s]", j.Name, j.Command, j.Target, j.Schedule)
+			if j.Disabled {
+				text += " (disabled)"
 			}
+			o.(*widget.Label).SetText(text)
+		},
+	)
+	jv.list.OnSelected = func(i widget.ListItemID) {
+		if i >= len(jv.jobs) {
+			return
+		}
+		jv.edit(i)
+	}
+
+	return jv
+}
+
+// refresh reloads the jobs file.
+func (jv *jobsView) refresh() {
+	jobs, err := schedule.LoadJobs(jv.path)
+	if err != nil {
+		jv.status.SetText(fmt.Sprintf("❌ %v", err))
+		return
+	}
+	jv.jobs = jobs
+	jv.list.UnselectAll()
+	jv.list.Refresh()
+	jv.clear()
+	jv.status.SetText(fmt.Sprintf("%d jobs in %s. Run \"network-scanner-cli serve\" to run them on schedule.", len(jobs), jv.path))
+}
+
+// clear empties the form for a new job.
+func (jv *jobsView) clear() {
+	jv.selected = -1
+	jv.name.SetText("")
+	jv.target.SetText("")
+	jv.ports.SetText("")
+	jv.cron.SetText("@hourly")
+	jv.command.SetSelected("netscan")
+	jv.timing.SetSelected(scan.DefaultTiming.Name)
+	jv.services.SetChecked(false)
+	jv.disabled.SetChecked(false)
+}
 
-			s.mu.Lock()
-			scannedIPs++
-			progress := float64(scannedIPs) / float64(totalIPs)
-			s.updateProgress(progress)
-			if scannedIPs%5 == 0 {
-				s.updateStatus(fmt.Sprintf("🎯 Range ping... %d/%d IPs (%d responding)", scannedIPs, totalIPs, aliveHosts))
+// edit fills the form with job i.
+func (jv *jobsView) edit(i int) {
+	j := jv.jobs[i]
+	jv.selected = i
+	jv.name.SetText(j.Name)
+	jv.target.SetText(j.Target)
+	jv.ports.SetText(j.Ports)
+	jv.cron.SetText(j.Schedule)
+	jv.command.SetSelected(j.Command)
+	timing := j.Timing
+	if timing == "" {
+		timing = scan.DefaultTiming.Name
+	}
+	jv.timing.SetSelected(timing)
+	jv.services.SetChecked(j.Services)
+	jv.disabled.SetChecked(j.Disabled)
+
+	if c, err := schedule.ParseCron(j.Schedule); err == nil && !j.Disabled {
+		jv.status.SetText(fmt.Sprintf("Next run: %s", c.Next(time.Now()).Format("2006-01-02 15:04")))
+	} else {
+		jv.status.SetText("")
+	}
+}
+
+// save stores the form as a new job or over the selected one.
+func (jv *jobsView) save() {
+	j := schedule.Job{
+		Name: strings.TrimSpace(jv.name.Text),
+		Spec: scan.Spec{
+			Command: jv.command.Selected,
+			Target:  strings.TrimSpace(jv.target.Text),
+			Ports:   strings.TrimSpace(jv.ports.Text),
+		},
+		Schedule: strings.TrimSpace(jv.cron.Text),
+		Timing:   jv.timing.Selected,
+		Services: jv.services.Checked,
+		Disabled: jv.disabled.Checked,
+	}
+	if err := j.Validate(); err != nil {
+		dialog.ShowError(err, jv.window)
+		return
+	}
+	jobs := append([]schedule.Job(nil), jv.jobs...)
+	for i, other := range jobs {
+		if other.Name == j.Name && i != jv.selected {
+			dialog.ShowError(fmt.Errorf("there is already a job called %q", j.Name), jv.window)
+			return
+		}
+	}
+	if jv.selected >= 0 {
+		jobs[jv.selected] = j
+	} else {
+		jobs = append(jobs, j)
+	}
+	if err := schedule.SaveJobs(jv.path, jobs); err != nil {
+		dialog.ShowError(err, jv.window)
+		return
+	}
+	jv.refresh()
+	jv.status.SetText(fmt.Sprintf("✅ Saved job %s", j.Name))
+}
+
+// remove deletes the selected job after asking.
+func (jv *jobsView) remove() {
+	if jv.selected < 0 {
+		dialog.ShowInformation("Delete", "Select a job first.", jv.window)
+		return
+	}
+	name := jv.jobs[jv.selected].Name
+	dialog.ShowConfirm("Delete job", fmt.Sprintf("Delete the job %q?", name), func(ok bool) {
+		if !ok {
+			return
+		}
+		jobs := append([]schedule.Job(nil), jv.jobs[:jv.selected]...)
+		jobs = append(jobs, jv.jobs[jv.selected+1:]...)
+		if err := schedule.SaveJobs(jv.path, jobs); err != nil {
+			dialog.ShowError(err, jv.window)
+			return
+		}
+		jv.refresh()
+	}, jv.window)
+}
+
+func (jv *jobsView) content() fyne.CanvasObject {
+	buttons := container.NewHBox(
+		widget.NewButtonWithIcon("Refresh", theme.ViewRefreshIcon(), jv.refresh),
+		widget.NewButtonWithIcon("New", theme.ContentAddIcon(), func() {
+			jv.list.UnselectAll()
+			jv.clear()
+		}),
+	)
+	form := widget.NewForm(
+		widget.NewFormItem("Name", jv.name),
+		widget.NewFormItem("Scan", jv.command),
+		widget.NewFormItem("Target", jv.target),
+		widget.NewFormItem("Ports", jv.ports),
+		widget.NewFormItem("Schedule", jv.cron),
+		widget.NewFormItem("Timing", jv.timing),
+		widget.NewFormItem("", container.NewHBox(jv.services, jv.disabled)),
+	)
+	editor := container.NewVBox(
+		form,
+		container.NewHBox(
+			widget.NewButtonWithIcon("Save", theme.DocumentSaveIcon(), jv.save),
+			widget.NewButtonWithIcon("Delete", theme.DeleteIcon(), jv.remove),
+		),
+		jv.status,
+	)
+	split := container.NewHSplit(jv.list, container.NewVScroll(editor))
+	split.Offset = 0.4
+	return container.NewBorder(buttons, nil, nil, nil, split)
+}
+
+// dashboardWindow is how many recent echoes a dashboard tile charts and
+// works out the loss over.
+const dashboardWindow = 60
+
+// dashboardFile is the layout of the file the pinned hosts are kept in.
+type dashboardFile struct {
+	Interval string   `yaml:"interval"`
+	Hosts    []string `yaml:"hosts"`
+}
+
+// dashboardPath is where the dashboard's pinned hosts are kept.
+func dashboardPath() string {
+	return filepath.Join(filepath.Dir(schedule.DefaultPath()), "dashboard.yaml")
+}
+
+// dashboardView watches pinned hosts continuously, a tile per host with its
+// status, a sparkline of recent round-trip times and the loss over them.
+type dashboardView struct {
+	scanner   *Scanner
+	path      string
+	interval  time.Duration
+	tiles     []*hostTile
+	grid      *fyne.Container
+	host      *widget.Entry
+	intervals *widget.Select
+	status    *widget.Label
+}
+
+func newDashboardView(scanner *Scanner) *dashboardView {
+	dv := &dashboardView{
+		scanner:  scanner,
+		path:     dashboardPath(),
+		interval: 2 * time.Second,
+		grid:     container.NewGridWrap(fyne.NewSize(260, 130)),
+		host:     widget.NewEntry(),
+		status:   widget.NewLabel(""),
+	}
+	dv.host.SetPlaceHolder("Gateway, DNS server, switch...")
+	dv.host.OnSubmitted = func(string) { dv.add() }
+	dv.intervals = widget.NewSelect([]string{"1s", "2s", "5s", "10s", "30s", "1m0s"}, func(text string) {
+		interval, err := time.ParseDuration(text)
+		if err != nil || interval == dv.interval {
+			return
+		}
+		dv.interval = interval
+		for _, t := range dv.tiles {
+			dv.start(t)
+		}
+		dv.save()
+	})
+	return dv
+}
+
+// load pins the hosts saved in the dashboard file and starts watching them.
+func (dv *dashboardView) load() {
+	data, err := os.ReadFile(dv.path)
+	if errors.Is(err, os.ErrNotExist) {
+		dv.intervals.SetSelected(dv.interval.String())
+		return
+	}
+	var f dashboardFile
+	if err == nil {
+		err = yaml.Unmarshal(data, &f)
+	}
+	if err != nil {
+		dv.status.SetText(fmt.Sprintf("❌ %s: %v", dv.path, err))
+		return
+	}
+	if interval, err := time.ParseDuration(f.Interval); err == nil && interval > 0 {
+		dv.interval = interval
+	}
+	dv.intervals.SetSelected(dv.interval.String())
+	for _, host := range f.Hosts {
+		dv.pin(host)
+	}
+}
+
+// save writes the pinned hosts and the interval to the dashboard file.
+func (dv *dashboardView) save() {
+	f := dashboardFile{Interval: dv.interval.String()}
+	for _, t := range dv.tiles {
+		f.Hosts = append(f.Hosts, t.host)
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	err := enc.Encode(f)
+	if err == nil {
+		if err = os.MkdirAll(filepath.Dir(dv.path), 0o755); err == nil {
+			err = os.WriteFile(dv.path, buf.Bytes(), 0o644)
+		}
+	}
+	if err != nil {
+		dv.status.SetText(fmt.Sprintf("❌ Could not save the dashboard: %v", err))
+		return
+	}
+	dv.status.SetText(fmt.Sprintf("%d hosts pinned, pinged every %s.", len(dv.tiles), dv.interval))
+}
+
+// add pins the host typed into the entry.
+func (dv *dashboardView) add() {
+	host := strings.TrimSpace(dv.host.Text)
+	if host == "" {
+		return
+	}
+	for _, t := range dv.tiles {
+		if t.host == host {
+			dv.status.SetText(fmt.Sprintf("%s is already pinned.", host))
+			return
+		}
+	}
+	dv.host.SetText("")
+	dv.pin(host)
+	dv.save()
+}
+
+func (dv *dashboardView) pin(host string) {
+	t := newHostTile(host)
+	t.remove = func() {
+		t.stop()
+		for i, other := range dv.tiles {
+			if other == t {
+				dv.tiles = append(dv.tiles[:i], dv.tiles[i+1:]...)
+				break
 			}
-			s.mu.Unlock()
-		}(ip)
+		}
+		dv.grid.Remove(t.object)
+		dv.save()
 	}
+	dv.tiles = append(dv.tiles, t)
+	dv.grid.Add(t.object)
+	dv.start(t)
+}
 
-	wg.Wait()
-	s.setScanning(false)
-	s.addResult(fmt.Sprintf("🎉 Range ping complete! %d hosts responded out of %d pinged", aliveHosts, totalIPs), "info")
-	s.updateStatus(fmt.Sprintf("✅ Range ping complete. %d hosts responding.", aliveHosts))
+// start (re)starts the background pinger of t at the current interval. A
+// pinger that fails, for example because the name does not resolve, tries
+// again a little later.
+func (dv *dashboardView) start(t *hostTile) {
+	t.stop()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.mu.Lock()
+	t.cancel = cancel
+	t.mu.Unlock()
+	interval := dv.interval
+
+	go func() {
+		for {
+			_, err := dv.scanner.newEngine().PingSeries(ctx, t.host, 0, interval, t.add)
+			if ctx.Err() != nil {
+				return
+			}
+			t.fail(err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(max(interval, 10*time.Second)):
+			}
+		}
+	}()
 }
 
-func inc(ip net.IP) {
-	for j := len(ip) - 1; j >= 0; j-- {
-		ip[j]++
-		if ip[j] > 0 {
-			break
+// stopAll stops every pinger, when the application quits.
+func (dv *dashboardView) stopAll() {
+	for _, t := range dv.tiles {
+		t.stop()
+	}
+}
+
+func (dv *dashboardView) content() fyne.CanvasObject {
+	addBtn := widget.NewButtonWithIcon("Pin", theme.ContentAddIcon(), dv.add)
+	top := container.NewVBox(
+		container.NewBorder(nil, nil, widget.NewLabelWithStyle("Host:", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+			container.NewHBox(addBtn, widget.NewLabelWithStyle("Interval:", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}), dv.intervals),
+			dv.host),
+		dv.status,
+	)
+	return container.NewVBox(top, dv.grid)
+}
+
+// hostTile shows how one pinned host is doing.
+type hostTile struct {
+	host   string
+	object fyne.CanvasObject
+	remove func()
+
+	chart *latencyChart
+	bg    *canvas.Rectangle
+	rtt   *widget.Label
+	loss  *widget.Label
+
+	mu       sync.Mutex
+	answered []bool // the last dashboardWindow echoes
+	cancel   context.CancelFunc
+}
+
+var (
+	tileUp      = color.RGBA{212, 237, 218, 255} // Light green
+	tileLossy   = color.RGBA{255, 243, 205, 255} // Light yellow
+	tileDown    = color.RGBA{248, 215, 218, 255} // Light red
+	tileWaiting = color.RGBA{233, 236, 239, 255} // Light gray
+)
+
+func newHostTile(host string) *hostTile {
+	t := &hostTile{
+		host:  host,
+		chart: newLatencyChart(dashboardWindow),
+		bg:    canvas.NewRectangle(tileWaiting),
+		rtt:   widget.NewLabel("⏳ waiting"),
+		loss:  widget.NewLabel(""),
+	}
+	t.bg.StrokeColor = color.RGBA{230, 230, 230, 255}
+	t.bg.StrokeWidth = 1
+	removeBtn := widget.NewButtonWithIcon("", theme.CancelIcon(), func() { t.remove() })
+	removeBtn.Importance = widget.LowImportance
+
+	t.object = container.NewStack(t.bg, container.NewPadded(container.NewBorder(
+		container.NewBorder(nil, nil, nil, removeBtn,
+			widget.NewLabelWithStyle(host, fyne.TextAlignLeading, fyne.TextStyle{Bold: true})),
+		container.NewHBox(t.rtt, layout.NewSpacer(), t.loss),
+		nil, nil,
+		t.chart,
+	)))
+	return t
+}
+
+// add records an echo. The tile is red when the last three echoes were
+// lost, yellow when any in the window was, and green otherwise.
+func (t *hostTile) add(e scan.Echo) {
+	t.mu.Lock()
+	t.answered = append(t.answered, !e.Lost)
+	if len(t.answered) > dashboardWindow {
+		t.answered = t.answered[len(t.answered)-dashboardWindow:]
+	}
+	lost, streak := 0, 0
+	for _, ok := range t.answered {
+		if ok {
+			streak = 0
+		} else {
+			lost++
+			streak++
 		}
 	}
+	t.mu.Unlock()
+
+	t.chart.Add(e.RTT, e.Lost)
+	if e.Lost {
+		t.rtt.SetText("❌ timeout")
+	} else {
+		t.rtt.SetText(fmt.Sprintf("%.1f ms", float64(e.RTT)/float64(time.Millisecond)))
+	}
+	t.loss.SetText(fmt.Sprintf("%.0f%% loss", 100*float64(lost)/float64(len(t.answered))))
+	switch {
+	case streak >= 3 || lost == len(t.answered):
+		t.bg.FillColor = tileDown
+	case lost > 0:
+		t.bg.FillColor = tileLossy
+	default:
+		t.bg.FillColor = tileUp
+	}
+	t.bg.Refresh()
+}
+
+// fail shows why the host cannot be pinged at all.
+func (t *hostTile) fail(err error) {
+	t.rtt.SetText("❌ " + err.Error())
+	t.loss.SetText("")
+	t.bg.FillColor = tileDown
+	t.bg.Refresh()
+}
+
+func (t *hostTile) stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.cancel != nil {
+		t.cancel()
+		t.cancel = nil
+	}
+}
+
+// latencyChart plots the most recent round-trip times to a host as a line,
+// newest on the right, with lost echoes as red ticks along the bottom.
+type latencyChart struct {
+	widget.BaseWidget
+
+	mu      sync.Mutex
+	samples []latencySample
+	size    int // samples kept
+}
+
+type latencySample struct {
+	rtt  time.Duration
+	lost bool
+}
+
+func newLatencyChart(size int) *latencyChart {
+	c := &latencyChart{size: size}
+	c.ExtendBaseWidget(c)
+	return c
+}
+
+// Add appends an echo to the chart, dropping the oldest once it is full.
+func (c *latencyChart) Add(rtt time.Duration, lost bool) {
+	c.mu.Lock()
+	c.samples = append(c.samples, latencySample{rtt, lost})
+	if len(c.samples) > c.size {
+		c.samples = c.samples[len(c.samples)-c.size:]
+	}
+	c.mu.Unlock()
+	c.Refresh()
+}
+
+func (c *latencyChart) CreateRenderer() fyne.WidgetRenderer {
+	bg := canvas.NewRectangle(color.RGBA{255, 255, 255, 255})
+	bg.StrokeColor = color.RGBA{230, 230, 230, 255}
+	bg.StrokeWidth = 1
+	peak := canvas.NewText("", color.RGBA{108, 117, 125, 255})
+	peak.TextSize = 10
+	return &latencyChartRenderer{chart: c, bg: bg, peak: peak}
+}
+
+type latencyChartRenderer struct {
+	chart   *latencyChart
+	bg      *canvas.Rectangle
+	peak    *canvas.Text // scale of the chart
+	size    fyne.Size
+	objects []fyne.CanvasObject
+}
+
+func (r *latencyChartRenderer) Layout(size fyne.Size) {
+	r.size = size
+	r.draw()
+}
+
+func (r *latencyChartRenderer) MinSize() fyne.Size {
+	return fyne.NewSize(120, 40)
+}
+
+func (r *latencyChartRenderer) Refresh() {
+	r.draw()
+	canvas.Refresh(r.chart)
+}
+
+func (r *latencyChartRenderer) Objects() []fyne.CanvasObject {
+	return r.objects
+}
+
+func (r *latencyChartRenderer) Destroy() {}
+
+// draw rebuilds the line from the chart's samples, scaled so the slowest
+// reply reaches the top.
+func (r *latencyChartRenderer) draw() {
+	r.chart.mu.Lock()
+	samples := append([]latencySample(nil), r.chart.samples...)
+	size := r.chart.size
+	r.chart.mu.Unlock()
+
+	r.bg.Resize(r.size)
+	r.objects = []fyne.CanvasObject{r.bg}
+	if len(samples) == 0 || size < 2 {
+		return
+	}
+
+	peak := time.Millisecond
+	for _, s := range samples {
+		if !s.lost && s.rtt > peak {
+			peak = s.rtt
+		}
+	}
+	const pad = 4
+	w, h := r.size.Width-2*pad, r.size.Height-2*pad
+	step := w / float32(size-1)
+	point := func(i int) fyne.Position {
+		x := pad + w - float32(len(samples)-1-i)*step
+		y := pad + h - h*float32(samples[i].rtt)/float32(peak)
+		return fyne.NewPos(x, y)
+	}
+
+	lineColor := color.RGBA{0, 123, 255, 255}
+	lostColor := color.RGBA{220, 53, 69, 255}
+	for i, s := range samples {
+		if s.lost {
+			tick := canvas.NewLine(lostColor)
+			tick.StrokeWidth = 2
+			x := point(i).X
+			tick.Position1 = fyne.NewPos(x, pad+h-8)
+			tick.Position2 = fyne.NewPos(x, pad+h)
+			r.objects = append(r.objects, tick)
+			continue
+		}
+		if i == 0 || samples[i-1].lost {
+			continue
+		}
+		line := canvas.NewLine(lineColor)
+		line.StrokeWidth = 1.5
+		line.Position1, line.Position2 = point(i-1), point(i)
+		r.objects = append(r.objects, line)
+	}
+
+	r.peak.Text = fmt.Sprintf("%.1f ms", float64(peak)/float64(time.Millisecond))
+	r.peak.Move(fyne.NewPos(pad, pad/2))
+	r.peak.Resize(r.peak.MinSize())
+	r.objects = append(r.objects, r.peak)
+}
+
+// openPingMonitor pings host without end in a window of its own, charting
+// every round-trip time and keeping the statistics up to date, until Stop
+// is pressed or the window is closed.
+func (s *Scanner) openPingMonitor(a fyne.App, host string) {
+	w := a.NewWindow("📈 Ping Monitor - " + host)
+	ctx, cancel := context.WithCancel(context.Background())
+	w.SetOnClosed(cancel)
+
+	chart := newLatencyChart(120)
+	last := widget.NewLabel("⏳ Waiting for the first reply...")
+	summary := widget.NewLabelWithStyle("", fyne.TextAlignLeading, fyne.TextStyle{Monospace: true})
+
+	var stopBtn *widget.Button
+	stopBtn = widget.NewButtonWithIcon("Stop", theme.MediaStopIcon(), func() {
+		cancel()
+		stopBtn.Disable()
+	})
+
+	w.SetContent(container.NewPadded(container.NewBorder(
+		container.NewHBox(last, layout.NewSpacer(), stopBtn),
+		summary, nil, nil,
+		chart,
+	)))
+	w.Resize(fyne.NewSize(560, 320))
+	w.Show()
+
+	go func() {
+		var stats scan.PingStats
+		_, err := s.newEngine().PingSeries(ctx, host, 0, time.Second, func(e scan.Echo) {
+			stats.Add(e)
+			chart.Add(e.RTT, e.Lost)
+			if e.Lost {
+				last.SetText(fmt.Sprintf("❌ Request timeout for seq=%d", e.Seq))
+			} else {
+				last.SetText(fmt.Sprintf("✅ Reply from %s: seq=%d ttl=%d time=%.3f ms", e.Addr, e.Seq, e.TTL, float64(e.RTT)/float64(time.Millisecond)))
+			}
+			summary.SetText(pingSummary(stats))
+		})
+		if err != nil && ctx.Err() == nil {
+			last.SetText(fmt.Sprintf("❌ Ping failed: %v", err))
+		}
+		stopBtn.Disable()
+	}()
+}
+
+// pingSummary formats the statistics of a ping series like ping(8) does.
+func pingSummary(stats scan.PingStats) string {
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	text := fmt.Sprintf("%d sent, %d received, %.1f%% loss", stats.Sent, stats.Received, stats.Loss*100)
+	if stats.Up() {
+		text += fmt.Sprintf("\nrtt min/avg/max/stddev = %.3f/%.3f/%.3f/%.3f ms, jitter %.3f ms",
+			ms(stats.Min), ms(stats.Avg), ms(stats.Max), ms(stats.StdDev), ms(stats.Jitter))
+	}
+	return text
 }
 
 // Create beautiful card with gradient background
@@ -602,12 +1771,93 @@ func main() {
 		endPortEntry.SetText("65535")
 	})
 
+	// Timing profile and adaptive timeouts
+	timingSelect := widget.NewSelect(scan.ProfileNames(), func(name string) {
+		timing, err := scan.ProfileByName(name)
+		if err != nil {
+			return
+		}
+		timing.Adaptive = scanner.timing.Adaptive
+		scanner.timing = timing
+	})
+	timingSelect.SetSelected(scanner.timing.Name)
+
+	adaptiveCheck := widget.NewCheck("Adaptive timeouts", func(on bool) {
+		scanner.timing.Adaptive = on
+	})
+
+	retrySelect := widget.NewSelect([]string{"Profile", "0", "1", "2", "3", "5"}, func(value string) {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			n = -1
+		}
+		scanner.retries = n
+	})
+	retrySelect.SetSelected("Profile")
+
+	servicesCheck := widget.NewCheck("Detect services", func(on bool) {
+		scanner.services = on
+	})
+
+	privilegedCheck := widget.NewCheck("Raw ICMP (privileged)", func(on bool) {
+		scanner.privileged = on
+	})
+
+	maxRateEntry := widget.NewEntry()
+	maxRateEntry.SetPlaceHolder("Unlimited")
+	maxRateEntry.OnChanged = func(text string) {
+		rate, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+		if err != nil || rate < 0 {
+			rate = 0
+		}
+		scanner.maxRate = rate
+	}
+
+	mdnsSelect := widget.NewSelect([]string{"Off", "Active", "Passive"}, func(mode string) {
+		if mode == "Off" {
+			mode = ""
+		}
+		scanner.mdns = strings.ToLower(mode)
+	})
+	mdnsSelect.SetSelected("Off")
+
+	ssdpCheck := widget.NewCheck("SSDP/UPnP", func(on bool) {
+		scanner.ssdp = on
+	})
+
+	netbiosCheck := widget.NewCheck("NetBIOS/SMB", func(on bool) {
+		scanner.netbios = on
+	})
+
+	snmpEntry := widget.NewEntry()
+	snmpEntry.SetText(strings.Join(scan.DefaultCommunities, ","))
+	snmpEntry.Disable()
+	snmpEntry.OnChanged = func(text string) {
+		scanner.snmp = strings.TrimSpace(text)
+	}
+	snmpCheck := widget.NewCheck("SNMP, communities:", func(on bool) {
+		if on {
+			snmpEntry.Enable()
+			scanner.snmp = strings.TrimSpace(snmpEntry.Text)
+		} else {
+			snmpEntry.Disable()
+			scanner.snmp = ""
+		}
+	})
+
+	osCheck := widget.NewCheck("Guess OS", func(on bool) {
+		scanner.osGuess = on
+	})
+
+	traceMethodSelect := widget.NewSelect([]string{scan.TraceUDP, scan.TraceICMP, scan.TraceTCP}, nil)
+	traceMethodSelect.SetSelected(scan.TraceUDP)
+
 	// Enhanced buttons with better styling
-	var portScanBtn, networkScanBtn, pingRangeBtn *widget.Button
+	var portScanBtn, networkScanBtn, pingRangeBtn, traceBtn *widget.Button
 
 	portScanBtn = widget.NewButtonWithIcon("🔍 Port Scan", theme.SearchIcon(), func() {
-		if scanner.isScanning {
-			scanner.stopScanning <- true
+		if scanner.scanning() {
+			scanner.stopScan()
 			return
 		}
 
@@ -625,19 +1875,19 @@ func main() {
 			return
 		}
 
-		if startPort > endPort || startPort < 1 || endPort > 65535 {
-			scanner.addResult("❌ Error: Invalid port range (1-65535)", "error")
+		if err := scan.CheckPortRange(startPort, endPort); err != nil {
+			scanner.addResult("❌ Error: "+err.Error(), "error")
 			return
 		}
 
-		scanner.scanningBtn = portScanBtn
-		go scanner.scanPorts(host, startPort, endPort)
+		ctx := scanner.beginScan(portScanBtn)
+		go scanner.scanPorts(ctx, host, startPort, endPort)
 	})
 	portScanBtn.Importance = widget.MediumImportance
 
 	networkScanBtn = widget.NewButtonWithIcon("🌐 Network Discovery", theme.ViewRefreshIcon(), func() {
-		if scanner.isScanning {
-			scanner.stopScanning <- true
+		if scanner.scanning() {
+			scanner.stopScan()
 			return
 		}
 
@@ -647,15 +1897,15 @@ func main() {
 			return
 		}
 
-		scanner.scanningBtn = networkScanBtn
-		go scanner.scanNetwork(network)
+		ctx := scanner.beginScan(networkScanBtn)
+		go scanner.scanNetwork(ctx, network)
 	})
 	networkScanBtn.Importance = widget.MediumImportance
 
 	// New ping range button
 	pingRangeBtn = widget.NewButtonWithIcon("🌍 Ping Range", theme.RadioButtonIcon(), func() {
-		if scanner.isScanning {
-			scanner.stopScanning <- true
+		if scanner.scanning() {
+			scanner.stopScan()
 			return
 		}
 
@@ -663,11 +1913,11 @@ func main() {
 		network := strings.TrimSpace(networkEntry.Text)
 
 		if customRange != "" {
-			scanner.scanningBtn = pingRangeBtn
-			go scanner.pingRange(customRange)
+			ctx := scanner.beginScan(pingRangeBtn)
+			go scanner.pingRange(ctx, customRange)
 		} else if network != "" {
-			scanner.scanningBtn = pingRangeBtn
-			go scanner.pingNetwork(network)
+			ctx := scanner.beginScan(pingRangeBtn)
+			go scanner.pingNetwork(ctx, network)
 		} else {
 			scanner.addResult("❌ Error: Please enter a network or custom range", "error")
 		}
@@ -683,16 +1933,39 @@ func main() {
 
 		go func() {
 			scanner.updateStatus("🏓 Pinging host...")
-			if scanner.pingHost(host) {
-				scanner.addResult(fmt.Sprintf("✅ Host %s: ALIVE", host), "success")
-			} else {
-				scanner.addResult(fmt.Sprintf("❌ Host %s: NOT REACHABLE", host), "error")
-			}
+			scanner.addPingResult(scanner.newEngine().PingHost(context.Background(), host))
 			scanner.updateStatus("🚀 Ready to scan networks")
 		}()
 	})
 	pingBtn.Importance = widget.LowImportance
 
+	monitorBtn := widget.NewButtonWithIcon("📈 Ping Monitor", theme.VisibilityIcon(), func() {
+		host := strings.TrimSpace(hostEntry.Text)
+		if host == "" {
+			scanner.addResult("❌ Error: Please enter a host", "error")
+			return
+		}
+		scanner.openPingMonitor(myApp, host)
+	})
+	monitorBtn.Importance = widget.LowImportance
+
+	traceBtn = widget.NewButtonWithIcon("🧭 Traceroute", theme.NavigateNextIcon(), func() {
+		if scanner.scanning() {
+			scanner.stopScan()
+			return
+		}
+
+		host := strings.TrimSpace(hostEntry.Text)
+		if host == "" {
+			scanner.addResult("❌ Error: Please enter a host", "error")
+			return
+		}
+
+		ctx := scanner.beginScan(traceBtn)
+		go scanner.traceroute(ctx, host, traceMethodSelect.Selected)
+	})
+	traceBtn.Importance = widget.MediumImportance
+
 	clearBtn := widget.NewButtonWithIcon("🧹 Clear Results", theme.DeleteIcon(), func() {
 		scanner.clearResults()
 		scanner.updateStatus("✨ Results cleared - Ready to scan")
@@ -700,13 +1973,33 @@ func main() {
 	})
 	clearBtn.Importance = widget.LowImportance
 
+	pauseBtn := widget.NewButtonWithIcon("⏸️ Pause", theme.MediaPauseIcon(), func() {
+		scanner.togglePause()
+	})
+	pauseBtn.Importance = widget.LowImportance
+	pauseBtn.Disable()
+	scanner.pauseBtn = pauseBtn
+
 	// Create styled cards
 	targetCard := createStyledCard("🎯 Target Configuration", theme.ComputerIcon(), container.NewVBox(
 		widget.NewLabelWithStyle("Host/IP Address:", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
-		hostEntry,
+		container.NewBorder(nil, nil, nil, container.NewHBox(
+			widget.NewLabelWithStyle("Traceroute via:", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+			traceMethodSelect,
+		), hostEntry),
 		widget.NewSeparator(),
 		widget.NewLabelWithStyle("Network (CIDR):", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
 		container.NewHBox(networkEntry, preset192, preset10, preset172),
+		container.NewHBox(
+			widget.NewLabelWithStyle("Network Discovery also asks:", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+			widget.NewLabel("mDNS"),
+			mdnsSelect,
+			ssdpCheck,
+			netbiosCheck,
+			snmpCheck,
+			snmpEntry,
+			osCheck,
+		),
 		widget.NewSeparator(),
 		widget.NewLabelWithStyle("Custom IP Range:", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
 		customRangeEntry,
@@ -725,6 +2018,18 @@ func main() {
 			allPortsBtn,
 		),
 		widget.NewSeparator(),
+		container.NewHBox(
+			widget.NewLabelWithStyle("Timing:", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+			timingSelect,
+			adaptiveCheck,
+			widget.NewLabelWithStyle("Retries:", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+			retrySelect,
+			widget.NewLabelWithStyle("Max rate (probes/s):", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+			maxRateEntry,
+			servicesCheck,
+			privilegedCheck,
+		),
+		widget.NewSeparator(),
 		widget.NewLabelWithStyle("💡 Common ports: 21(FTP), 22(SSH), 23(Telnet), 25(SMTP), 53(DNS), 80(HTTP), 110(POP3), 443(HTTPS), 993(IMAPS), 995(POP3S)", fyne.TextAlignLeading, fyne.TextStyle{Italic: true}),
 	))
 
@@ -732,9 +2037,11 @@ func main() {
 		portScanBtn,
 		networkScanBtn,
 		pingRangeBtn,
+		traceBtn,
 		pingBtn,
+		monitorBtn,
 		clearBtn,
-		widget.NewLabel(""), // Empty space
+		pauseBtn,
 	))
 
 	statusCard := createStyledCard("📊 Status & Progress", theme.InfoIcon(), container.NewVBox(
@@ -754,9 +2061,26 @@ func main() {
 		statusCard,
 	)
 
+	historyTab := newHistoryView(myWindow)
+	historyTab.refresh()
+	scanner.onHistorySaved = historyTab.refresh
+	historyCard := createStyledCard("🗄️ Scan History", theme.HistoryIcon(), historyTab.content())
+
+	jobsTab := newJobsView(myWindow)
+	jobsTab.refresh()
+	scheduleCard := createStyledCard("⏰ Scheduled Scans", theme.HistoryIcon(), jobsTab.content())
+
+	dashboardTab := newDashboardView(scanner)
+	dashboardTab.load()
+	myWindow.SetOnClosed(dashboardTab.stopAll)
+	dashboardCard := createStyledCard("📡 Latency Dashboard", theme.ComputerIcon(), dashboardTab.content())
+
 	tabs := container.NewAppTabs(
 		container.NewTabItemWithIcon("⚙️ Scanner", theme.SettingsIcon(), inputTab),
 		container.NewTabItemWithIcon("📊 Results", theme.DocumentIcon(), resultsCard),
+		container.NewTabItemWithIcon("🗄️ History", theme.HistoryIcon(), historyCard),
+		container.NewTabItemWithIcon("⏰ Schedule", theme.HistoryIcon(), scheduleCard),
+		container.NewTabItemWithIcon("📡 Dashboard", theme.ComputerIcon(), container.NewVScroll(dashboardCard)),
 	)
 
 	// Main layout with beautiful header
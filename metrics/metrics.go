@@ -0,0 +1,324 @@
+// Package metrics watches hosts and records scan results for a Prometheus
+// scrape endpoint, so dashboards can chart the health of a network.
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"network-scanner/scan"
+)
+
+// Monitor pings a set of targets on an interval, optionally counting open
+// ports on each host, and serves the latest samples together with the
+// results of recorded scans in the Prometheus text format.
+type Monitor struct {
+	Targets  []string      // hosts or CIDR networks, as added with AddTarget
+	Ports    []int         // TCP ports to check on every host, none if empty
+	Interval time.Duration // time between rounds
+	Count    int           // ICMP echoes per host per round
+	Timing   scan.Timing
+	Log      *log.Logger
+
+	watched []watched // every host of every target
+
+	mu         sync.Mutex
+	hosts      map[string]hostSample
+	round      time.Duration // how long the last round took
+	roundAt    time.Time     // when the last round finished
+	scans      map[string]scanSample
+	scansTotal map[[2]string]int // by command and outcome
+}
+
+// watched is one host the monitor pings, with the target it came from.
+type watched struct{ address, target string }
+
+type hostSample struct {
+	target    string
+	ping      scan.PingStats
+	pingErr   bool
+	openPorts int
+	duration  time.Duration
+}
+
+func (h hostSample) up() bool {
+	return h.ping.Up() || h.openPorts > 0
+}
+
+type scanSample struct {
+	job       string
+	command   string
+	target    string
+	duration  time.Duration
+	hosts     int
+	openPorts int
+	finished  time.Time
+}
+
+// AddTarget adds a host or CIDR network to the targets. Networks are
+// expanded here, once; one too large to sweep is an error, as for netscan.
+func (m *Monitor) AddTarget(target string) error {
+	addresses := []string{target}
+	if strings.Contains(target, "/") {
+		var err error
+		if addresses, err = scan.CIDRHosts(target); err != nil {
+			return err
+		}
+	}
+	m.Targets = append(m.Targets, target)
+	for _, a := range addresses {
+		m.watched = append(m.watched, watched{a, target})
+	}
+	return nil
+}
+
+// Run probes the targets straight away and then every Interval until ctx
+// is cancelled.
+func (m *Monitor) Run(ctx context.Context) {
+	if m.Interval <= 0 {
+		m.Interval = time.Minute
+	}
+	if m.Count < 1 {
+		m.Count = 3
+	}
+	if m.Log == nil {
+		m.Log = log.New(os.Stderr, "", log.LstdFlags)
+	}
+
+	for {
+		m.probe(ctx)
+		t := time.NewTimer(m.Interval)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// probe runs one round over every host of every target.
+func (m *Monitor) probe(ctx context.Context) {
+	start := time.Now()
+	engine := scan.NewEngine(m.Timing)
+	if _, err := engine.ICMPMode(); err != nil {
+		// Hosts are still counted up by their open ports.
+		m.Log.Printf("monitor: %v", err)
+	}
+
+	samples := make(map[string]hostSample, len(m.watched))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, engine.Timing.Concurrency)
+	for _, h := range m.watched {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(h watched) {
+			defer func() { <-slots; wg.Done() }()
+			began := time.Now()
+			s := hostSample{target: h.target}
+			var err error
+			s.ping, err = engine.PingCount(ctx, h.address, m.Count, 200*time.Millisecond)
+			s.pingErr = err != nil
+			if len(m.Ports) > 0 {
+				engine.ScanPortList(ctx, h.address, m.Ports, func(p scan.Port, open bool) {
+					if open {
+						s.openPorts++
+					}
+				})
+			}
+			s.duration = time.Since(began)
+			mu.Lock()
+			samples[h.address] = s
+			mu.Unlock()
+		}(h)
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return
+	}
+
+	m.mu.Lock()
+	m.hosts = samples
+	m.round = time.Since(start)
+	m.roundAt = time.Now()
+	m.mu.Unlock()
+}
+
+// RecordScan keeps the outcome of a finished scan. Scans are told apart by
+// job name, or by command and target when name is empty.
+func (m *Monitor) RecordScan(name string, r *scan.Report) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.scans == nil {
+		m.scans = map[string]scanSample{}
+		m.scansTotal = map[[2]string]int{}
+	}
+
+	outcome := "completed"
+	if r.Interrupted {
+		outcome = "interrupted"
+	}
+	m.scansTotal[[2]string{r.Command, outcome}]++
+	if r.Interrupted {
+		return
+	}
+	key := name
+	if key == "" {
+		key = r.Command + " " + r.Target
+	}
+	m.scans[key] = scanSample{
+		job:       name,
+		command:   r.Command,
+		target:    r.Target,
+		duration:  r.Finished.Sub(r.Started),
+		hosts:     len(r.Hosts),
+		openPorts: r.OpenPorts(),
+		finished:  r.Finished,
+	}
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format.
+func (m *Monitor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format.
+func (m *Monitor) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+	addresses := make([]string, 0, len(m.hosts))
+	for a := range m.hosts {
+		addresses = append(addresses, a)
+	}
+	sort.Strings(addresses)
+
+	hostLabels := func(a string) []string {
+		return []string{"host", a, "target", m.hosts[a].target}
+	}
+	var up, loss, rtt, open, duration []sample
+	for _, a := range addresses {
+		h := m.hosts[a]
+		up = append(up, sample{hostLabels(a), boolValue(h.up())})
+		duration = append(duration, sample{hostLabels(a), h.duration.Seconds()})
+		if !h.pingErr && h.ping.Sent > 0 {
+			loss = append(loss, sample{hostLabels(a), h.ping.Loss})
+		}
+		if h.ping.Up() {
+			for _, stat := range []struct {
+				name string
+				d    time.Duration
+			}{{"min", h.ping.Min}, {"avg", h.ping.Avg}, {"max", h.ping.Max}, {"stddev", h.ping.StdDev}} {
+				rtt = append(rtt, sample{append(hostLabels(a), "stat", stat.name), stat.d.Seconds()})
+			}
+		}
+		if len(m.Ports) > 0 {
+			open = append(open, sample{hostLabels(a), float64(h.openPorts)})
+		}
+	}
+	writeFamily(&b, "netscan_up", "gauge", "Whether the host answered an ICMP echo or has an open monitored port.", up)
+	writeFamily(&b, "netscan_icmp_rtt_seconds", "gauge", "ICMP round-trip time in the last round.", rtt)
+	writeFamily(&b, "netscan_icmp_packet_loss_ratio", "gauge", "Fraction of ICMP echoes left unanswered in the last round.", loss)
+	writeFamily(&b, "netscan_open_ports", "gauge", "Monitored TCP ports found open in the last round.", open)
+	writeFamily(&b, "netscan_probe_duration_seconds", "gauge", "Time spent probing the host in the last round.", duration)
+	if !m.roundAt.IsZero() {
+		writeFamily(&b, "netscan_monitor_round_duration_seconds", "gauge", "How long the last monitoring round took.", []sample{{nil, m.round.Seconds()}})
+		writeFamily(&b, "netscan_monitor_last_round_timestamp_seconds", "gauge", "When the last monitoring round finished.", []sample{{nil, unixSeconds(m.roundAt)}})
+	}
+
+	keys := make([]string, 0, len(m.scans))
+	for k := range m.scans {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var scanDuration, scanHosts, scanOpen, scanAt []sample
+	for _, k := range keys {
+		s := m.scans[k]
+		labels := []string{"scan_job", s.job, "command", s.command, "target", s.target}
+		scanDuration = append(scanDuration, sample{labels, s.duration.Seconds()})
+		scanHosts = append(scanHosts, sample{labels, float64(s.hosts)})
+		scanOpen = append(scanOpen, sample{labels, float64(s.openPorts)})
+		scanAt = append(scanAt, sample{labels, unixSeconds(s.finished)})
+	}
+	writeFamily(&b, "netscan_scan_duration_seconds", "gauge", "How long the last completed scan took.", scanDuration)
+	writeFamily(&b, "netscan_scan_hosts", "gauge", "Hosts that answered in the last completed scan.", scanHosts)
+	writeFamily(&b, "netscan_scan_open_ports", "gauge", "Open ports found by the last completed scan.", scanOpen)
+	writeFamily(&b, "netscan_scan_last_timestamp_seconds", "gauge", "When the last completed scan finished.", scanAt)
+
+	totals := make([][2]string, 0, len(m.scansTotal))
+	for k := range m.scansTotal {
+		totals = append(totals, k)
+	}
+	sort.Slice(totals, func(i, j int) bool {
+		return totals[i][0]+totals[i][1] < totals[j][0]+totals[j][1]
+	})
+	var counts []sample
+	for _, k := range totals {
+		counts = append(counts, sample{[]string{"command", k[0], "outcome", k[1]}, float64(m.scansTotal[k])})
+	}
+	writeFamily(&b, "netscan_scans_total", "counter", "Scans run since the server started.", counts)
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// sample is one value with its labels as name, value pairs.
+type sample struct {
+	labels []string
+	value  float64
+}
+
+func writeFamily(b *strings.Builder, name, typ, help string, samples []sample) {
+	if len(samples) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	for _, s := range samples {
+		b.WriteString(name)
+		if len(s.labels) > 0 {
+			b.WriteByte('{')
+			for i := 0; i+1 < len(s.labels); i += 2 {
+				if i > 0 {
+					b.WriteByte(',')
+				}
+				fmt.Fprintf(b, "%s=\"%s\"", s.labels[i], labelEscaper.Replace(s.labels[i+1]))
+			}
+			b.WriteByte('}')
+		}
+		b.WriteByte(' ')
+		b.WriteString(strconv.FormatFloat(s.value, 'g', -1, 64))
+		b.WriteByte('\n')
+	}
+}
+
+// labelEscaper escapes label values as the text format requires.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func unixSeconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / 1e9
+}
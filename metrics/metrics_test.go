@@ -0,0 +1,98 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"network-scanner/scan"
+)
+
+// finished builds a finished report of command on target that took d.
+func finished(command, target string, d time.Duration, interrupted bool, hosts map[string][]int) *scan.Report {
+	r := scan.NewReport(command, target)
+	for addr, ports := range hosts {
+		r.AddHost(addr)
+		for _, n := range ports {
+			r.AddPort(addr, scan.Port{Number: n, Protocol: "tcp", State: "open"})
+		}
+	}
+	r.Finish(256, interrupted)
+	r.Started = r.Finished.Add(-d)
+	return r
+}
+
+func TestWriteTo(t *testing.T) {
+	var m Monitor
+	m.RecordScan("", finished("netscan", "10.0.0.0/24", 90*time.Second, false, map[string][]int{"10.0.0.1": {22, 443}, "10.0.0.2": nil}))
+	m.RecordScan(`nightly "core"`+"\n"+`\dc`, finished("portscan", "10.0.0.1", 2*time.Second, false, map[string][]int{"10.0.0.1": {22}}))
+	m.RecordScan("", finished("netscan", "10.0.1.0/24", time.Second, true, nil))
+
+	var alive, lost, failed scan.PingStats
+	lost.Add(scan.Echo{Lost: true})
+	alive.Add(scan.Echo{RTT: 3 * time.Millisecond})
+	m.hosts = map[string]hostSample{
+		"10.0.0.1": {target: "10.0.0.0/24", ping: alive, duration: time.Second},
+		"10.0.0.2": {target: "10.0.0.0/24", ping: lost, duration: time.Second},
+		"10.0.0.3": {target: "10.0.0.0/24", ping: failed, pingErr: true, duration: time.Second},
+	}
+
+	var b strings.Builder
+	if _, err := m.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	for _, line := range []string{
+		"# TYPE netscan_up gauge",
+		`netscan_up{host="10.0.0.1",target="10.0.0.0/24"} 1`,
+		`netscan_up{host="10.0.0.2",target="10.0.0.0/24"} 0`,
+		`netscan_icmp_rtt_seconds{host="10.0.0.1",target="10.0.0.0/24",stat="avg"} 0.003`,
+		`netscan_icmp_packet_loss_ratio{host="10.0.0.2",target="10.0.0.0/24"} 1`,
+		`netscan_scan_duration_seconds{scan_job="",command="netscan",target="10.0.0.0/24"} 90`,
+		`netscan_scan_hosts{scan_job="",command="netscan",target="10.0.0.0/24"} 2`,
+		`netscan_scan_open_ports{scan_job="",command="netscan",target="10.0.0.0/24"} 2`,
+		`netscan_scan_open_ports{scan_job="nightly \"core\"\n\\dc",command="portscan",target="10.0.0.1"} 1`,
+		"# TYPE netscan_scans_total counter",
+		`netscan_scans_total{command="netscan",outcome="completed"} 1`,
+		`netscan_scans_total{command="netscan",outcome="interrupted"} 1`,
+		`netscan_scans_total{command="portscan",outcome="completed"} 1`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("output lacks %s", line)
+		}
+	}
+
+	// Round-trip times only for hosts that answered, loss only for hosts
+	// that could be pinged, and no port counts without monitored ports.
+	for _, absent := range []string{
+		`netscan_icmp_rtt_seconds{host="10.0.0.2"`,
+		`netscan_icmp_rtt_seconds{host="10.0.0.3"`,
+		`netscan_icmp_packet_loss_ratio{host="10.0.0.3"`,
+		"netscan_open_ports",
+		"10.0.1.0/24",
+	} {
+		if strings.Contains(out, absent) {
+			t.Errorf("output has %s", absent)
+		}
+	}
+	if t.Failed() {
+		t.Logf("output:\n%s", out)
+	}
+}
+
+func TestAddTarget(t *testing.T) {
+	var m Monitor
+	for _, target := range []string{"10.0.0.5", "192.168.1.0/30"} {
+		if err := m.AddTarget(target); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(m.Targets) != 2 || len(m.watched) != 5 || m.watched[4] != (watched{"192.168.1.3", "192.168.1.0/30"}) {
+		t.Errorf("targets %v watching %v, want the host and the network's four addresses", m.Targets, m.watched)
+	}
+	for _, target := range []string{"10.0.0.0/8", "2001:db8::/64", "10.0.0.0/33"} {
+		if err := m.AddTarget(target); err == nil {
+			t.Errorf("AddTarget(%s) succeeded", target)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"network-scanner/scan"
+)
+
+// SignatureHeader carries the HMAC-SHA256 of a webhook body, as
+// "sha256=<hex>", when the channel has a secret.
+const SignatureHeader = "X-Netscan-Signature"
+
+// Alert is what a channel sends: the scan and what it found. It is the JSON
+// body of a webhook and the data for a channel template.
+type Alert struct {
+	Scan     scan.DiffSide `json:"scan"`
+	Finished time.Time     `json:"finished"`
+	Findings []Finding     `json:"findings"`
+	Test     bool          `json:"test,omitempty"` // sent by notify-test
+}
+
+// NewAlert builds the alert for findings in r.
+func NewAlert(r *scan.Report, findings []Finding) Alert {
+	return Alert{
+		Scan:     scan.DiffSide{ID: r.ID, Command: r.Command, Target: r.Target, Started: r.Started},
+		Finished: r.Finished,
+		Findings: findings,
+	}
+}
+
+// Title is a one-line summary of the alert.
+func (a Alert) Title() string {
+	noun := "findings"
+	if len(a.Findings) == 1 {
+		noun = "finding"
+	}
+	title := fmt.Sprintf("Network scanner: %d %s in %s %s", len(a.Findings), noun, a.Scan.Command, a.Scan.Target)
+	if a.Test {
+		title = "[test] " + title
+	}
+	return title
+}
+
+// Text is the alert as plain text, one finding per line.
+func (a Alert) Text() string {
+	var b strings.Builder
+	b.WriteString(a.Title())
+	b.WriteString("\n")
+	for _, f := range a.Findings {
+		b.WriteString("• " + f.String() + "\n")
+	}
+	return b.String()
+}
+
+// Channel is somewhere alerts go.
+type Channel struct {
+	Name string `yaml:"name"`
+	// Type is webhook (the Alert as JSON), slack, teams or email.
+	Type string `yaml:"type"`
+	URL  string `yaml:"url"`
+	// Secret, for HTTP channels, signs each body with HMAC-SHA256 in the
+	// X-Netscan-Signature header.
+	Secret string `yaml:"secret"`
+	// Template, for HTTP channels, is a text/template producing the body
+	// instead of the built-in one. It gets the Alert; the json function
+	// quotes a value as JSON.
+	Template string   `yaml:"template"`
+	To       []string `yaml:"to"` // email recipients
+
+	tmpl *template.Template
+}
+
+// SMTP is the mail server email channels send through.
+type SMTP struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"` // 587 if zero
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	From     string `yaml:"from"`
+}
+
+var templateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+func (ch *Channel) validate(server *SMTP) error {
+	switch ch.Type {
+	case "webhook", "slack", "teams":
+		if !strings.HasPrefix(ch.URL, "http://") && !strings.HasPrefix(ch.URL, "https://") {
+			return fmt.Errorf("url must be an http or https URL")
+		}
+	case "email":
+		if len(ch.To) == 0 {
+			return fmt.Errorf("email needs at least one address in to")
+		}
+		if server == nil || server.Host == "" || server.From == "" {
+			return fmt.Errorf("email needs an smtp section with host and from")
+		}
+	default:
+		return fmt.Errorf("unknown type %q (want webhook, slack, teams or email)", ch.Type)
+	}
+	if ch.Template != "" {
+		t, err := template.New(ch.Name).Funcs(templateFuncs).Parse(ch.Template)
+		if err != nil {
+			return err
+		}
+		ch.tmpl = t
+	}
+	return nil
+}
+
+// Send delivers alert. Alerts without findings are not sent.
+func (ch *Channel) Send(ctx context.Context, server *SMTP, alert Alert) error {
+	if len(alert.Findings) == 0 {
+		return nil
+	}
+	if ch.Type == "email" {
+		return ch.sendMail(server, alert)
+	}
+	body, err := ch.body(alert)
+	if err != nil {
+		return err
+	}
+	return ch.post(ctx, body)
+}
+
+// body renders the HTTP body for alert.
+func (ch *Channel) body(alert Alert) ([]byte, error) {
+	if ch.tmpl != nil {
+		var b bytes.Buffer
+		if err := ch.tmpl.Execute(&b, alert); err != nil {
+			return nil, err
+		}
+		return b.Bytes(), nil
+	}
+	switch ch.Type {
+	case "slack":
+		return json.Marshal(map[string]string{"text": alert.Text()})
+	case "teams":
+		facts := make([]map[string]string, len(alert.Findings))
+		for i, f := range alert.Findings {
+			facts[i] = map[string]string{"name": f.Kind, "value": f.String()}
+		}
+		return json.Marshal(map[string]any{
+			"@type":      "MessageCard",
+			"@context":   "https://schema.org/extensions",
+			"summary":    alert.Title(),
+			"title":      alert.Title(),
+			"themeColor": "D9534F",
+			"sections":   []any{map[string]any{"facts": facts}},
+		})
+	}
+	return json.Marshal(alert)
+}
+
+func (ch *Channel) post(ctx context.Context, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ch.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "network-scanner")
+	if ch.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(ch.Secret, body))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s answered %s", ch.URL, resp.Status)
+	}
+	return nil
+}
+
+// Sign returns the signature header value for body: "sha256=" and the hex
+// HMAC-SHA256 of body keyed with secret. Receivers compute the same and
+// compare with hmac.Equal.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (ch *Channel) sendMail(server *SMTP, alert Alert) error {
+	port := server.Port
+	if port == 0 {
+		port = 587
+	}
+	addr := net.JoinHostPort(server.Host, strconv.Itoa(port))
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", server.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(ch.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", alert.Title())
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(alert.Text(), "\n", "\r\n"))
+
+	var auth smtp.Auth
+	if server.Username != "" {
+		auth = smtp.PlainAuth("", server.Username, server.Password, server.Host)
+	}
+	return smtp.SendMail(addr, auth, server.From, ch.To, []byte(msg.String()))
+}
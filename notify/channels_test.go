@@ -0,0 +1,192 @@
+package notify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"network-scanner/scan"
+)
+
+// hook is a stand-in HTTP endpoint that records what it is sent.
+type hook struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	bodies   [][]byte
+	requests []*http.Request
+}
+
+func newHook(t *testing.T, status int) *hook {
+	t.Helper()
+	h := &hook{}
+	h.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		h.mu.Lock()
+		h.bodies = append(h.bodies, body)
+		h.requests = append(h.requests, r)
+		h.mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(h.Close)
+	return h
+}
+
+func (h *hook) count() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.bodies)
+}
+
+// only returns the one request the hook got.
+func (h *hook) only(t *testing.T) (*http.Request, []byte) {
+	t.Helper()
+	if n := h.count(); n != 1 {
+		t.Fatalf("hook got %d requests, want 1", n)
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.requests[0], h.bodies[0]
+}
+
+func testAlert() Alert {
+	r := scan.NewReport("netscan", "10.0.0.0/24")
+	r.Finish(256, false)
+	return NewAlert(r, []Finding{
+		{Kind: NewHost, Address: "10.0.0.7"},
+		{Kind: NewPort, Address: "10.0.0.7", Port: 22, Service: "ssh"},
+	})
+}
+
+func testChannel(t *testing.T, ch Channel) *Channel {
+	t.Helper()
+	if ch.Name == "" {
+		ch.Name = ch.Type
+	}
+	if err := ch.validate(nil); err != nil {
+		t.Fatal(err)
+	}
+	return &ch
+}
+
+func TestWebhookSignature(t *testing.T) {
+	h := newHook(t, http.StatusOK)
+	ch := testChannel(t, Channel{Type: "webhook", URL: h.URL, Secret: "s3cret"})
+	if err := ch.Send(context.Background(), nil, testAlert()); err != nil {
+		t.Fatal(err)
+	}
+	req, body := h.only(t)
+
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(body)
+	if got, want := req.Header.Get(SignatureHeader), "sha256="+hex.EncodeToString(mac.Sum(nil)); got != want {
+		t.Errorf("%s = %q, want %q", SignatureHeader, got, want)
+	}
+	if ct := req.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type %q, want application/json", ct)
+	}
+	var alert Alert
+	if err := json.Unmarshal(body, &alert); err != nil {
+		t.Fatal(err)
+	}
+	if alert.Scan.Command != "netscan" || len(alert.Findings) != 2 || alert.Findings[1].Port != 22 {
+		t.Errorf("webhook body %s, want the alert as JSON", body)
+	}
+}
+
+func TestWebhookUnsigned(t *testing.T) {
+	h := newHook(t, http.StatusOK)
+	ch := testChannel(t, Channel{Type: "webhook", URL: h.URL})
+	if err := ch.Send(context.Background(), nil, testAlert()); err != nil {
+		t.Fatal(err)
+	}
+	if req, _ := h.only(t); req.Header.Get(SignatureHeader) != "" {
+		t.Errorf("signed without a secret: %q", req.Header.Get(SignatureHeader))
+	}
+}
+
+func TestSlackPayload(t *testing.T) {
+	h := newHook(t, http.StatusOK)
+	ch := testChannel(t, Channel{Type: "slack", URL: h.URL})
+	if err := ch.Send(context.Background(), nil, testAlert()); err != nil {
+		t.Fatal(err)
+	}
+	_, body := h.only(t)
+	var msg map[string]string
+	if err := json.Unmarshal(body, &msg); err != nil {
+		t.Fatal(err)
+	}
+	want := "Network scanner: 2 findings in netscan 10.0.0.0/24\n• New host 10.0.0.7\n• New open port 10.0.0.7 22/tcp (ssh)\n"
+	if len(msg) != 1 || msg["text"] != want {
+		t.Errorf("slack body %s, want only text %q", body, want)
+	}
+}
+
+func TestTeamsPayload(t *testing.T) {
+	h := newHook(t, http.StatusOK)
+	ch := testChannel(t, Channel{Type: "teams", URL: h.URL})
+	if err := ch.Send(context.Background(), nil, testAlert()); err != nil {
+		t.Fatal(err)
+	}
+	_, body := h.only(t)
+	var card struct {
+		Type     string `json:"@type"`
+		Title    string `json:"title"`
+		Sections []struct {
+			Facts []struct{ Name, Value string }
+		}
+	}
+	if err := json.Unmarshal(body, &card); err != nil {
+		t.Fatal(err)
+	}
+	if card.Type != "MessageCard" || !strings.HasPrefix(card.Title, "Network scanner: 2 findings") {
+		t.Errorf("teams card %s, want a MessageCard titled with the alert", body)
+	}
+	if len(card.Sections) != 1 || len(card.Sections[0].Facts) != 2 ||
+		card.Sections[0].Facts[1].Name != NewPort || card.Sections[0].Facts[1].Value != "New open port 10.0.0.7 22/tcp (ssh)" {
+		t.Errorf("teams card %s, want one fact per finding", body)
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	h := newHook(t, http.StatusOK)
+	ch := testChannel(t, Channel{Type: "webhook", URL: h.URL, Secret: "k",
+		Template: `{"title": {{json .Title}}, "count": {{len .Findings}}}`})
+	if err := ch.Send(context.Background(), nil, testAlert()); err != nil {
+		t.Fatal(err)
+	}
+	req, body := h.only(t)
+	if want := `{"title": "Network scanner: 2 findings in netscan 10.0.0.0/24", "count": 2}`; string(body) != want {
+		t.Errorf("templated body %s, want %s", body, want)
+	}
+	if req.Header.Get(SignatureHeader) != Sign("k", body) {
+		t.Errorf("templated body not signed as sent")
+	}
+}
+
+func TestSendFailures(t *testing.T) {
+	h := newHook(t, http.StatusInternalServerError)
+	ch := testChannel(t, Channel{Type: "slack", URL: h.URL})
+	if err := ch.Send(context.Background(), nil, testAlert()); err == nil || !strings.Contains(err.Error(), "500") {
+		t.Errorf("Send to a failing endpoint: %v, want the status", err)
+	}
+
+	// Nothing is sent for an alert without findings.
+	empty := newHook(t, http.StatusOK)
+	ch = testChannel(t, Channel{Type: "webhook", URL: empty.URL})
+	if err := ch.Send(context.Background(), nil, Alert{Finished: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if empty.count() != 0 {
+		t.Errorf("empty alert was sent")
+	}
+}
@@ -0,0 +1,298 @@
+// Package notify sends alerts about what a scan found: new hosts, newly
+// opened ports and certificates close to expiry. Alerts go to webhooks,
+// chat services or email according to rules in a YAML file.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"network-scanner/scan"
+)
+
+// Kinds of finding. They double as the severities rules filter on.
+const (
+	NewHost    = "new-host"
+	NewPort    = "new-port"
+	CertExpiry = "cert-expiry"
+)
+
+var kinds = []string{NewHost, NewPort, CertExpiry}
+
+// Finding is one thing worth telling someone about.
+type Finding struct {
+	Kind    string     `json:"kind"`
+	Address string     `json:"address"`
+	Port    int        `json:"port,omitempty"`
+	Service string     `json:"service,omitempty"`
+	Expires *time.Time `json:"expires,omitempty"` // for cert-expiry
+}
+
+func (f Finding) String() string {
+	switch f.Kind {
+	case NewHost:
+		return "New host " + f.Address
+	case NewPort:
+		s := fmt.Sprintf("New open port %s %d/tcp", f.Address, f.Port)
+		if f.Service != "" {
+			s += " (" + f.Service + ")"
+		}
+		return s
+	case CertExpiry:
+		days := int(time.Until(*f.Expires).Hours() / 24)
+		if days < 0 {
+			return fmt.Sprintf("Certificate on %s port %d expired on %s", f.Address, f.Port, f.Expires.Format("2006-01-02"))
+		}
+		return fmt.Sprintf("Certificate on %s port %d expires in %d days (%s)", f.Address, f.Port, days, f.Expires.Format("2006-01-02"))
+	}
+	return f.Kind + " " + f.Address
+}
+
+// Config is the notifications file.
+//
+//	smtp:
+//	  host: smtp.example.com
+//	  port: 587
+//	  from: scanner@example.com
+//	channels:
+//	  - name: ops
+//	    type: slack
+//	    url: https://hooks.slack.com/services/...
+//	  - name: siem
+//	    type: webhook
+//	    url: https://siem.example.com/hook
+//	    secret: s3cret
+//	rules:
+//	  - events: [new-host, new-port]
+//	    channels: [ops, siem]
+//	  - events: [cert-expiry]
+//	    cert_expiry_days: 21
+//	    channels: [ops]
+type Config struct {
+	SMTP     *SMTP     `yaml:"smtp"`
+	Channels []Channel `yaml:"channels"`
+	Rules    []Rule    `yaml:"rules"`
+}
+
+// Rule sends findings of the listed kinds to the listed channels.
+type Rule struct {
+	Events   []string `yaml:"events"`
+	Channels []string `yaml:"channels"`
+	// CertExpiryDays is how close to expiry a certificate must be for a
+	// cert-expiry finding; 30 if zero.
+	CertExpiryDays int `yaml:"cert_expiry_days"`
+	// Targets limits the rule to scans of these targets; all if empty.
+	Targets []string `yaml:"targets"`
+}
+
+// DefaultPath is where the CLI, GUI and serve command look for the
+// notifications file unless told otherwise.
+func DefaultPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = "."
+	}
+	return filepath.Join(dir, "network-scanner", "notify.yaml")
+}
+
+// Load reads and checks the notifications file at path.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Config
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&c); err != nil {
+		return nil, fmt.Errorf("notifications %s: %w", path, err)
+	}
+	if err := c.validate(); err != nil {
+		return nil, fmt.Errorf("notifications %s: %w", path, err)
+	}
+	return &c, nil
+}
+
+func (c *Config) validate() error {
+	names := map[string]bool{}
+	for i := range c.Channels {
+		ch := &c.Channels[i]
+		if ch.Name == "" {
+			return fmt.Errorf("channel %d has no name", i+1)
+		}
+		if names[ch.Name] {
+			return fmt.Errorf("duplicate channel %q", ch.Name)
+		}
+		names[ch.Name] = true
+		if err := ch.validate(c.SMTP); err != nil {
+			return fmt.Errorf("channel %s: %w", ch.Name, err)
+		}
+	}
+	for i, r := range c.Rules {
+		if len(r.Events) == 0 || len(r.Channels) == 0 {
+			return fmt.Errorf("rule %d needs events and channels", i+1)
+		}
+		for _, e := range r.Events {
+			if !contains(kinds, e) {
+				return fmt.Errorf("rule %d: unknown event %q (want %s)", i+1, e, strings.Join(kinds, ", "))
+			}
+		}
+		for _, name := range r.Channels {
+			if !names[name] {
+				return fmt.Errorf("rule %d: no channel called %q", i+1, name)
+			}
+		}
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Findings works out what is new in cur. prev is the previous run of the
+// same scan; without one, only certificates are judged, since every host
+// would otherwise count as new. Certificates are reported when they expire
+// within days and, if prev had the same port, they did not already there.
+func Findings(prev, cur *scan.Report, days int) []Finding {
+	var findings []Finding
+	if prev != nil {
+		d := scan.Compare(prev, cur)
+		for _, h := range d.NewHosts {
+			findings = append(findings, Finding{Kind: NewHost, Address: h})
+		}
+		for _, c := range d.Opened {
+			findings = append(findings, Finding{Kind: NewPort, Address: c.Address, Port: c.Port, Service: c.Service})
+		}
+	}
+
+	deadline := cur.Finished.AddDate(0, 0, days)
+	if cur.Finished.IsZero() {
+		deadline = time.Now().AddDate(0, 0, days)
+	}
+	for _, h := range cur.Hosts {
+		for _, p := range h.Ports {
+			if p.CertExpires == nil || p.CertExpires.After(deadline) {
+				continue
+			}
+			if old := findPort(prev, h.Address, p.Number); old != nil && old.CertExpires != nil &&
+				old.CertExpires.Equal(*p.CertExpires) && !old.CertExpires.After(prev.Finished.AddDate(0, 0, days)) {
+				continue // already reported after the previous run
+			}
+			findings = append(findings, Finding{Kind: CertExpiry, Address: h.Address, Port: p.Number, Service: p.Service, Expires: p.CertExpires})
+		}
+	}
+	return findings
+}
+
+func findPort(r *scan.Report, address string, port int) *scan.Port {
+	if r == nil {
+		return nil
+	}
+	for _, h := range r.Hosts {
+		if h.Address != address {
+			continue
+		}
+		for i := range h.Ports {
+			if h.Ports[i].Number == port {
+				return &h.Ports[i]
+			}
+		}
+	}
+	return nil
+}
+
+// Notify sends what is new in cur compared with prev (which may be nil)
+// through every matching rule. It tries every channel and returns the
+// errors of those that failed.
+func (c *Config) Notify(ctx context.Context, prev, cur *scan.Report) error {
+	if cur.Interrupted {
+		return nil
+	}
+	pending := map[string][]Finding{} // by channel
+	var order []string
+	for _, r := range c.Rules {
+		if len(r.Targets) > 0 && !contains(r.Targets, cur.Target) {
+			continue
+		}
+		days := r.CertExpiryDays
+		if days <= 0 {
+			days = 30
+		}
+		for _, f := range Findings(prev, cur, days) {
+			if !contains(r.Events, f.Kind) {
+				continue
+			}
+			for _, ch := range r.Channels {
+				if _, ok := pending[ch]; !ok {
+					order = append(order, ch)
+				}
+				if !containsFinding(pending[ch], f) {
+					pending[ch] = append(pending[ch], f)
+				}
+			}
+		}
+	}
+
+	var errs []error
+	for _, name := range order {
+		ch := c.channel(name)
+		if err := ch.Send(ctx, c.SMTP, NewAlert(cur, pending[name])); err != nil {
+			errs = append(errs, fmt.Errorf("channel %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func containsFinding(list []Finding, f Finding) bool {
+	for _, g := range list {
+		if g.Kind == f.Kind && g.Address == f.Address && g.Port == f.Port {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Config) channel(name string) *Channel {
+	for i := range c.Channels {
+		if c.Channels[i].Name == name {
+			return &c.Channels[i]
+		}
+	}
+	return nil
+}
+
+// Test sends a sample alert through every channel, so a configuration can
+// be tried out against real or stand-in endpoints.
+func (c *Config) Test(ctx context.Context) error {
+	expires := time.Now().AddDate(0, 0, 7).UTC().Truncate(24 * time.Hour)
+	r := scan.NewReport("portscan", "192.0.2.10")
+	r.Finish(3, false)
+	alert := NewAlert(r, []Finding{
+		{Kind: NewHost, Address: "192.0.2.10"},
+		{Kind: NewPort, Address: "192.0.2.10", Port: 8443, Service: "https-alt"},
+		{Kind: CertExpiry, Address: "192.0.2.10", Port: 8443, Service: "https-alt", Expires: &expires},
+	})
+	alert.Test = true
+
+	var errs []error
+	for i := range c.Channels {
+		if err := c.Channels[i].Send(ctx, c.SMTP, alert); err != nil {
+			errs = append(errs, fmt.Errorf("channel %s: %w", c.Channels[i].Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,191 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"network-scanner/scan"
+)
+
+// report builds a finished scan of 10.0.0.0/24 from host -> open ports,
+// with certExpiry giving the certificate expiry of a "host:port".
+func report(finished time.Time, hosts map[string][]int, certExpiry map[string]time.Time) *scan.Report {
+	r := scan.NewReport("netscan", "10.0.0.0/24")
+	for addr, ports := range hosts {
+		r.AddHost(addr)
+		for _, n := range ports {
+			p := scan.Port{Number: n, Protocol: "tcp", State: "open"}
+			if exp, ok := certExpiry[addr+":"+strconv.Itoa(n)]; ok {
+				p.CertExpires = &exp
+			}
+			r.AddPort(addr, p)
+		}
+	}
+	r.Finish(256, false)
+	r.Finished = finished
+	return r
+}
+
+// summary lists findings as "kind address:port" for comparison.
+func summary(findings []Finding) []string {
+	out := []string{}
+	for _, f := range findings {
+		out = append(out, f.Kind+" "+f.Address+":"+strconv.Itoa(f.Port))
+	}
+	return out
+}
+
+func TestFindings(t *testing.T) {
+	day := 24 * time.Hour
+	then := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	now := then.Add(day)
+	soon := now.Add(10 * day)               // within 30 days of both runs
+	later := now.Add(29*day + 12*time.Hour) // within 30 days of now, not of then
+	renewed := now.Add(20 * day)            // a different certificate, also close
+
+	tests := []struct {
+		name      string
+		prev, cur *scan.Report
+		want      []string
+	}{
+		{
+			name: "first run reports only certificates",
+			cur:  report(now, map[string][]int{"10.0.0.1": {22, 443}}, map[string]time.Time{"10.0.0.1:443": soon}),
+			want: []string{"cert-expiry 10.0.0.1:443"},
+		},
+		{
+			name: "new host and its ports",
+			prev: report(then, map[string][]int{"10.0.0.1": {22}}, nil),
+			cur:  report(now, map[string][]int{"10.0.0.1": {22}, "10.0.0.9": {80}}, nil),
+			want: []string{"new-host 10.0.0.9:0", "new-port 10.0.0.9:80"},
+		},
+		{
+			name: "new port on a known host",
+			prev: report(then, map[string][]int{"10.0.0.1": {22}}, nil),
+			cur:  report(now, map[string][]int{"10.0.0.1": {22, 8080}}, nil),
+			want: []string{"new-port 10.0.0.1:8080"},
+		},
+		{
+			name: "nothing new",
+			prev: report(then, map[string][]int{"10.0.0.1": {22}}, nil),
+			cur:  report(now, map[string][]int{"10.0.0.1": {22}}, nil),
+			want: []string{},
+		},
+		{
+			name: "certificate already reported after the previous run",
+			prev: report(then, map[string][]int{"10.0.0.1": {443}}, map[string]time.Time{"10.0.0.1:443": soon}),
+			cur:  report(now, map[string][]int{"10.0.0.1": {443}}, map[string]time.Time{"10.0.0.1:443": soon}),
+			want: []string{},
+		},
+		{
+			name: "certificate that came within range since the previous run",
+			prev: report(then, map[string][]int{"10.0.0.1": {443}}, map[string]time.Time{"10.0.0.1:443": later}),
+			cur:  report(now, map[string][]int{"10.0.0.1": {443}}, map[string]time.Time{"10.0.0.1:443": later}),
+			want: []string{"cert-expiry 10.0.0.1:443"},
+		},
+		{
+			name: "replaced certificate that is also close to expiry",
+			prev: report(then, map[string][]int{"10.0.0.1": {443}}, map[string]time.Time{"10.0.0.1:443": soon}),
+			cur:  report(now, map[string][]int{"10.0.0.1": {443}}, map[string]time.Time{"10.0.0.1:443": renewed}),
+			want: []string{"cert-expiry 10.0.0.1:443"},
+		},
+		{
+			name: "certificate far from expiry",
+			cur:  report(now, map[string][]int{"10.0.0.1": {443}}, map[string]time.Time{"10.0.0.1:443": now.Add(90 * day)}),
+			want: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := summary(Findings(tt.prev, tt.cur, 30)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Findings = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNotify(t *testing.T) {
+	ops := newHook(t, http.StatusOK)
+	siem := newHook(t, http.StatusOK)
+	path := filepath.Join(t.TempDir(), "notify.yaml")
+	config := `
+channels:
+  - name: ops
+    type: webhook
+    url: ` + ops.URL + `
+  - name: siem
+    type: webhook
+    url: ` + siem.URL + `
+rules:
+  - events: [new-host, new-port]
+    channels: [ops, siem]
+  - events: [new-port]
+    channels: [ops]
+  - events: [new-host]
+    channels: [siem]
+    targets: [192.168.0.0/24]
+`
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	c, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prev := report(time.Now().Add(-time.Hour), map[string][]int{"10.0.0.1": {22}}, nil)
+	cur := report(time.Now(), map[string][]int{"10.0.0.1": {22, 80}, "10.0.0.9": nil}, nil)
+	if err := c.Notify(context.Background(), prev, cur); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each channel gets one alert, with every finding once, though two
+	// rules send new ports to ops.
+	for name, h := range map[string]*hook{"ops": ops, "siem": siem} {
+		_, body := h.only(t)
+		var alert Alert
+		if err := json.Unmarshal(body, &alert); err != nil {
+			t.Fatal(err)
+		}
+		want := []string{"new-host 10.0.0.9:0", "new-port 10.0.0.1:80"}
+		if got := summary(alert.Findings); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s got %v, want %v", name, got, want)
+		}
+	}
+
+	// An interrupted scan sends nothing.
+	cur.Interrupted = true
+	if err := c.Notify(context.Background(), prev, cur); err != nil {
+		t.Fatal(err)
+	}
+	if ops.count() != 1 || siem.count() != 1 {
+		t.Errorf("interrupted scan sent alerts")
+	}
+}
+
+func TestLoadRejects(t *testing.T) {
+	for _, config := range []string{
+		"channels:\n  - name: a\n    type: pager\n    url: https://example.com\n",
+		"channels:\n  - name: a\n    type: slack\n    url: ftp://example.com\n",
+		"channels:\n  - name: a\n    type: email\n    to: [ops@example.com]\n",
+		"channels:\n  - name: a\n    type: slack\n    url: https://example.com\nrules:\n  - events: [port-closed]\n    channels: [a]\n",
+		"channels:\n  - name: a\n    type: slack\n    url: https://example.com\nrules:\n  - events: [new-host]\n    channels: [b]\n",
+		"channels:\n  - name: a\n    type: webhook\n    url: https://example.com\n    template: '{{.Nope'\n",
+		"channel: []\n",
+	} {
+		path := filepath.Join(t.TempDir(), "notify.yaml")
+		if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(path); err == nil {
+			t.Errorf("Load accepted:\n%s", config)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package scan
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Checkpoint records how far an interrupted scan got so that it can be
+// resumed without probing the same targets again. Targets are addresses
+// for sweeps and port numbers for port scans.
+type Checkpoint struct {
+	Command string    `json:"command"`
+	Args    []string  `json:"args"`
+	Done    []string  `json:"done"`  // targets already probed
+	Found   []string  `json:"found"` // targets that answered
+	Saved   time.Time `json:"saved"`
+}
+
+// LoadCheckpoint reads a checkpoint written by Save.
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cp Checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("reading checkpoint %s: %w", path, err)
+	}
+	return &cp, nil
+}
+
+// Save writes the checkpoint to path, replacing any previous one in a
+// single rename so an interrupted write never leaves a truncated file.
+func (c *Checkpoint) Save(path string) error {
+	c.Saved = time.Now()
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".checkpoint-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Remaining returns the targets in all that the checkpoint has not done yet,
+// in their original order.
+func (c *Checkpoint) Remaining(all []string) []string {
+	done := make(map[string]bool, len(c.Done))
+	for _, t := range c.Done {
+		done[t] = true
+	}
+	var rest []string
+	for _, t := range all {
+		if !done[t] {
+			rest = append(rest, t)
+		}
+	}
+	return rest
+}
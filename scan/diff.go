@@ -0,0 +1,252 @@
+package scan
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Diff lists what changed on the network between two scans.
+type Diff struct {
+	Old       DiffSide        `json:"old"`
+	New       DiffSide        `json:"new"`
+	NewHosts  []string        `json:"new_hosts"`
+	GoneHosts []string        `json:"gone_hosts"`
+	Opened    []PortChange    `json:"opened_ports"`
+	Closed    []PortChange    `json:"closed_ports"`
+	Changed   []ServiceChange `json:"changed_services"`
+}
+
+// DiffSide identifies one of the two scans in a Diff.
+type DiffSide struct {
+	ID      uint64    `json:"id,omitempty"`
+	Command string    `json:"command"`
+	Target  string    `json:"target"`
+	Started time.Time `json:"started"`
+}
+
+// PortChange is a port that opened or closed on a host seen in both scans.
+type PortChange struct {
+	Address  string `json:"address"`
+	Port     int    `json:"port"`
+	Protocol string `json:"protocol"`
+	Service  string `json:"service,omitempty"`
+}
+
+// ServiceChange is a difference in what an open port announced.
+type ServiceChange struct {
+	Address string `json:"address"`
+	Port    int    `json:"port"`
+	Field   string `json:"field"` // "version", "certificate" or "cert_expires"
+	Old     string `json:"old"`
+	New     string `json:"new"`
+}
+
+func side(r *Report) DiffSide {
+	return DiffSide{ID: r.ID, Command: r.Command, Target: r.Target, Started: r.Started}
+}
+
+// Compare works out what changed from old to new. Every open port of a new
+// host counts as opened; a host that vanished is reported once rather than
+// with each of its ports, which are not listed as closed. Service fields
+// are compared only when both scans recorded them.
+func Compare(old, new *Report) *Diff {
+	d := &Diff{
+		Old:       side(old),
+		New:       side(new),
+		NewHosts:  []string{},
+		GoneHosts: []string{},
+		Opened:    []PortChange{},
+		Closed:    []PortChange{},
+		Changed:   []ServiceChange{},
+	}
+
+	oldHosts := make(map[string]*Host, len(old.Hosts))
+	for i := range old.Hosts {
+		oldHosts[old.Hosts[i].Address] = &old.Hosts[i]
+	}
+	newHosts := make(map[string]*Host, len(new.Hosts))
+	for i := range new.Hosts {
+		newHosts[new.Hosts[i].Address] = &new.Hosts[i]
+	}
+
+	for _, h := range new.Hosts {
+		oh, ok := oldHosts[h.Address]
+		if !ok {
+			d.NewHosts = append(d.NewHosts, h.Address)
+			for _, p := range h.Ports {
+				d.Opened = append(d.Opened, portChange(h.Address, p))
+			}
+			continue
+		}
+		comparePorts(d, h.Address, oh.Ports, h.Ports)
+	}
+	for _, h := range old.Hosts {
+		if _, ok := newHosts[h.Address]; !ok {
+			d.GoneHosts = append(d.GoneHosts, h.Address)
+		}
+	}
+
+	sort.Slice(d.NewHosts, func(i, j int) bool { return addressLess(d.NewHosts[i], d.NewHosts[j]) })
+	sort.Slice(d.GoneHosts, func(i, j int) bool { return addressLess(d.GoneHosts[i], d.GoneHosts[j]) })
+	return d
+}
+
+func portChange(address string, p Port) PortChange {
+	return PortChange{Address: address, Port: p.Number, Protocol: p.Protocol, Service: p.Service}
+}
+
+func portKey(p Port) string {
+	return fmt.Sprintf("%d/%s", p.Number, p.Protocol)
+}
+
+func comparePorts(d *Diff, address string, old, new []Port) {
+	oldPorts := make(map[string]Port, len(old))
+	for _, p := range old {
+		oldPorts[portKey(p)] = p
+	}
+	newPorts := make(map[string]bool, len(new))
+
+	for _, p := range new {
+		newPorts[portKey(p)] = true
+		op, ok := oldPorts[portKey(p)]
+		if !ok {
+			d.Opened = append(d.Opened, portChange(address, p))
+			continue
+		}
+		if op.Version != "" && p.Version != "" && op.Version != p.Version {
+			d.Changed = append(d.Changed, ServiceChange{address, p.Number, "version", op.Version, p.Version})
+		}
+		if op.CertSHA256 != "" && p.CertSHA256 != "" && op.CertSHA256 != p.CertSHA256 {
+			d.Changed = append(d.Changed, ServiceChange{address, p.Number, "certificate", op.CertSHA256, p.CertSHA256})
+		} else if op.CertExpires != nil && p.CertExpires != nil && !op.CertExpires.Equal(*p.CertExpires) {
+			d.Changed = append(d.Changed, ServiceChange{address, p.Number, "cert_expires",
+				op.CertExpires.Format(time.RFC3339), p.CertExpires.Format(time.RFC3339)})
+		}
+	}
+	for _, p := range old {
+		if !newPorts[portKey(p)] {
+			d.Closed = append(d.Closed, portChange(address, p))
+		}
+	}
+}
+
+// Empty reports whether nothing changed.
+func (d *Diff) Empty() bool {
+	return len(d.NewHosts) == 0 && len(d.GoneHosts) == 0 &&
+		len(d.Opened) == 0 && len(d.Closed) == 0 && len(d.Changed) == 0
+}
+
+// DiffFormats lists the output formats WriteDiff understands.
+var DiffFormats = []string{"text", "json", "markdown"}
+
+// WriteDiff writes d to w in one of DiffFormats.
+func WriteDiff(w io.Writer, d *Diff, format string) error {
+	switch strings.ToLower(format) {
+	case "", "text":
+		return writeDiffText(w, d)
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(d)
+	case "markdown", "md":
+		return writeDiffMarkdown(w, d)
+	}
+	return fmt.Errorf("unknown format %q (want one of %s)", format, strings.Join(DiffFormats, ", "))
+}
+
+func (s DiffSide) String() string {
+	name := fmt.Sprintf("%s %s", s.Command, s.Target)
+	if s.ID != 0 {
+		name = fmt.Sprintf("#%d %s", s.ID, name)
+	}
+	return fmt.Sprintf("%s (%s)", name, s.Started.Format("2006-01-02 15:04:05"))
+}
+
+func (c PortChange) String() string {
+	s := fmt.Sprintf("%s %d/%s", c.Address, c.Port, c.Protocol)
+	if c.Service != "" {
+		s += " (" + c.Service + ")"
+	}
+	return s
+}
+
+func (c ServiceChange) String() string {
+	return fmt.Sprintf("%s port %d %s: %q -> %q", c.Address, c.Port, c.Field, c.Old, c.New)
+}
+
+func writeDiffText(w io.Writer, d *Diff) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Old: %s\n", d.Old)
+	fmt.Fprintf(&b, "New: %s\n", d.New)
+	if d.Empty() {
+		b.WriteString("\nNo changes.\n")
+	}
+	for _, h := range d.NewHosts {
+		fmt.Fprintf(&b, "+ host %s\n", h)
+	}
+	for _, h := range d.GoneHosts {
+		fmt.Fprintf(&b, "- host %s\n", h)
+	}
+	for _, c := range d.Opened {
+		fmt.Fprintf(&b, "+ port %s\n", c)
+	}
+	for _, c := range d.Closed {
+		fmt.Fprintf(&b, "- port %s\n", c)
+	}
+	for _, c := range d.Changed {
+		fmt.Fprintf(&b, "~ %s\n", c)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeDiffMarkdown(w io.Writer, d *Diff) error {
+	var b strings.Builder
+	b.WriteString("# Scan changes\n\n")
+	fmt.Fprintf(&b, "- **Old:** %s\n", d.Old)
+	fmt.Fprintf(&b, "- **New:** %s\n\n", d.New)
+	if d.Empty() {
+		b.WriteString("No changes.\n")
+	}
+
+	list := func(title string, items []string) {
+		if len(items) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "## %s (%d)\n\n", title, len(items))
+		for _, item := range items {
+			fmt.Fprintf(&b, "- `%s`\n", item)
+		}
+		b.WriteString("\n")
+	}
+	list("New hosts", d.NewHosts)
+	list("Vanished hosts", d.GoneHosts)
+	list("Opened ports", stringsOf(d.Opened))
+	list("Closed ports", stringsOf(d.Closed))
+
+	if len(d.Changed) > 0 {
+		fmt.Fprintf(&b, "## Changed services (%d)\n\n", len(d.Changed))
+		b.WriteString("| Host | Port | Field | Old | New |\n|---|---|---|---|---|\n")
+		for _, c := range d.Changed {
+			fmt.Fprintf(&b, "| %s | %d | %s | %s | %s |\n", c.Address, c.Port, c.Field, mdCell(c.Old), mdCell(c.New))
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func stringsOf[T fmt.Stringer](items []T) []string {
+	out := make([]string, len(items))
+	for i, item := range items {
+		out[i] = item.String()
+	}
+	return out
+}
+
+func mdCell(s string) string {
+	return strings.ReplaceAll(s, "|", `\|`)
+}
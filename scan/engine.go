@@ -0,0 +1,307 @@
+// Package scan is the probing engine shared by the CLI and the GUI.
+package scan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Engine sends probes according to a Timing profile.
+type Engine struct {
+	Timing     Timing
+	Retry      RetryPolicy
+	Services   bool   // identify the service behind each open port
+	ScanMode   string // ScanSYN or ScanConnect; empty picks SYN scanning when raw sockets are allowed
+	Privileged bool   // send ICMP echoes from a raw socket even where ping sockets are allowed
+	rtt        *rttTracker
+	retries    retryStats
+	limiter    *RateLimiter
+	meter      rateMeter
+	gate       gate
+}
+
+// NewEngine returns an Engine using timing t. Zero fields fall back to the
+// normal profile.
+func NewEngine(t Timing) *Engine {
+	if t.Concurrency < 1 {
+		t.Concurrency = DefaultTiming.Concurrency
+	}
+	if t.Timeout <= 0 {
+		t.Timeout = DefaultTiming.Timeout
+	}
+	if t.Retries < 0 {
+		t.Retries = 0
+	}
+	if t.MaxRate > 0 && t.MinRate > t.MaxRate {
+		t.MinRate = t.MaxRate
+	}
+	t = applyMinRate(t)
+
+	e := &Engine{Timing: t, Retry: DefaultRetryPolicy, rtt: newRTTTracker()}
+	if t.MaxRate > 0 {
+		e.limiter = NewRateLimiter(t.MaxRate)
+	}
+	return e
+}
+
+// send is called before every probe packet goes out, including retries.
+// It blocks while the engine is paused and fails only when ctx is cancelled
+// while waiting.
+func (e *Engine) send(ctx context.Context) error {
+	if err := e.gate.wait(ctx); err != nil {
+		return err
+	}
+	if e.limiter != nil {
+		if err := e.limiter.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	e.meter.tick()
+	return nil
+}
+
+// Rate is the number of probes sent per second over about the last second.
+func (e *Engine) Rate() float64 {
+	return e.meter.rate()
+}
+
+// timeout is the probe timeout to use for host right now.
+func (e *Engine) timeout(host string) time.Duration {
+	if !e.Timing.Adaptive {
+		return e.Timing.Timeout
+	}
+	return e.rtt.timeout(host, e.Timing.Timeout, e.Timing.MaxTimeout)
+}
+
+// Ping sends ICMP echoes to host until one is answered, the retries run
+// out or ctx is cancelled.
+func (e *Engine) Ping(ctx context.Context, host string) bool {
+	return e.PingHost(ctx, host).Alive()
+}
+
+// PingHost pings host like Ping and says why it did not answer: its name
+// did not resolve, ICMP is not permitted, it was reported unreachable,
+// which is not retried, or the echoes went unanswered.
+func (e *Engine) PingHost(ctx context.Context, host string) PingResult {
+	r := PingResult{Host: host}
+	fail := func(err error) PingResult {
+		r.Status, r.Err = PingErrorStatus(err), err
+		return r
+	}
+	mode, err := e.ICMPMode()
+	if err != nil {
+		return fail(err)
+	}
+	addr, err := net.ResolveIPAddr("ip", host)
+	if err != nil {
+		return fail(err)
+	}
+	r.Addr = addr.String()
+
+	var reply echoReply
+	e.retry(ctx, ProbeICMP, func() (bool, bool, error) {
+		reply, err = e.pingOnce(ctx, host, addr, mode == ICMPRaw)
+		return reply.alive, reply.alive || reply.unreachable, err
+	})
+	switch {
+	case reply.alive:
+		r.Status, r.RTT, r.TTL = PingAlive, reply.rtt, reply.ttl
+	case ctx.Err() != nil:
+		return fail(ctx.Err())
+	case err != nil:
+		return fail(err)
+	case reply.unreachable:
+		r.Status, r.Reason = PingUnreachable, unreachableReason(reply.code)
+		if reply.from != nil {
+			r.From = reply.from.String()
+		}
+	default:
+		r.Status = PingTimeout
+	}
+	return r
+}
+
+func (e *Engine) pingOnce(ctx context.Context, host string, addr *net.IPAddr, raw bool) (echoReply, error) {
+	if err := e.send(ctx); err != nil {
+		return echoReply{}, err
+	}
+	reply, err := echo(ctx, addr, raw, e.timeout(host))
+	if err == nil && reply.alive {
+		e.rtt.observe(host, reply.rtt)
+	}
+	return reply, err
+}
+
+// ProbeTCP reports whether a TCP connection to host:port can be opened.
+// Only timeouts are retried; a refused connection is a definite answer.
+func (e *Engine) ProbeTCP(ctx context.Context, host string, port int) bool {
+	address := net.JoinHostPort(host, strconv.Itoa(port))
+	return e.retry(ctx, ProbeTCP, func() (bool, bool, error) {
+		if err := e.send(ctx); err != nil {
+			return false, false, err
+		}
+		dialer := net.Dialer{Timeout: e.timeout(host)}
+		start := time.Now()
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err == nil {
+			e.rtt.observe(host, time.Since(start))
+			conn.Close()
+			return true, true, nil
+		}
+		if ctx.Err() != nil {
+			return false, false, ctx.Err()
+		}
+		if !isTimeout(err) {
+			// A reset came back, which is as good an RTT sample as a SYN-ACK.
+			e.rtt.observe(host, time.Since(start))
+			return false, true, nil
+		}
+		return false, false, nil
+	})
+}
+
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+// delay waits out the inter-probe delay of the timing profile.
+func (e *Engine) delay(ctx context.Context) {
+	sleep(ctx, e.Timing.Delay)
+}
+
+// sleep waits for d or until ctx is cancelled, whichever comes first.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Sweep pings every address in ips, Timing.Concurrency at a time, and calls
+// fn once per address. Calls to fn are serialized. When ctx is cancelled no
+// new pings are started, probes in flight are abandoned and Sweep returns
+// ctx.Err() once they have all stopped; fn is not called for abandoned
+// probes. When no ICMP socket may be opened Sweep fails at once, without
+// calling fn.
+func (e *Engine) Sweep(ctx context.Context, ips []string, fn func(ip string, alive bool)) error {
+	return e.PingSweep(ctx, ips, func(r PingResult) {
+		fn(r.Host, r.Alive())
+	})
+}
+
+// PingSweep is Sweep with the whole result of every ping.
+func (e *Engine) PingSweep(ctx context.Context, ips []string, fn func(r PingResult)) error {
+	if _, err := e.ICMPMode(); err != nil {
+		return err
+	}
+	var mu sync.Mutex
+	return e.each(ctx, len(ips), func(i int) {
+		r := e.PingHost(ctx, ips[i])
+		if !r.Alive() && ctx.Err() != nil {
+			return
+		}
+		mu.Lock()
+		fn(r)
+		mu.Unlock()
+	})
+}
+
+// CheckPortRange returns an error unless 1 <= start <= end <= 65535.
+func CheckPortRange(start, end int) error {
+	if start < 1 || end > 65535 || start > end {
+		return fmt.Errorf("invalid port range %d-%d (want 1-65535, start first)", start, end)
+	}
+	return nil
+}
+
+// ScanPorts probes TCP ports start through end on host and calls fn once per
+// port with the port's details and whether it is open. Calls to fn are
+// serialized. It returns the mode the ports were probed in, ScanSYN or
+// ScanConnect, or an error straight away if the range is invalid.
+// Cancellation works as for Sweep.
+func (e *Engine) ScanPorts(ctx context.Context, host string, start, end int, fn func(p Port, open bool)) (string, error) {
+	if err := CheckPortRange(start, end); err != nil {
+		return "", err
+	}
+	ports := make([]int, 0, end-start+1)
+	for port := start; port <= end; port++ {
+		ports = append(ports, port)
+	}
+	return e.ScanPortList(ctx, host, ports, fn)
+}
+
+// ScanPortList is ScanPorts for an arbitrary list of ports. It scans
+// half-open with raw SYNs when PortScanMode says so and a SYN prober can be
+// set up for host, which needs an IPv4 address, and with full connections
+// otherwise.
+func (e *Engine) ScanPortList(ctx context.Context, host string, ports []int, fn func(p Port, open bool)) (string, error) {
+	prober, mode := e.portProber(host)
+	defer prober.close()
+	var mu sync.Mutex
+	return mode, e.each(ctx, len(ports), func(i int) {
+		port := ports[i]
+		open := prober.probe(ctx, host, port)
+		if !open && ctx.Err() != nil {
+			return
+		}
+		p := Port{Number: port, Protocol: "tcp", State: "closed"}
+		if open {
+			p.State = "open"
+			p.Service = ServiceName(port)
+			if e.Services {
+				p = e.identify(ctx, host, port)
+			}
+		}
+		mu.Lock()
+		fn(p, open)
+		mu.Unlock()
+	})
+}
+
+// each runs job for 0..n-1 on a pool of Timing.Concurrency workers until
+// all jobs are done or ctx is cancelled. It returns once every worker has
+// exited.
+func (e *Engine) each(ctx context.Context, n int, job func(i int)) error {
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+
+	workers := e.Timing.Concurrency
+	if workers > n {
+		workers = n
+	}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				job(i)
+				e.delay(ctx)
+			}
+		}()
+	}
+
+dispatch:
+	for i := 0; i < n; i++ {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return ctx.Err()
+}
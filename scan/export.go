@@ -0,0 +1,144 @@
+package scan
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Formats lists the output formats WriteReport understands.
+var Formats = []string{"text", "json", "xml", "csv"}
+
+// WriteReport writes r to w in one of Formats.
+func WriteReport(w io.Writer, r *Report, format string) error {
+	switch strings.ToLower(format) {
+	case "", "text":
+		return writeText(w, r)
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	case "xml":
+		if _, err := io.WriteString(w, xml.Header); err != nil {
+			return err
+		}
+		enc := xml.NewEncoder(w)
+		enc.Indent("", "  ")
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+		_, err := io.WriteString(w, "\n")
+		return err
+	case "csv":
+		return writeCSV(w, r)
+	}
+	return fmt.Errorf("unknown format %q (want one of %s)", format, strings.Join(Formats, ", "))
+}
+
+func writeText(w io.Writer, r *Report) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Scan #%d: %s %s\n", r.ID, r.Command, r.Target)
+	fmt.Fprintf(&b, "Started:  %s\n", r.Started.Format(time.RFC3339))
+	fmt.Fprintf(&b, "Finished: %s (%s)\n", r.Finished.Format(time.RFC3339), r.Finished.Sub(r.Started).Round(time.Millisecond))
+	if r.Interrupted {
+		b.WriteString("Status:   interrupted\n")
+	}
+	for _, p := range r.Params {
+		fmt.Fprintf(&b, "  %s = %s\n", p.Name, p.Value)
+	}
+	fmt.Fprintf(&b, "%d answered out of %d scanned, %d open ports\n", len(r.Hosts), r.Scanned, r.OpenPorts())
+	for _, h := range r.Hosts {
+		fmt.Fprintf(&b, "Host %s\n", h.Address)
+		if h.OS != nil {
+			fmt.Fprintf(&b, "  os %s\n", h.OS)
+		}
+		for _, p := range h.Ports {
+			line := fmt.Sprintf("  %d/%s %s %s", p.Number, p.Protocol, p.State, portDetails(p))
+			b.WriteString(strings.TrimRight(line, " ") + "\n")
+		}
+		for _, s := range h.MDNS {
+			fmt.Fprintf(&b, "  mdns %s\n", s)
+		}
+		for _, d := range h.UPnP {
+			fmt.Fprintf(&b, "  upnp %s\n", d)
+		}
+		if h.NetBIOS != nil {
+			fmt.Fprintf(&b, "  netbios %s\n", h.NetBIOS)
+		}
+		if h.SMB != nil {
+			fmt.Fprintf(&b, "  smb %s\n", h.SMB)
+		}
+		if h.SNMP != nil {
+			fmt.Fprintf(&b, "  snmp %s\n", h.SNMP)
+			for _, i := range h.SNMP.Interfaces {
+				fmt.Fprintf(&b, "    if %s\n", i)
+			}
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// portDetails describes what service detection found on a port.
+func portDetails(p Port) string {
+	var parts []string
+	if p.Service != "" {
+		parts = append(parts, p.Service)
+	}
+	if p.Version != "" {
+		parts = append(parts, fmt.Sprintf("%q", p.Version))
+	}
+	if p.CertExpires != nil {
+		parts = append(parts, "cert expires "+p.CertExpires.Format("2006-01-02"))
+	}
+	return strings.Join(parts, " ")
+}
+
+func writeCSV(w io.Writer, r *Report) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"scan_id", "command", "target", "started", "address", "port", "protocol", "state", "service", "version", "cert_sha256", "cert_expires"})
+	id := strconv.FormatUint(r.ID, 10)
+	started := r.Started.Format(time.RFC3339)
+	for _, h := range r.Hosts {
+		if len(h.Ports) == 0 {
+			cw.Write([]string{id, r.Command, r.Target, started, h.Address, "", "", "up", "", "", "", ""})
+			continue
+		}
+		for _, p := range h.Ports {
+			expires := ""
+			if p.CertExpires != nil {
+				expires = p.CertExpires.Format(time.RFC3339)
+			}
+			cw.Write([]string{id, r.Command, r.Target, started, h.Address, strconv.Itoa(p.Number), p.Protocol, p.State, p.Service, p.Version, p.CertSHA256, expires})
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ReadReportFile reads a report saved as JSON or XML.
+func ReadReportFile(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var r Report
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("<")) {
+		err = xml.Unmarshal(data, &r)
+	} else {
+		err = json.Unmarshal(data, &r)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return &r, nil
+}
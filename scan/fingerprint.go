@@ -0,0 +1,415 @@
+package scan
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/ipv4"
+	"gopkg.in/yaml.v3"
+)
+
+// OSGuess is the operating system family a host most likely runs.
+type OSGuess struct {
+	Family     string   `json:"family" xml:"family,attr"`
+	Confidence int      `json:"confidence" xml:"confidence,attr"`  // percent
+	Evidence   []string `json:"evidence,omitempty" xml:"evidence"` // the signals that point to Family
+}
+
+func (g OSGuess) String() string {
+	out := fmt.Sprintf("%s (%d%%)", g.Family, g.Confidence)
+	if len(g.Evidence) > 0 {
+		out += ": " + strings.Join(g.Evidence, "; ")
+	}
+	return out
+}
+
+// OSSignals is what is known about a host that hints at its operating
+// system.
+type OSSignals struct {
+	TTL        int      // TTL of an echo reply or SYN-ACK as received, 0 for none
+	Window     int      // window of a SYN-ACK, 0 when none was seen
+	TCPOptions string   // options of that SYN-ACK in order, e.g. "mss,sok,ts,nop,ws"
+	Open       []int    // open TCP ports
+	Banners    []string // service banners, HTTP Server headers, SNMP sysDescr and so on
+}
+
+// initialTTL is the TTL a host most likely sent a packet received with ttl
+// with, the next of the usual starting values.
+func initialTTL(ttl int) int {
+	for _, initial := range []int{32, 64, 128} {
+		if ttl <= initial {
+			return initial
+		}
+	}
+	return 255
+}
+
+// OSRules are the heuristics OS guesses are made with. See osrules.yaml
+// for the format.
+type OSRules struct {
+	Rules []OSRule `yaml:"rules"`
+}
+
+// OSRule gives Family Weight points when all of its conditions hold.
+type OSRule struct {
+	Family     string   `yaml:"family"`
+	Weight     int      `yaml:"weight"`
+	TTL        int      `yaml:"ttl"`         // initial TTL: 32, 64, 128 or 255
+	Window     []int    `yaml:"window"`      // any of these SYN-ACK windows
+	TCPOptions string   `yaml:"tcp_options"` // SYN-ACK options, as in OSSignals
+	Open       PortList `yaml:"open"`        // ports that must all be open
+	Banner     string   `yaml:"banner"`      // regular expression one banner must match
+
+	banner *regexp.Regexp
+}
+
+//go:embed osrules.yaml
+var builtinOSRules []byte
+
+// DefaultOSRules returns the rules built into the scanner.
+func DefaultOSRules() *OSRules {
+	rules, err := ReadOSRules(bytes.NewReader(builtinOSRules))
+	if err != nil {
+		panic("built-in OS rules: " + err.Error())
+	}
+	return rules
+}
+
+// DefaultOSRulesPath is where extra OS rules are read from when not told
+// otherwise.
+func DefaultOSRulesPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = "."
+	}
+	return filepath.Join(dir, "network-scanner", "osrules.yaml")
+}
+
+// LoadOSRules returns the built-in rules together with those in the file
+// at path, or only the built-in rules when path is empty.
+func LoadOSRules(path string) (*OSRules, error) {
+	rules := DefaultOSRules()
+	if path == "" {
+		return rules, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	extra, err := ReadOSRules(f)
+	if err != nil {
+		return nil, fmt.Errorf("OS rules %s: %w", path, err)
+	}
+	rules.Rules = append(rules.Rules, extra.Rules...)
+	return rules, nil
+}
+
+// ReadOSRules reads and checks YAML OS rules.
+func ReadOSRules(r io.Reader) (*OSRules, error) {
+	var rules OSRules
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	if err := dec.Decode(&rules); err != nil && err != io.EOF {
+		return nil, err
+	}
+	for i := range rules.Rules {
+		rule := &rules.Rules[i]
+		if rule.Family == "" {
+			return nil, fmt.Errorf("rule %d has no family", i+1)
+		}
+		if rule.Weight <= 0 {
+			return nil, fmt.Errorf("rule %d (%s): weight must be positive", i+1, rule.Family)
+		}
+		if rule.TTL == 0 && len(rule.Window) == 0 && rule.TCPOptions == "" && len(rule.Open) == 0 && rule.Banner == "" {
+			return nil, fmt.Errorf("rule %d (%s) has no conditions", i+1, rule.Family)
+		}
+		if rule.TTL != 0 && initialTTL(rule.TTL) != rule.TTL {
+			return nil, fmt.Errorf("rule %d (%s): ttl must be 32, 64, 128 or 255", i+1, rule.Family)
+		}
+		if rule.Banner != "" {
+			re, err := regexp.Compile(rule.Banner)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d (%s): banner: %w", i+1, rule.Family, err)
+			}
+			rule.banner = re
+		}
+	}
+	return &rules, nil
+}
+
+// Ports lists the ports the rules look for, so that a scan can probe them.
+func (r *OSRules) Ports() []int {
+	var ports []int
+	for _, rule := range r.Rules {
+		ports = append(ports, rule.Open...)
+	}
+	return UniquePorts(ports)
+}
+
+// match reports whether rule holds for s and if so describes why.
+func (rule *OSRule) match(s OSSignals) (string, bool) {
+	var why []string
+	if rule.TTL != 0 {
+		if s.TTL == 0 || initialTTL(s.TTL) != rule.TTL {
+			return "", false
+		}
+		why = append(why, fmt.Sprintf("ttl %d", s.TTL))
+	}
+	if len(rule.Window) > 0 {
+		if s.Window == 0 || !slices.Contains(rule.Window, s.Window) {
+			return "", false
+		}
+		why = append(why, fmt.Sprintf("window %d", s.Window))
+	}
+	if rule.TCPOptions != "" {
+		if s.TCPOptions == "" || !strings.EqualFold(strings.ReplaceAll(rule.TCPOptions, " ", ""), s.TCPOptions) {
+			return "", false
+		}
+		why = append(why, "tcp options "+s.TCPOptions)
+	}
+	if len(rule.Open) > 0 {
+		for _, p := range rule.Open {
+			if !slices.Contains(s.Open, p) {
+				return "", false
+			}
+		}
+		why = append(why, "ports "+FormatPorts(rule.Open)+" open")
+	}
+	if rule.banner != nil {
+		matched := ""
+		for _, b := range s.Banners {
+			if rule.banner.MatchString(b) {
+				matched = b
+				break
+			}
+		}
+		if matched == "" {
+			return "", false
+		}
+		why = append(why, fmt.Sprintf("banner %q", matched))
+	}
+	return strings.Join(why, ", "), true
+}
+
+// Guess weighs s against the rules. It returns nil when no rule matches.
+func (r *OSRules) Guess(s OSSignals) *OSGuess {
+	points := map[string]int{}
+	evidence := map[string][]string{}
+	total := 0
+	for i := range r.Rules {
+		rule := &r.Rules[i]
+		why, ok := rule.match(s)
+		if !ok {
+			continue
+		}
+		points[rule.Family] += rule.Weight
+		total += rule.Weight
+		if !slices.Contains(evidence[rule.Family], why) {
+			evidence[rule.Family] = append(evidence[rule.Family], why)
+		}
+	}
+	best := ""
+	for family, p := range points {
+		if best == "" || p > points[best] || (p == points[best] && family < best) {
+			best = family
+		}
+	}
+	if best == "" {
+		return nil
+	}
+	// Little evidence leaves the confidence low even when it all agrees.
+	return &OSGuess{
+		Family:     best,
+		Confidence: points[best] * 100 / max(total, 100),
+		Evidence:   evidence[best],
+	}
+}
+
+// OSSweep guesses the operating system of every host in hosts,
+// Timing.Concurrency at a time, and calls fn for each that some rule
+// matched. Calls to fn are serialized; cancellation works as for Sweep.
+func (e *Engine) OSSweep(ctx context.Context, hosts []Host, rules *OSRules, fn func(ip string, g OSGuess)) error {
+	hosts = append([]Host(nil), hosts...)
+	var mu sync.Mutex
+	return e.each(ctx, len(hosts), func(i int) {
+		guess := rules.Guess(e.osSignals(ctx, hosts[i]))
+		if guess == nil || ctx.Err() != nil {
+			return
+		}
+		mu.Lock()
+		fn(hosts[i].Address, *guess)
+		mu.Unlock()
+	})
+}
+
+// osSignals gathers what hints at h's operating system: the ports and
+// banners the scan found, the TTL of the echo reply the sweep got and,
+// when raw sockets are allowed, the SYN-ACK of its lowest open port. No
+// echo is sent for the TTL; hosts a sweep did not find go by the
+// SYN-ACK's.
+func (e *Engine) osSignals(ctx context.Context, h Host) OSSignals {
+	var s OSSignals
+	for _, p := range h.Ports {
+		if p.State != "open" || p.Protocol != "tcp" {
+			continue
+		}
+		s.Open = append(s.Open, p.Number)
+		if p.Version != "" {
+			s.Banners = append(s.Banners, p.Version)
+		}
+	}
+	if h.SNMP != nil && h.SNMP.Descr != "" {
+		s.Banners = append(s.Banners, h.SNMP.Descr)
+	}
+	for _, d := range h.UPnP {
+		if d.Server != "" {
+			s.Banners = append(s.Banners, d.Server)
+		}
+	}
+
+	s.TTL = h.TTL
+	if len(s.Open) > 0 {
+		sort.Ints(s.Open)
+		if syn, err := e.synAck(ctx, h.Address, s.Open[0]); err == nil {
+			s.Window, s.TCPOptions = syn.window, tcpOptionNames(syn.options)
+			if s.TTL == 0 {
+				s.TTL = syn.ttl
+			}
+		}
+	}
+	return s
+}
+
+// synOptions are the options of the SYN sent for a fingerprint: an MSS,
+// SACK permitted, a timestamp and a window scale, the way Linux asks, so
+// that the host answers with every option it supports.
+var synOptions = []byte{
+	2, 4, 0x05, 0xb4, // MSS 1460
+	4, 2, // SACK permitted
+	8, 10, 0, 0, 0, 0, 0, 0, 0, 0, // timestamp, filled in per SYN
+	1,       // NOP
+	3, 3, 7, // window scale 7
+}
+
+// synReply is the part of a SYN-ACK that fingerprints a TCP stack.
+type synReply struct {
+	ttl     int
+	window  int
+	options []byte
+}
+
+// synAck sends a SYN to host:port from a raw socket and returns the
+// SYN-ACK. The kernel resets the half-open connection itself, as it knows
+// nothing of it. It fails with errRawDenied without privileges.
+func (e *Engine) synAck(ctx context.Context, host string, port int) (*synReply, error) {
+	dst := net.ParseIP(host).To4()
+	if dst == nil {
+		return nil, fmt.Errorf("%s is not an IPv4 address", host)
+	}
+	src, err := sourceFor(dst)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenPacket("ip4:tcp", "0.0.0.0")
+	if err != nil {
+		if permissionError(err) {
+			return nil, errRawDenied
+		}
+		return nil, err
+	}
+	defer conn.Close()
+	pc := ipv4.NewPacketConn(conn)
+	pc.SetControlMessage(ipv4.FlagTTL, true)
+
+	if err := e.send(ctx); err != nil {
+		return nil, err
+	}
+	sport := uint16(32768 + rand.Intn(28232))
+	seq := rand.Uint32()
+	options := append([]byte(nil), synOptions...)
+	binary.BigEndian.PutUint32(options[8:], uint32(time.Now().UnixMilli()))
+	seg := tcpSegment(src, dst, sport, uint16(port), seq, 0, tcpSYN, options)
+	if _, err := pc.WriteTo(seg, nil, &net.IPAddr{IP: dst}); err != nil {
+		return nil, err
+	}
+
+	conn.SetReadDeadline(time.Now().Add(e.timeout(host)))
+	stop := context.AfterFunc(ctx, func() { conn.SetReadDeadline(time.Now()) })
+	defer stop()
+	buf := make([]byte, 1500)
+	for {
+		n, cm, peer, err := pc.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, err
+		}
+		h, err := parseTCP(buf[:n])
+		if err != nil || !peer.(*net.IPAddr).IP.Equal(dst) || h.sport != uint16(port) || h.dport != sport || h.ack != seq+1 {
+			continue
+		}
+		if h.flags&(tcpSYN|tcpACK) != tcpSYN|tcpACK {
+			return nil, fmt.Errorf("port %d did not answer with a SYN-ACK", port)
+		}
+		reply := &synReply{window: int(h.window), options: append([]byte(nil), h.options...)}
+		if cm != nil {
+			reply.ttl = cm.TTL
+		}
+		return reply, nil
+	}
+}
+
+// tcpOptionNames lists TCP options by name in the order they came, as
+// the rules write them.
+func tcpOptionNames(b []byte) string {
+	var names []string
+	for len(b) > 0 {
+		kind := b[0]
+		switch kind {
+		case 0:
+			names = append(names, "eol")
+			b = nil
+			continue
+		case 1:
+			names = append(names, "nop")
+			b = b[1:]
+			continue
+		}
+		if len(b) < 2 || int(b[1]) < 2 || int(b[1]) > len(b) {
+			break
+		}
+		switch kind {
+		case 2:
+			names = append(names, "mss")
+		case 3:
+			names = append(names, "ws")
+		case 4:
+			names = append(names, "sok")
+		case 5:
+			names = append(names, "sack")
+		case 8:
+			names = append(names, "ts")
+		default:
+			names = append(names, "opt"+strconv.Itoa(int(kind)))
+		}
+		b = b[b[1]:]
+	}
+	return strings.Join(names, ",")
+}
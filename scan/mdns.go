@@ -0,0 +1,333 @@
+package scan
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+	"golang.org/x/net/ipv4"
+)
+
+// MDNSService is a service a device announced over multicast DNS, such as
+// a printer's _ipp._tcp or a Chromecast's _googlecast._tcp.
+type MDNSService struct {
+	Name  string   `json:"name" xml:"name,attr"` // instance name, e.g. "Living Room"
+	Type  string   `json:"type" xml:"type,attr"` // e.g. "_googlecast._tcp"
+	Host  string   `json:"host,omitempty" xml:"host,attr,omitempty"`
+	Port  int      `json:"port,omitempty" xml:"port,attr,omitempty"`
+	Addrs []string `json:"addresses,omitempty" xml:"address"`
+	TXT   []string `json:"txt,omitempty" xml:"txt"`
+}
+
+func (s MDNSService) String() string {
+	out := fmt.Sprintf("%s (%s)", s.Name, s.Type)
+	if s.Host != "" {
+		out += fmt.Sprintf(" on %s:%d", s.Host, s.Port)
+	}
+	if len(s.Addrs) > 0 {
+		out += " [" + strings.Join(s.Addrs, ", ") + "]"
+	}
+	if len(s.TXT) > 0 {
+		out += " " + strings.Join(s.TXT, " ")
+	}
+	return out
+}
+
+// MDNSDefaultWait is how long BrowseMDNS listens when not told otherwise.
+const MDNSDefaultWait = 3 * time.Second
+
+var mdnsGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+const mdnsServices = "_services._dns-sd._udp.local."
+
+// mdnsCache gathers the records seen while browsing, keyed by lower-case
+// name.
+type mdnsCache struct {
+	types     map[string]bool   // service types, "_http._tcp.local."
+	instances map[string]string // instance name -> its type
+	srv       map[string]dnsmessage.SRVResource
+	txt       map[string][]string
+	addrs     map[string]map[string]bool // host name -> addresses
+	names     map[string]string          // lower-case name -> name as announced
+	reported  map[string]bool
+}
+
+func newMDNSCache() *mdnsCache {
+	return &mdnsCache{
+		types:     map[string]bool{},
+		instances: map[string]string{},
+		srv:       map[string]dnsmessage.SRVResource{},
+		txt:       map[string][]string{},
+		addrs:     map[string]map[string]bool{},
+		names:     map[string]string{},
+		reported:  map[string]bool{},
+	}
+}
+
+// add stores r and reports whether it was news, which leaves new questions
+// to ask.
+func (c *mdnsCache) add(r dnsmessage.Resource) bool {
+	name := r.Header.Name.String()
+	key := strings.ToLower(name)
+	switch b := r.Body.(type) {
+	case *dnsmessage.PTRResource:
+		ptr := b.PTR.String()
+		lptr := strings.ToLower(ptr)
+		if key == mdnsServices {
+			if !serviceType(lptr) {
+				return false
+			}
+			news := !c.types[lptr]
+			c.types[lptr] = true
+			return news
+		}
+		// Instances are listed under their service type. Other pointers,
+		// such as answers to reverse lookups, are not services.
+		if !serviceType(key) || !strings.HasSuffix(lptr, "."+key) {
+			return false
+		}
+		_, known := c.instances[lptr]
+		c.types[key] = true
+		c.instances[lptr] = key
+		c.names[lptr] = ptr
+		return !known
+	case *dnsmessage.SRVResource:
+		old, known := c.srv[key]
+		c.srv[key] = *b
+		c.names[key] = name
+		if _, ok := c.instances[key]; !ok {
+			if i := strings.Index(key, "._"); i >= 0 && serviceType(key[i+1:]) {
+				c.instances[key] = key[i+1:]
+			}
+		}
+		return !known || old != *b
+	case *dnsmessage.TXTResource:
+		_, known := c.txt[key]
+		var txt []string
+		for _, s := range b.TXT {
+			if s != "" {
+				txt = append(txt, s)
+			}
+		}
+		c.txt[key] = txt
+		return !known
+	case *dnsmessage.AResource:
+		return c.addAddr(key, net.IP(b.A[:]).String())
+	case *dnsmessage.AAAAResource:
+		return c.addAddr(key, net.IP(b.AAAA[:]).String())
+	}
+	return false
+}
+
+// serviceType reports whether name, in lower case, is a DNS-SD service
+// type such as "_http._tcp.local.".
+func serviceType(name string) bool {
+	rest, ok := strings.CutSuffix(name, "._tcp.local.")
+	if !ok {
+		rest, ok = strings.CutSuffix(name, "._udp.local.")
+	}
+	return ok && len(rest) > 1 && rest[0] == '_' && !strings.Contains(rest, ".")
+}
+
+func (c *mdnsCache) addAddr(host, addr string) bool {
+	if c.addrs[host] == nil {
+		c.addrs[host] = map[string]bool{}
+	}
+	news := !c.addrs[host][addr]
+	c.addrs[host][addr] = true
+	return news
+}
+
+// questions lists what is still missing: the service types, the instances
+// of each type, where each instance lives and the addresses of its host.
+func (c *mdnsCache) questions() []dnsmessage.Question {
+	var qs []dnsmessage.Question
+	ask := func(name string, t dnsmessage.Type) {
+		n, err := dnsmessage.NewName(name)
+		if err == nil {
+			qs = append(qs, dnsmessage.Question{Name: n, Type: t, Class: dnsmessage.ClassINET})
+		}
+	}
+	ask(mdnsServices, dnsmessage.TypePTR)
+	for t := range c.types {
+		ask(t, dnsmessage.TypePTR)
+	}
+	for inst := range c.instances {
+		srv, ok := c.srv[inst]
+		if !ok {
+			ask(c.names[inst], dnsmessage.TypeSRV)
+		}
+		if _, ok := c.txt[inst]; !ok {
+			ask(c.names[inst], dnsmessage.TypeTXT)
+		}
+		if host := strings.ToLower(srv.Target.String()); ok && len(c.addrs[host]) == 0 {
+			ask(host, dnsmessage.TypeA)
+			ask(host, dnsmessage.TypeAAAA)
+		}
+	}
+	return qs
+}
+
+func (c *mdnsCache) service(inst string) MDNSService {
+	typ := c.instances[inst]
+	name := c.names[inst]
+	s := MDNSService{
+		Name: strings.TrimSuffix(name[:max(len(name)-len(typ), 0)], "."),
+		Type: strings.TrimSuffix(typ, ".local."),
+		TXT:  c.txt[inst],
+	}
+	if s.Name == "" {
+		s.Name = strings.TrimSuffix(name, ".")
+	}
+	if srv, ok := c.srv[inst]; ok {
+		host := srv.Target.String()
+		s.Host = strings.TrimSuffix(host, ".")
+		s.Port = int(srv.Port)
+		for a := range c.addrs[strings.ToLower(host)] {
+			s.Addrs = append(s.Addrs, a)
+		}
+		sort.Slice(s.Addrs, func(i, j int) bool { return addressLess(s.Addrs[i], s.Addrs[j]) })
+	}
+	return s
+}
+
+// resolved returns the instances that have become complete, a host, port
+// and address, since the last call.
+func (c *mdnsCache) resolved() []MDNSService {
+	var done []MDNSService
+	for inst := range c.instances {
+		if c.reported[inst] {
+			continue
+		}
+		if s := c.service(inst); len(s.Addrs) > 0 {
+			c.reported[inst] = true
+			done = append(done, s)
+		}
+	}
+	return done
+}
+
+func (c *mdnsCache) services() []MDNSService {
+	var all []MDNSService
+	for inst := range c.instances {
+		all = append(all, c.service(inst))
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Type != all[j].Type {
+			return all[i].Type < all[j].Type
+		}
+		return all[i].Name < all[j].Name
+	})
+	return all
+}
+
+// BrowseMDNS collects the services devices on the local network announce
+// over multicast DNS for wait. Actively, it asks for every service type
+// (_services._dns-sd._udp.local), then for the instances of each type,
+// their SRV and TXT records and their hosts' addresses, asking again each
+// second for whatever is still missing. Passively, it only listens for the
+// announcements devices multicast on their own, which sends nothing but
+// may catch little in a short wait. fn, if not nil, is called with each
+// service as soon as its address is known.
+func BrowseMDNS(ctx context.Context, wait time.Duration, passive bool, fn func(MDNSService)) ([]MDNSService, error) {
+	if wait <= 0 {
+		wait = MDNSDefaultWait
+	}
+	conn, err := net.ListenMulticastUDP("udp4", nil, mdnsGroup)
+	if err != nil {
+		if passive {
+			return nil, fmt.Errorf("listening on the mDNS port: %w", err)
+		}
+		// Another responder holds port 5353 exclusively. Queries from any
+		// other port still get answers, sent back to it directly.
+		if conn, err = net.ListenUDP("udp4", &net.UDPAddr{}); err != nil {
+			return nil, err
+		}
+	}
+	defer conn.Close()
+
+	// Listen and ask on every multicast interface, not just the default.
+	pc := ipv4.NewPacketConn(conn)
+	var ifaces []net.Interface
+	if all, err := net.Interfaces(); err == nil {
+		for _, ifi := range all {
+			if ifi.Flags&net.FlagUp != 0 && ifi.Flags&net.FlagMulticast != 0 {
+				pc.JoinGroup(&ifi, mdnsGroup)
+				ifaces = append(ifaces, ifi)
+			}
+		}
+	}
+	pc.SetMulticastTTL(255)
+
+	cache := newMDNSCache()
+	ask := func() {
+		qs := cache.questions()
+		// Keep each query well inside one packet.
+		for len(qs) > 0 {
+			n := min(len(qs), 20)
+			msg := dnsmessage.Message{Questions: qs[:n]}
+			qs = qs[n:]
+			b, err := msg.Pack()
+			if err != nil {
+				continue
+			}
+			if len(ifaces) == 0 {
+				conn.WriteTo(b, mdnsGroup)
+			}
+			for _, ifi := range ifaces {
+				if pc.SetMulticastInterface(&ifi) == nil {
+					conn.WriteTo(b, mdnsGroup)
+				}
+			}
+		}
+	}
+
+	stop := context.AfterFunc(ctx, func() { conn.SetReadDeadline(time.Now()) })
+	defer stop()
+	end := time.Now().Add(wait)
+	next := time.Now()
+	buf := make([]byte, 9000)
+	for ctx.Err() == nil && time.Now().Before(end) {
+		if !passive && !time.Now().Before(next) {
+			ask()
+			next = time.Now().Add(time.Second)
+		}
+		deadline := end
+		if !passive && next.Before(end) {
+			deadline = next
+		}
+		conn.SetReadDeadline(deadline)
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if isTimeout(err) {
+				continue
+			}
+			if ctx.Err() != nil {
+				break
+			}
+			return cache.services(), err
+		}
+		var msg dnsmessage.Message
+		if msg.Unpack(buf[:n]) != nil || !msg.Response {
+			continue
+		}
+		news := false
+		for _, r := range append(msg.Answers, msg.Additionals...) {
+			news = cache.add(r) || news
+		}
+		// Follow up soon, once the rest of this burst of answers is in.
+		if soon := time.Now().Add(100 * time.Millisecond); news && !passive && soon.Before(next) {
+			next = soon
+		}
+		if fn != nil {
+			for _, s := range cache.resolved() {
+				fn(s)
+			}
+		}
+	}
+	return cache.services(), ctx.Err()
+}
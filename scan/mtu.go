@@ -0,0 +1,144 @@
+package scan
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// echoOverhead is the size of the IPv4 and ICMP headers of an echo.
+const echoOverhead = 28
+
+// minMTU is the smallest MTU every IPv4 link must support.
+const minMTU = 68
+
+// PathMTU is what path MTU discovery found.
+type PathMTU struct {
+	Host    string `json:"host"`
+	Addr    string `json:"addr"`
+	MTU     int    `json:"mtu"`      // largest IPv4 packet, headers included, that got there and back
+	LinkMTU int    `json:"link_mtu"` // MTU of the local interface towards the host
+	Probes  int    `json:"probes"`
+}
+
+// mtuProber sends echoes with the don't-fragment bit set.
+type mtuProber interface {
+	// probe sends an echo that makes an IPv4 packet of size bytes and
+	// waits up to timeout for the reply.
+	probe(ctx context.Context, size, seq int, timeout time.Duration) (mtuReply, error)
+}
+
+// mtuReply is the outcome of one probe.
+type mtuReply struct {
+	fits    bool // the echo came back
+	refused bool // the local stack or a router said it was too big
+	mtu     int  // the MTU they reported, 0 if they did not
+}
+
+// PathMTU finds the largest packet that reaches host and comes back without
+// being fragmented, by a binary search over echoes with the don't-fragment
+// bit set, between the smallest IPv4 MTU and that of the outgoing
+// interface. go-ping cannot set the bit, so it is only used for a first
+// plain ping: the host must answer, or lost probes could not be put down to
+// their size. fn, if not nil, is told the outcome of each size tried.
+func (e *Engine) PathMTU(ctx context.Context, host string, fn func(size int, fits bool)) (*PathMTU, error) {
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip4", host)
+	if err != nil {
+		return nil, err
+	}
+	dst := ips[0].To4()
+	result := &PathMTU{Host: host, Addr: dst.String(), LinkMTU: linkMTU(dst)}
+
+	p, err := newMTUProber(dst)
+	if err != nil {
+		return result, err
+	}
+	if _, err := e.ICMPMode(); err != nil {
+		return result, err
+	}
+	if !e.Ping(ctx, host) {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		return result, fmt.Errorf("%s does not answer pings, so its path MTU cannot be probed", host)
+	}
+
+	seq := 0
+	try := func(size int) (mtuReply, error) {
+		var reply mtuReply
+		var err error
+		e.retry(ctx, ProbeICMP, func() (bool, bool, error) {
+			if err = e.send(ctx); err != nil {
+				return false, false, err
+			}
+			reply, err = p.probe(ctx, size, seq, e.timeout(host))
+			seq++
+			result.Probes++
+			return reply.fits, reply.fits || reply.refused, err
+		})
+		if err == nil {
+			err = ctx.Err()
+		}
+		if err == nil && fn != nil {
+			fn(size, reply.fits)
+		}
+		return reply, err
+	}
+
+	// Most paths carry what the link does, so that is tried first. A
+	// router that refuses a packet says how big it may be, and that is
+	// tried next.
+	lo, hi := minMTU, result.LinkMTU
+	size := hi
+	answered := false
+	for {
+		reply, err := try(size)
+		if err != nil {
+			return result, err
+		}
+		switch {
+		case reply.fits:
+			lo, answered = size, true
+		case reply.refused && reply.mtu >= lo && reply.mtu < size:
+			// Nothing bigger gets past the router that said so.
+			hi = reply.mtu
+		default:
+			hi = size - 1
+		}
+		if lo >= hi {
+			break
+		}
+		size = (lo + hi + 1) / 2
+		if reply.refused && hi == reply.mtu {
+			size = hi
+		}
+	}
+	if !answered {
+		return result, fmt.Errorf("no probe of %d bytes or more came back from %s", minMTU, host)
+	}
+	result.MTU = lo
+	return result, nil
+}
+
+// linkMTU returns the MTU of the interface packets to dst leave by, or 1500
+// if it cannot be told.
+func linkMTU(dst net.IP) int {
+	src, err := sourceFor(dst)
+	if err != nil {
+		return 1500
+	}
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return 1500
+	}
+	for _, iface := range ifaces {
+		addrs, _ := iface.Addrs()
+		for _, a := range addrs {
+			if ipnet, ok := a.(*net.IPNet); ok && ipnet.IP.Equal(src) {
+				return min(iface.MTU, 65535)
+			}
+		}
+	}
+	return 1500
+}
@@ -0,0 +1,128 @@
+//go:build linux
+
+package scan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/sys/unix"
+)
+
+// dfProber sends every echo from a socket of its own with
+// IP_PMTUDISC_PROBE, which sets the don't-fragment bit and ignores the
+// path MTU the kernel has cached, and learns about packets that were too
+// big from the errors queued on the socket. It uses the unprivileged ping
+// socket and falls back to a raw socket.
+type dfProber struct {
+	dst net.IP
+	raw bool
+	id  int // echo identifier on a raw socket
+}
+
+func newMTUProber(dst net.IP) (mtuProber, error) {
+	p := &dfProber{dst: dst, id: os.Getpid() & 0xffff}
+	fd, err := p.socket()
+	if permissionError(err) {
+		p.raw = true
+		fd, err = p.socket()
+	}
+	if err != nil {
+		if permissionError(err) {
+			return nil, fmt.Errorf("ICMP sockets are not permitted: allow your group in net.ipv4.ping_group_range, or %w", errRawDenied)
+		}
+		return nil, err
+	}
+	unix.Close(fd)
+	return p, nil
+}
+
+func (p *dfProber) socket() (int, error) {
+	typ := unix.SOCK_DGRAM
+	if p.raw {
+		typ = unix.SOCK_RAW
+	}
+	fd, err := icmpSocket(typ, unix.IPPROTO_ICMP, 64)
+	if err != nil {
+		return -1, err
+	}
+	if err := unix.SetsockoptInt(fd, unix.IPPROTO_IP, unix.IP_MTU_DISCOVER, unix.IP_PMTUDISC_PROBE); err != nil {
+		unix.Close(fd)
+		return -1, err
+	}
+	return fd, nil
+}
+
+func (p *dfProber) probe(ctx context.Context, size, seq int, timeout time.Duration) (mtuReply, error) {
+	fd, err := p.socket()
+	if err != nil {
+		return mtuReply{}, err
+	}
+	defer unix.Close(fd)
+
+	msg := icmp.Message{Type: ipv4.ICMPTypeEcho, Body: &icmp.Echo{ID: p.id, Seq: seq, Data: make([]byte, size-echoOverhead)}}
+	b, err := msg.Marshal(nil)
+	if err != nil {
+		return mtuReply{}, err
+	}
+	to := &unix.SockaddrInet4{}
+	copy(to.Addr[:], p.dst)
+	if err := unix.Sendto(fd, b, 0, to); err != nil {
+		if errors.Is(err, unix.EMSGSIZE) {
+			return mtuReply{refused: true}, nil // bigger than the interface takes
+		}
+		return mtuReply{}, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	buf := make([]byte, 65536)
+	for {
+		events, err := waitSocket(ctx, fd, deadline)
+		if err != nil || events == 0 {
+			return mtuReply{}, err
+		}
+		if events&unix.POLLERR != 0 {
+			e, ok := readSockError(fd)
+			switch {
+			case !ok:
+			case e.errno == unix.EMSGSIZE:
+				// Fragmentation needed, from a router or the local stack.
+				reply := mtuReply{refused: true}
+				if mtu := int(e.info); mtu >= minMTU && mtu < size {
+					reply.mtu = mtu
+				}
+				return reply, nil
+			case e.origin == unix.SO_EE_ORIGIN_ICMP && e.typ == 3:
+				return mtuReply{}, fmt.Errorf("%s reported %s unreachable (%s)", e.from, p.dst, unreachableFlag(int(e.code), e.from, p.dst))
+			}
+			continue
+		}
+
+		n, _, err := unix.Recvfrom(fd, buf, unix.MSG_DONTWAIT)
+		if err != nil {
+			continue
+		}
+		data := buf[:n]
+		if p.raw {
+			// Raw sockets see every ICMP message, IP header included.
+			ihl := int(data[0]&0x0f) * 4
+			if len(data) < ihl {
+				continue
+			}
+			data = data[ihl:]
+		}
+		reply, err := icmp.ParseMessage(1, data)
+		if err != nil || reply.Type != ipv4.ICMPTypeEchoReply {
+			continue
+		}
+		if echo, ok := reply.Body.(*icmp.Echo); ok && echo.Seq == seq && (!p.raw || echo.ID == p.id) {
+			return mtuReply{fits: true}, nil
+		}
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package scan
+
+import (
+	"errors"
+	"net"
+)
+
+// newMTUProber fails: there is no portable way to set the don't-fragment
+// bit on ICMP echoes outside Linux.
+func newMTUProber(dst net.IP) (mtuProber, error) {
+	return nil, errors.New("path MTU discovery is only supported on Linux")
+}
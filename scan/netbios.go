@@ -0,0 +1,178 @@
+package scan
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NetBIOSInfo is what a host's NetBIOS name service says about it.
+type NetBIOSInfo struct {
+	Name      string   `json:"name,omitempty" xml:"name,attr,omitempty"`           // computer name
+	Workgroup string   `json:"workgroup,omitempty" xml:"workgroup,attr,omitempty"` // or domain
+	MAC       string   `json:"mac,omitempty" xml:"mac,attr,omitempty"`
+	Names     []string `json:"names,omitempty" xml:"nbname"` // every registered name, as NAME<suffix>
+}
+
+func (n NetBIOSInfo) String() string {
+	parts := []string{n.Name}
+	if n.Workgroup != "" {
+		parts = append(parts, "workgroup "+n.Workgroup)
+	}
+	if n.MAC != "" {
+		parts = append(parts, "MAC "+n.MAC)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// nbstatQuery is a node status request for the wildcard name "*", which
+// every NetBIOS host answers with its name table.
+var nbstatQuery = func() []byte {
+	b := []byte{
+		0, 0, // transaction ID, filled in per query
+		0, 0, // flags: a query
+		0, 1, // one question
+		0, 0, 0, 0, 0, 0,
+		32, // the encoded name: "*" padded with zeroes, a nibble per letter
+	}
+	name := make([]byte, 16)
+	name[0] = '*'
+	for _, c := range name {
+		b = append(b, 'A'+c>>4, 'A'+c&0x0f)
+	}
+	return append(b, 0, 0, 0x21, 0, 1) // NBSTAT, IN
+}()
+
+// NetBIOSSweep sends a NetBIOS node status query to UDP port 137 of every
+// address in ips, Timing.Concurrency at a time, and calls fn for each host
+// that answers. Windows hosts that ignore pings usually still answer.
+// Calls to fn are serialized; cancellation works as for Sweep.
+func (e *Engine) NetBIOSSweep(ctx context.Context, ips []string, fn func(ip string, info NetBIOSInfo)) error {
+	var mu sync.Mutex
+	return e.each(ctx, len(ips), func(i int) {
+		info, err := e.NetBIOSStatus(ctx, ips[i])
+		if err != nil {
+			return
+		}
+		mu.Lock()
+		fn(ips[i], *info)
+		mu.Unlock()
+	})
+}
+
+// NetBIOSStatus asks host for its NetBIOS name table: its computer name,
+// workgroup or domain and the MAC address it reports.
+func (e *Engine) NetBIOSStatus(ctx context.Context, host string) (*NetBIOSInfo, error) {
+	var info *NetBIOSInfo
+	var lastErr error
+	e.retry(ctx, ProbeUDP, func() (bool, bool, error) {
+		info, lastErr = e.nbstat(ctx, host)
+		return udpAttempt(ctx, lastErr)
+	})
+	if info == nil && lastErr == nil {
+		lastErr = ctx.Err()
+	}
+	return info, lastErr
+}
+
+func (e *Engine) nbstat(ctx context.Context, host string) (*NetBIOSInfo, error) {
+	if err := e.send(ctx); err != nil {
+		return nil, err
+	}
+	timeout := e.timeout(host)
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp4", net.JoinHostPort(host, "137"))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	query := append([]byte(nil), nbstatQuery...)
+	id := uint16(rand.Intn(1 << 16))
+	binary.BigEndian.PutUint16(query, id)
+	start := time.Now()
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 1500)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, err
+		}
+		if n < 2 || binary.BigEndian.Uint16(buf) != id {
+			continue
+		}
+		e.rtt.observe(host, time.Since(start))
+		return parseNBStat(buf[:n])
+	}
+}
+
+var errNBStat = errors.New("malformed NetBIOS node status response")
+
+// parseNBStat reads the name table and MAC address out of a node status
+// response.
+func parseNBStat(b []byte) (*NetBIOSInfo, error) {
+	// The header, the name asked about (or a pointer to it), then type,
+	// class, TTL and length.
+	if len(b) < 13 || b[2]&0x80 == 0 {
+		return nil, errNBStat
+	}
+	nameEnd := 12 + 2
+	if b[12]&0xc0 != 0xc0 {
+		nameEnd = 12 + 1 + int(b[12]) + 1
+	}
+	if len(b) < nameEnd+10+1 {
+		return nil, errNBStat
+	}
+	if rcode := b[3] & 0x0f; rcode != 0 {
+		return nil, fmt.Errorf("NetBIOS name service answered error %d", rcode)
+	}
+	p := b[nameEnd+10:]
+	count := int(p[0])
+	p = p[1:]
+	if len(p) < count*18 {
+		return nil, errNBStat
+	}
+	info := &NetBIOSInfo{}
+	for i := 0; i < count; i++ {
+		entry := p[i*18 : i*18+18]
+		name := strings.TrimRight(string(entry[:15]), " \x00")
+		suffix := entry[15]
+		group := entry[16]&0x80 != 0
+		info.Names = append(info.Names, fmt.Sprintf("%s<%02x>", name, suffix))
+		switch {
+		// The workstation service registers the computer name as a unique
+		// name and the workgroup as a group name, both with suffix 00.
+		case suffix == 0x00 && !group && info.Name == "":
+			info.Name = name
+		case suffix == 0x00 && group && info.Workgroup == "":
+			info.Workgroup = name
+		case suffix == 0x20 && !group && info.Name == "":
+			info.Name = name
+		}
+	}
+	// The statistics after the names start with the adapter's MAC address,
+	// which Samba leaves zero.
+	if stats := p[count*18:]; len(stats) >= 6 {
+		if mac := net.HardwareAddr(stats[:6]); strings.Trim(mac.String(), "0:") != "" {
+			info.MAC = mac.String()
+		}
+	}
+	if info.Name == "" && len(info.Names) == 0 {
+		return nil, errNBStat
+	}
+	return info, nil
+}
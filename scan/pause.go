@@ -0,0 +1,72 @@
+package scan
+
+import (
+	"context"
+	"sync"
+)
+
+// gate holds probes back while a scan is paused.
+type gate struct {
+	mu     sync.Mutex
+	paused bool
+	resume chan struct{}
+}
+
+func (g *gate) pause() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.paused {
+		g.paused = true
+		g.resume = make(chan struct{})
+	}
+}
+
+func (g *gate) unpause() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.paused {
+		g.paused = false
+		close(g.resume)
+	}
+}
+
+func (g *gate) isPaused() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.paused
+}
+
+// wait blocks while the gate is paused or until ctx is cancelled.
+func (g *gate) wait(ctx context.Context) error {
+	g.mu.Lock()
+	if !g.paused {
+		g.mu.Unlock()
+		return ctx.Err()
+	}
+	resume := g.resume
+	g.mu.Unlock()
+
+	select {
+	case <-resume:
+		return ctx.Err()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Pause stops the engine from sending new probes. Probes already on the
+// wire finish normally; everything else waits until Resume is called or the
+// scan's context is cancelled.
+func (e *Engine) Pause() {
+	e.gate.pause()
+}
+
+// Resume lets a paused engine carry on where it stopped.
+func (e *Engine) Resume() {
+	e.gate.unpause()
+}
+
+// Paused reports whether the engine is paused.
+func (e *Engine) Paused() bool {
+	return e.gate.isPaused()
+}
@@ -0,0 +1,349 @@
+package scan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/go-ping/ping"
+	"golang.org/x/net/icmp"
+)
+
+// ICMP echo modes.
+const (
+	ICMPDatagram = "datagram" // an unprivileged ping socket
+	ICMPRaw      = "raw"      // a raw socket, for root or CAP_NET_RAW
+)
+
+// ErrICMPDenied is returned when the system allows neither kind of ICMP
+// socket, rather than reporting every host as down.
+var ErrICMPDenied = errors.New("ICMP echoes are not permitted: run as root or with CAP_NET_RAW, " +
+	"or allow unprivileged ping sockets for your group with sysctl net.ipv4.ping_group_range")
+
+// icmpDatagram and icmpRaw say why each kind of ICMP socket cannot be
+// opened, or nil if it can.
+var (
+	icmpDatagram = sync.OnceValue(func() error { return tryICMP("udp4") })
+	icmpRaw      = sync.OnceValue(func() error { return tryICMP("ip4:icmp") })
+)
+
+func tryICMP(network string) error {
+	c, err := icmp.ListenPacket(network, "0.0.0.0")
+	if err != nil {
+		return err
+	}
+	return c.Close()
+}
+
+// PingStatus says how pinging a host ended.
+type PingStatus string
+
+// Ping statuses.
+const (
+	PingAlive       PingStatus = "alive"       // an echo was answered
+	PingTimeout     PingStatus = "timeout"     // no echo was answered in time
+	PingUnreachable PingStatus = "unreachable" // a router, or the local stack, reported the host unreachable
+	PingResolve     PingStatus = "resolve"     // the host name did not resolve
+	PingDenied      PingStatus = "denied"      // no ICMP socket may be opened
+	PingFailed      PingStatus = "failed"      // sending failed some other way, or the ping was cancelled
+)
+
+// PingResult is the outcome of pinging one host.
+type PingResult struct {
+	Host   string
+	Addr   string // resolved address, empty if Host did not resolve
+	Status PingStatus
+	RTT    time.Duration // of the reply, for PingAlive
+	TTL    int           // of the reply, for PingAlive; 0 where unknown
+	Reason string        // what was unreachable, e.g. "host unreachable", for PingUnreachable
+	From   string        // who reported it, for PingUnreachable; empty for the local stack
+	Err    error         // for PingResolve, PingDenied and PingFailed
+}
+
+// Alive reports whether the host answered.
+func (r PingResult) Alive() bool {
+	return r.Status == PingAlive
+}
+
+// String describes the outcome in a few words, e.g. "no reply" or
+// "host unreachable, reported by 10.0.0.1".
+func (r PingResult) String() string {
+	switch r.Status {
+	case PingAlive:
+		return fmt.Sprintf("alive, %.3f ms", float64(r.RTT)/float64(time.Millisecond))
+	case PingTimeout:
+		return "no reply"
+	case PingUnreachable:
+		if r.From != "" {
+			return fmt.Sprintf("%s, reported by %s", r.Reason, r.From)
+		}
+		return r.Reason
+	}
+	if r.Err == nil {
+		return string(r.Status)
+	}
+	return r.Err.Error()
+}
+
+// PingErrorStatus classifies an error from pinging: PingResolve when the
+// host name did not resolve, PingDenied when ICMP is not permitted and
+// PingFailed otherwise.
+func PingErrorStatus(err error) PingStatus {
+	var dnsErr *net.DNSError
+	switch {
+	case errors.As(err, &dnsErr):
+		return PingResolve
+	case errors.Is(err, ErrICMPDenied), errors.Is(err, errRawDenied), permissionError(err):
+		return PingDenied
+	}
+	return PingFailed
+}
+
+// unreachableReason names an ICMP destination unreachable code.
+func unreachableReason(code int) string {
+	switch code {
+	case 0:
+		return "network unreachable"
+	case 1:
+		return "host unreachable"
+	case 2:
+		return "protocol unreachable"
+	case 3:
+		return "port unreachable"
+	case 4:
+		return "fragmentation needed"
+	case 9, 10, 13:
+		return "administratively prohibited"
+	}
+	return fmt.Sprintf("destination unreachable (code %d)", code)
+}
+
+// echoReply is what came back from one echo request: a reply, a
+// destination unreachable, or neither when nothing came in time.
+type echoReply struct {
+	alive       bool
+	rtt         time.Duration
+	ttl         int // of the reply, where known
+	unreachable bool
+	code        int    // of the destination unreachable
+	from        net.IP // who sent it, nil when the local stack refused to send
+}
+
+// goPing sends one echo request with go-ping, which does not report
+// destination unreachables.
+func goPing(ctx context.Context, addr *net.IPAddr, raw bool, timeout time.Duration) (echoReply, error) {
+	pinger := ping.New("")
+	pinger.SetIPAddr(addr)
+	pinger.SetPrivileged(raw)
+	pinger.Count = 1
+	pinger.Timeout = timeout
+	var reply echoReply
+	pinger.OnRecv = func(pkt *ping.Packet) {
+		reply = echoReply{alive: true, rtt: pkt.Rtt, ttl: pkt.Ttl}
+	}
+
+	stop := context.AfterFunc(ctx, pinger.Stop)
+	defer stop()
+	if err := pinger.Run(); err != nil {
+		return echoReply{}, err
+	}
+	if ctx.Err() != nil {
+		return echoReply{}, ctx.Err()
+	}
+	return reply, nil
+}
+
+// ICMPMode returns the kind of socket echoes are sent from: an
+// unprivileged datagram socket where the system allows one, which the
+// kernel hands only the replies meant for it, and a raw socket otherwise
+// or when Privileged is set. It fails when that socket cannot be opened.
+func (e *Engine) ICMPMode() (string, error) {
+	if !e.Privileged && icmpDatagram() == nil {
+		return ICMPDatagram, nil
+	}
+	err := icmpRaw()
+	switch {
+	case err == nil:
+		return ICMPRaw, nil
+	case !permissionError(err):
+		return "", fmt.Errorf("opening an ICMP socket: %w", err)
+	case e.Privileged:
+		return "", fmt.Errorf("privileged ICMP: %w", errRawDenied)
+	}
+	return "", ErrICMPDenied
+}
+
+// PingStats summarises a series of ICMP echoes to one host. It keeps
+// running totals rather than every round-trip time, so a series that runs
+// until it is cancelled takes constant memory.
+type PingStats struct {
+	Host     string
+	Addr     string // resolved address
+	Sent     int
+	Received int
+	Loss     float64 // fraction of echoes left unanswered, 0 to 1
+	Min      time.Duration
+	Avg      time.Duration
+	Max      time.Duration
+	StdDev   time.Duration
+	Jitter   time.Duration // mean difference between consecutive round-trip times
+	// Unreachable counts the lost echoes that were answered with a
+	// destination unreachable.
+	Unreachable int
+
+	mean, m2 float64       // Welford's running mean and sum of squared deviations, in nanoseconds
+	last     time.Duration // the previous round-trip time
+	diffs    time.Duration // sum of differences between consecutive round-trip times
+}
+
+// Up reports whether any echo was answered.
+func (s PingStats) Up() bool {
+	return s.Received > 0
+}
+
+// Status sums up the series as a ping would: PingAlive if any echo was
+// answered, PingUnreachable if none was but some came back unreachable,
+// and PingTimeout otherwise.
+func (s PingStats) Status() PingStatus {
+	switch {
+	case s.Up():
+		return PingAlive
+	case s.Unreachable > 0:
+		return PingUnreachable
+	}
+	return PingTimeout
+}
+
+// Add counts e in s, so the statistics can be kept up to date while a
+// series is still running.
+func (s *PingStats) Add(e Echo) {
+	s.Sent++
+	if !e.Lost {
+		s.Received++
+	}
+	s.Loss = 1 - float64(s.Received)/float64(s.Sent)
+	if e.Lost {
+		if e.Unreachable != "" {
+			s.Unreachable++
+		}
+		return
+	}
+	if s.Addr == "" {
+		s.Addr = e.Addr
+	}
+
+	if s.Received == 1 {
+		s.Min, s.Max = e.RTT, e.RTT
+	} else {
+		s.Min = min(s.Min, e.RTT)
+		s.Max = max(s.Max, e.RTT)
+		d := e.RTT - s.last
+		if d < 0 {
+			d = -d
+		}
+		s.diffs += d
+		s.Jitter = s.diffs / time.Duration(s.Received-1)
+	}
+	s.last = e.RTT
+
+	x := float64(e.RTT)
+	delta := x - s.mean
+	s.mean += delta / float64(s.Received)
+	s.m2 += delta * (x - s.mean)
+	s.Avg = time.Duration(s.mean)
+	s.StdDev = time.Duration(math.Sqrt(s.m2 / float64(s.Received)))
+}
+
+// Echo is the outcome of one echo in a series.
+type Echo struct {
+	Seq  int
+	Addr string
+	RTT  time.Duration
+	TTL  int
+	Lost bool // no reply came within the probe timeout
+	// Unreachable says why the echo was lost when a destination
+	// unreachable came back instead of a reply, e.g. "host unreachable".
+	Unreachable string
+	From        string // who reported it; empty for the local stack
+}
+
+// PingCount sends count ICMP echoes to host, interval apart, and waits up to
+// the probe timeout for the last reply. Unlike Ping it does not retry: lost
+// echoes are what it measures.
+func (e *Engine) PingCount(ctx context.Context, host string, count int, interval time.Duration) (PingStats, error) {
+	return e.PingSeries(ctx, host, count, interval, nil)
+}
+
+// PingSeries sends count echoes to host, interval apart, or keeps going
+// until ctx is cancelled when count is 0. fn, if not nil, is called once
+// for every echo, when it is answered, when a destination unreachable
+// comes back for it or when the probe timeout passes without either;
+// calls are serialized. Every echo takes its turn with the
+// rate limiter. The statistics are built from the same echoes and cover the
+// whole series, also when it was cut short by ctx, in which case the error
+// is ctx.Err(); echoes still in flight then are left out.
+func (e *Engine) PingSeries(ctx context.Context, host string, count int, interval time.Duration, fn func(Echo)) (PingStats, error) {
+	stats := PingStats{Host: host}
+	mode, err := e.ICMPMode()
+	if err != nil {
+		return stats, err
+	}
+	addr, err := net.ResolveIPAddr("ip", host)
+	if err != nil {
+		return stats, err
+	}
+	stats.Addr = addr.String()
+	timeout := e.timeout(host)
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var sendErr error
+	for seq := 0; count == 0 || seq < count; seq++ {
+		if seq > 0 && sleep(ctx, interval) != nil {
+			break
+		}
+		if e.send(ctx) != nil {
+			break
+		}
+		wg.Add(1)
+		go func(seq int) {
+			defer wg.Done()
+			reply, err := echo(ctx, addr, mode == ICMPRaw, timeout)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case ctx.Err() != nil:
+				return
+			case err != nil:
+				if sendErr == nil {
+					sendErr = err
+				}
+				return
+			}
+			ev := Echo{Seq: seq, Addr: stats.Addr, RTT: reply.rtt, TTL: reply.ttl, Lost: !reply.alive}
+			if reply.unreachable {
+				ev.Unreachable = unreachableReason(reply.code)
+				if reply.from != nil {
+					ev.From = reply.from.String()
+				}
+			}
+			stats.Add(ev)
+			if fn != nil {
+				fn(ev)
+			}
+		}(seq)
+	}
+	wg.Wait()
+
+	if stats.Received > 0 {
+		e.rtt.observe(host, stats.Avg)
+	}
+	if err := ctx.Err(); err != nil {
+		return stats, err
+	}
+	return stats, sendErr
+}
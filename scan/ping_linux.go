@@ -0,0 +1,127 @@
+//go:build linux
+
+package scan
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"net"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/sys/unix"
+)
+
+// echoPayload is the body of echo requests, as long as ping(8)'s.
+var echoPayload = make([]byte, 56)
+
+// echo sends one echo request to addr from a socket of its own and waits
+// up to timeout for the reply or for a destination unreachable about it,
+// which the kernel queues on the socket with IP_RECVERR, like ping(8).
+// IPv6 hosts are pinged with go-ping.
+func echo(ctx context.Context, addr *net.IPAddr, raw bool, timeout time.Duration) (echoReply, error) {
+	dst := addr.IP.To4()
+	if dst == nil {
+		return goPing(ctx, addr, raw, timeout)
+	}
+	typ := unix.SOCK_DGRAM
+	if raw {
+		typ = unix.SOCK_RAW
+	}
+	fd, err := icmpSocket(typ, unix.IPPROTO_ICMP, 64)
+	if err != nil {
+		return echoReply{}, err
+	}
+	defer unix.Close(fd)
+	if !raw {
+		// A ping socket strips the IP header; have the TTL passed along.
+		if err := unix.SetsockoptInt(fd, unix.IPPROTO_IP, unix.IP_RECVTTL, 1); err != nil {
+			return echoReply{}, err
+		}
+	}
+
+	// The kernel sets the identifier on a ping socket. A raw socket sees
+	// every echo reply the host gets, so its echoes carry a random one.
+	id, seq := rand.Intn(0x10000), rand.Intn(0x10000)
+	msg := icmp.Message{Type: ipv4.ICMPTypeEcho, Body: &icmp.Echo{ID: id, Seq: seq, Data: echoPayload}}
+	b, err := msg.Marshal(nil)
+	if err != nil {
+		return echoReply{}, err
+	}
+	to := &unix.SockaddrInet4{}
+	copy(to.Addr[:], dst)
+	sent := time.Now()
+	if err := unix.Sendto(fd, b, 0, to); err != nil {
+		switch {
+		case errors.Is(err, unix.ENETUNREACH):
+			return echoReply{unreachable: true, code: 0}, nil // no route
+		case errors.Is(err, unix.EHOSTUNREACH):
+			return echoReply{unreachable: true, code: 1}, nil
+		}
+		return echoReply{}, err
+	}
+
+	deadline := sent.Add(timeout)
+	buf := make([]byte, 1500)
+	oob := make([]byte, 64)
+	for {
+		events, err := waitSocket(ctx, fd, deadline)
+		if err != nil || events == 0 {
+			return echoReply{}, err
+		}
+		if events&unix.POLLERR != 0 {
+			e, ok := readSockError(fd)
+			if ok && e.origin == unix.SO_EE_ORIGIN_ICMP && e.typ == 3 {
+				return echoReply{unreachable: true, code: int(e.code), from: e.from}, nil
+			}
+			continue
+		}
+
+		n, oobn, _, from, err := unix.Recvmsg(fd, buf, oob, unix.MSG_DONTWAIT)
+		if err != nil || n == 0 {
+			continue
+		}
+		at := time.Now()
+		data := buf[:n]
+		var ttl int
+		if raw {
+			// Raw sockets see every ICMP message, IP header included.
+			if sa, ok := from.(*unix.SockaddrInet4); !ok || !net.IP(sa.Addr[:]).Equal(dst) {
+				continue
+			}
+			ihl := int(data[0]&0x0f) * 4
+			if ihl < ipv4.HeaderLen || len(data) < ihl {
+				continue
+			}
+			ttl = int(data[8])
+			data = data[ihl:]
+		} else {
+			ttl = recvTTL(oob[:oobn])
+		}
+		reply, err := icmp.ParseMessage(1, data)
+		if err != nil || reply.Type != ipv4.ICMPTypeEchoReply {
+			continue
+		}
+		if body, ok := reply.Body.(*icmp.Echo); ok && body.Seq == seq && (!raw || body.ID == id) {
+			return echoReply{alive: true, rtt: at.Sub(sent), ttl: ttl}, nil
+		}
+	}
+}
+
+// recvTTL returns the TTL from the IP_TTL control message that IP_RECVTTL
+// adds to a received datagram, or 0 if there is none.
+func recvTTL(oob []byte) int {
+	msgs, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		return 0
+	}
+	for _, m := range msgs {
+		if m.Header.Level == unix.IPPROTO_IP && m.Header.Type == unix.IP_TTL && len(m.Data) >= 4 {
+			return int(binary.NativeEndian.Uint32(m.Data))
+		}
+	}
+	return 0
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package scan
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// echo sends one echo request to addr. Outside Linux the ICMP errors an
+// echo provokes are not reported to unprivileged sockets, so a host that
+// is unreachable looks like one that does not answer.
+func echo(ctx context.Context, addr *net.IPAddr, raw bool, timeout time.Duration) (echoReply, error) {
+	return goPing(ctx, addr, raw, timeout)
+}
@@ -0,0 +1,32 @@
+package scan
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestPingStats(t *testing.T) {
+	var s PingStats
+	for i, ms := range []int{10, 0, 30, 20, 40} {
+		s.Add(Echo{Seq: i, Addr: "192.0.2.1", RTT: time.Duration(ms) * time.Millisecond, Lost: ms == 0})
+	}
+	// Round trips of 10, 30, 20 and 40ms: a mean of 25ms, a variance of
+	// 125ms² and consecutive differences of 20, 10 and 20ms.
+	ms := time.Millisecond
+	if s.Addr != "192.0.2.1" || s.Sent != 5 || s.Received != 4 || math.Abs(s.Loss-0.2) > 1e-9 {
+		t.Errorf("stats %+v, want 4 of 5 from 192.0.2.1", s)
+	}
+	if s.Min != 10*ms || s.Avg != 25*ms || s.Max != 40*ms || s.Jitter != 50*ms/3 {
+		t.Errorf("min/avg/max/jitter = %v/%v/%v/%v, want 10ms/25ms/40ms/16.666ms", s.Min, s.Avg, s.Max, s.Jitter)
+	}
+	if want := time.Duration(math.Sqrt(125) * float64(ms)); s.StdDev-want > time.Microsecond || want-s.StdDev > time.Microsecond {
+		t.Errorf("StdDev = %v, want %v", s.StdDev, want)
+	}
+
+	var lost PingStats
+	lost.Add(Echo{Lost: true})
+	if lost.Up() || lost.Loss != 1 || lost.Avg != 0 {
+		t.Errorf("stats after one lost echo = %+v, want down with full loss", lost)
+	}
+}
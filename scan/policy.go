@@ -0,0 +1,327 @@
+package scan
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Policy is the expected state of a network: which hosts may answer and
+// which ports each of them may or must expose.
+//
+//	unknown_hosts: deny        # hosts no rule covers are violations (default)
+//	rules:
+//	  - target: 10.1.2.0/24
+//	    allow: [22, 443]
+//	  - target: 10.1.2.10
+//	    allow: [22, 443, "8000-8010"]
+//	    require: [443]
+//	    required: true         # the host itself must answer
+type Policy struct {
+	UnknownHosts string       `yaml:"unknown_hosts"` // "deny" or "allow"
+	Rules        []PolicyRule `yaml:"rules"`
+}
+
+// PolicyRule sets the expectations for one address, hostname or CIDR
+// network. A host is governed by the most specific rule that covers it.
+type PolicyRule struct {
+	Target   string   `yaml:"target"`
+	Allow    PortList `yaml:"allow"`    // ports that may be open besides the required ones
+	Require  PortList `yaml:"require"`  // ports that must be open
+	Required bool     `yaml:"required"` // the host must answer; only for single hosts
+	Deny     bool     `yaml:"deny"`     // no host in target may answer at all
+
+	network *net.IPNet
+}
+
+// PortList is a list of ports written as numbers or "first-last" ranges.
+type PortList []int
+
+// UnmarshalYAML accepts a sequence of port numbers and ranges, or one
+// comma-separated string of them.
+func (l *PortList) UnmarshalYAML(node *yaml.Node) error {
+	var specs []string
+	if node.Kind == yaml.SequenceNode {
+		for _, n := range node.Content {
+			specs = append(specs, n.Value)
+		}
+	} else {
+		specs = []string{node.Value}
+	}
+	ports, err := ParsePorts(strings.Join(specs, ","))
+	if err != nil {
+		return fmt.Errorf("line %d: %w", node.Line, err)
+	}
+	*l = ports
+	return nil
+}
+
+// ParsePorts reads a port list such as "22,80,8000-8100" and returns the
+// ports in order without duplicates.
+func ParsePorts(spec string) ([]int, error) {
+	seen := map[int]bool{}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		first, last, isRange := strings.Cut(part, "-")
+		lo, err := strconv.Atoi(strings.TrimSpace(first))
+		hi := lo
+		if err == nil && isRange {
+			hi, err = strconv.Atoi(strings.TrimSpace(last))
+		}
+		if err != nil || lo < 1 || hi > 65535 || lo > hi {
+			return nil, fmt.Errorf("invalid port or range %q", part)
+		}
+		for p := lo; p <= hi; p++ {
+			seen[p] = true
+		}
+	}
+	ports := make([]int, 0, len(seen))
+	for p := range seen {
+		ports = append(ports, p)
+	}
+	sort.Ints(ports)
+	return ports, nil
+}
+
+// FormatPorts writes ports back as a compact list with ranges, the inverse
+// of ParsePorts.
+func FormatPorts(ports []int) string {
+	var parts []string
+	for i := 0; i < len(ports); {
+		j := i
+		for j+1 < len(ports) && ports[j+1] == ports[j]+1 {
+			j++
+		}
+		if j > i {
+			parts = append(parts, fmt.Sprintf("%d-%d", ports[i], ports[j]))
+		} else {
+			parts = append(parts, strconv.Itoa(ports[i]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
+
+// LoadPolicy reads and checks a YAML policy file.
+func LoadPolicy(path string) (*Policy, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	p, err := ReadPolicy(f)
+	if err != nil {
+		return nil, fmt.Errorf("policy %s: %w", path, err)
+	}
+	return p, nil
+}
+
+// ReadPolicy reads and checks a YAML policy.
+func ReadPolicy(r io.Reader) (*Policy, error) {
+	var p Policy
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	if err := dec.Decode(&p); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	switch p.UnknownHosts {
+	case "":
+		p.UnknownHosts = "deny"
+	case "allow", "deny":
+	default:
+		return nil, fmt.Errorf("unknown_hosts must be allow or deny, not %q", p.UnknownHosts)
+	}
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		if rule.Target == "" {
+			return nil, fmt.Errorf("rule %d has no target", i+1)
+		}
+		if strings.Contains(rule.Target, "/") {
+			_, network, err := net.ParseCIDR(rule.Target)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: %w", i+1, err)
+			}
+			if ones, bits := network.Mask.Size(); ones == bits {
+				rule.Target = network.IP.String()
+				continue
+			}
+			if rule.Required {
+				return nil, fmt.Errorf("rule %d: required is only allowed for a single host", i+1)
+			}
+			rule.network = network
+		}
+	}
+	return &p, nil
+}
+
+// Ports lists every port the policy mentions.
+func (p *Policy) Ports() []int {
+	var all []int
+	for _, rule := range p.Rules {
+		all = append(all, rule.Allow...)
+		all = append(all, rule.Require...)
+	}
+	return UniquePorts(all)
+}
+
+// UniquePorts sorts ports in place and returns them without duplicates,
+// reusing the slice.
+func UniquePorts(ports []int) []int {
+	sort.Ints(ports)
+	out := ports[:0]
+	for i, p := range ports {
+		if i == 0 || p != ports[i-1] {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// rule returns the most specific rule covering address: an exact match,
+// then the covering network with the longest prefix. It returns nil if no
+// rule applies.
+func (p *Policy) rule(address string) *PolicyRule {
+	var best *PolicyRule
+	bestOnes := -1
+	ip := net.ParseIP(address)
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		if rule.network == nil {
+			if rule.Target == address || (ip != nil && ip.Equal(net.ParseIP(rule.Target))) {
+				return rule
+			}
+			continue
+		}
+		if ip == nil || !rule.network.Contains(ip) {
+			continue
+		}
+		if ones, _ := rule.network.Mask.Size(); ones > bestOnes {
+			best, bestOnes = rule, ones
+		}
+	}
+	return best
+}
+
+// Violation is one way a scan departs from the policy.
+type Violation struct {
+	Kind    string `json:"kind"` // "unexpected-host", "missing-host", "unexpected-port" or "missing-port"
+	Address string `json:"address"`
+	Port    int    `json:"port,omitempty"`
+	Rule    string `json:"rule,omitempty"` // target of the rule that was broken
+}
+
+func (v Violation) String() string {
+	switch v.Kind {
+	case "unexpected-host":
+		if v.Rule == "" {
+			return fmt.Sprintf("unexpected host %s (no rule covers it)", v.Address)
+		}
+		return fmt.Sprintf("unexpected host %s (denied by %s)", v.Address, v.Rule)
+	case "missing-host":
+		return fmt.Sprintf("required host %s did not answer", v.Address)
+	case "unexpected-port":
+		return fmt.Sprintf("unexpected open port %s %d/tcp (rule %s)", v.Address, v.Port, v.Rule)
+	case "missing-port":
+		return fmt.Sprintf("required port %s %d/tcp is not open (rule %s)", v.Address, v.Port, v.Rule)
+	}
+	return v.Kind + " " + v.Address
+}
+
+// Check compares a finished scan with the policy. Only the ports the scan
+// probed, as recorded in its "ports" parameter, are judged, and required
+// hosts are only expected when the scan covered them. targets lists the
+// addresses the scan covered, for a target such as "@targets.txt" that
+// does not say so itself; when it is nil they are taken from r.Target.
+func (p *Policy) Check(r *Report, targets []string) []Violation {
+	probed := map[int]bool{}
+	if ports, err := ParsePorts(r.Param("ports")); err == nil {
+		for _, port := range ports {
+			probed[port] = true
+		}
+	}
+
+	violations := []Violation{}
+	answered := map[string]bool{}
+	for _, h := range r.Hosts {
+		// A port scan lists its target even when nothing answered, so only
+		// an open port shows that the host is there.
+		up := r.Command != "portscan" || len(h.Ports) > 0
+		answered[h.Address] = up
+		rule := p.rule(h.Address)
+		switch {
+		case rule == nil:
+			if up && p.UnknownHosts == "deny" {
+				violations = append(violations, Violation{Kind: "unexpected-host", Address: h.Address})
+			}
+			continue
+		case rule.Deny:
+			if up {
+				violations = append(violations, Violation{Kind: "unexpected-host", Address: h.Address, Rule: rule.Target})
+			}
+			continue
+		}
+
+		open := map[int]bool{}
+		for _, port := range h.Ports {
+			open[port.Number] = true
+			if !contains(rule.Allow, port.Number) && !contains(rule.Require, port.Number) {
+				violations = append(violations, Violation{Kind: "unexpected-port", Address: h.Address, Port: port.Number, Rule: rule.Target})
+			}
+		}
+		for _, port := range rule.Require {
+			if probed[port] && !open[port] {
+				violations = append(violations, Violation{Kind: "missing-port", Address: h.Address, Port: port, Rule: rule.Target})
+			}
+		}
+	}
+
+	for _, rule := range p.Rules {
+		if !rule.Required || answered[rule.Target] || !r.covers(rule.Target, targets) {
+			continue
+		}
+		violations = append(violations, Violation{Kind: "missing-host", Address: rule.Target, Rule: rule.Target})
+	}
+
+	sort.SliceStable(violations, func(i, j int) bool {
+		if violations[i].Address != violations[j].Address {
+			return addressLess(violations[i].Address, violations[j].Address)
+		}
+		return violations[i].Port < violations[j].Port
+	})
+	return violations
+}
+
+// covers reports whether address was among the targets of the scan, which
+// are targets if it is not nil.
+func (r *Report) covers(address string, targets []string) bool {
+	if targets != nil {
+		ip := net.ParseIP(address)
+		for _, t := range targets {
+			if t == address || (ip != nil && ip.Equal(net.ParseIP(t))) {
+				return true
+			}
+		}
+		return false
+	}
+	if r.Target == address {
+		return true
+	}
+	_, network, err := net.ParseCIDR(r.Target)
+	ip := net.ParseIP(address)
+	return err == nil && ip != nil && network.Contains(ip)
+}
+
+func contains(ports []int, port int) bool {
+	i := sort.SearchInts(ports, port)
+	return i < len(ports) && ports[i] == port
+}
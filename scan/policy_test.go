@@ -0,0 +1,52 @@
+package scan
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPolicyCheck(t *testing.T) {
+	p, err := ReadPolicy(strings.NewReader(`
+rules:
+  - target: 10.1.2.0/24
+    allow: [22, 443]
+  - target: 10.1.2.10
+    require: [443]
+    required: true
+  - target: 10.9.0.5
+    required: true
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	strs := func(vs []Violation) []string {
+		out := []string{}
+		for _, v := range vs {
+			out = append(out, v.String())
+		}
+		return out
+	}
+
+	r := NewReport("netscan", "10.1.2.0/24", Param{"ports", "22,80,443"})
+	r.AddHost("10.1.2.1")
+	r.AddPort("10.1.2.1", Port{Number: 80, Protocol: "tcp", State: "open"})
+	r.AddHost("10.7.0.1")
+	r.Finish(256, false)
+	want := []string{
+		"unexpected open port 10.1.2.1 80/tcp (rule 10.1.2.0/24)",
+		"required host 10.1.2.10 did not answer",
+		"unexpected host 10.7.0.1 (no rule covers it)",
+	}
+	if got := strs(p.Check(r, nil)); !reflect.DeepEqual(got, want) {
+		t.Errorf("Check of a network scan = %v, want %v", got, want)
+	}
+
+	// A scan of a target file covers exactly the hosts it listed.
+	r = NewReport("netscan", "@targets.txt", Param{"ports", "22,443"})
+	r.Finish(3, false)
+	want = []string{"required host 10.9.0.5 did not answer"}
+	if got := strs(p.Check(r, []string{"10.1.2.1", "10.1.2.2", "10.9.0.5"})); !reflect.DeepEqual(got, want) {
+		t.Errorf("Check of a target file scan = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,103 @@
+package scan
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket that spaces probes out to a fixed number per
+// second. It is safe for concurrent use.
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // tokens added per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter returns a limiter allowing perSecond probes per second with
+// a burst of a tenth of a second's worth.
+func NewRateLimiter(perSecond float64) *RateLimiter {
+	burst := math.Max(1, perSecond/10)
+	return &RateLimiter{
+		rate:   perSecond,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// Wait blocks until a probe may be sent or ctx is cancelled.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+
+	// Take the token now even if it is not there yet, so concurrent callers
+	// queue up behind each other instead of all waking at once.
+	l.tokens--
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	return sleep(ctx, wait)
+}
+
+// rateMeter measures the probe rate over roughly the last second using two
+// one-second buckets.
+type rateMeter struct {
+	mu          sync.Mutex
+	bucketStart time.Time
+	current     int
+	previous    int
+}
+
+func (m *rateMeter) roll(now time.Time) {
+	if m.bucketStart.IsZero() {
+		m.bucketStart = now
+		return
+	}
+	switch elapsed := now.Sub(m.bucketStart); {
+	case elapsed >= 2*time.Second:
+		m.previous, m.current = 0, 0
+		m.bucketStart = now
+	case elapsed >= time.Second:
+		m.previous, m.current = m.current, 0
+		m.bucketStart = m.bucketStart.Add(time.Second)
+	}
+}
+
+func (m *rateMeter) tick() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.roll(time.Now())
+	m.current++
+}
+
+func (m *rateMeter) rate() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	m.roll(now)
+	frac := now.Sub(m.bucketStart).Seconds()
+	return float64(m.previous)*(1-frac) + float64(m.current)
+}
+
+// applyMinRate raises the concurrency of t so that, with every probe taking
+// its full timeout, at least t.MinRate probes per second can be in flight.
+func applyMinRate(t Timing) Timing {
+	if t.MinRate <= 0 {
+		return t
+	}
+	perProbe := (t.Timeout + t.Delay).Seconds()
+	need := int(math.Ceil(t.MinRate * perProbe))
+	if need > t.Concurrency {
+		t.Concurrency = need
+	}
+	return t
+}
@@ -0,0 +1,104 @@
+package scan
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+)
+
+// TCP flags used by the raw-socket probes.
+const (
+	tcpSYN = 0x02
+	tcpRST = 0x04
+	tcpACK = 0x10
+)
+
+// errRawDenied is returned when raw sockets need privileges the process
+// does not have.
+var errRawDenied = errors.New("raw sockets need root or CAP_NET_RAW")
+
+// permissionError reports whether err means the socket could not be opened
+// for lack of privileges.
+func permissionError(err error) bool {
+	return errors.Is(err, os.ErrPermission) || errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.EACCES)
+}
+
+// sourceFor returns the local address packets to dst leave from. Nothing
+// is sent: connecting a UDP socket only consults the routing table.
+func sourceFor(dst net.IP) (net.IP, error) {
+	conn, err := net.Dial("udp4", net.JoinHostPort(dst.String(), "9"))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP.To4(), nil
+}
+
+// tcpSegment builds a TCP header with options, which must be padded to a
+// multiple of four bytes, and no payload, with its checksum computed over
+// the IPv4 pseudo-header of src and dst.
+func tcpSegment(src, dst net.IP, sport, dport uint16, seq, ack uint32, flags byte, options []byte) []byte {
+	b := make([]byte, 20, 20+len(options))
+	binary.BigEndian.PutUint16(b[0:], sport)
+	binary.BigEndian.PutUint16(b[2:], dport)
+	binary.BigEndian.PutUint32(b[4:], seq)
+	binary.BigEndian.PutUint32(b[8:], ack)
+	b = append(b, options...)
+	b[12] = byte(len(b)/4) << 4 // header length in 32-bit words
+	b[13] = flags
+	binary.BigEndian.PutUint16(b[14:], 64240) // window
+
+	pseudo := make([]byte, 12, 12+len(b))
+	copy(pseudo[0:], src.To4())
+	copy(pseudo[4:], dst.To4())
+	pseudo[9] = syscall.IPPROTO_TCP
+	binary.BigEndian.PutUint16(pseudo[10:], uint16(len(b)))
+	binary.BigEndian.PutUint16(b[16:], checksum(append(pseudo, b...)))
+	return b
+}
+
+// tcpHeader is the part of a TCP header the probes look at.
+type tcpHeader struct {
+	sport, dport uint16
+	seq, ack     uint32
+	flags        byte
+	window       uint16
+	options      []byte
+}
+
+func parseTCP(b []byte) (tcpHeader, error) {
+	if len(b) < 20 {
+		return tcpHeader{}, fmt.Errorf("short TCP header")
+	}
+	size := int(b[12]>>4) * 4
+	if size < 20 || len(b) < size {
+		return tcpHeader{}, fmt.Errorf("bad TCP header length %d", size)
+	}
+	return tcpHeader{
+		sport:   binary.BigEndian.Uint16(b[0:]),
+		dport:   binary.BigEndian.Uint16(b[2:]),
+		seq:     binary.BigEndian.Uint32(b[4:]),
+		ack:     binary.BigEndian.Uint32(b[8:]),
+		flags:   b[13],
+		window:  binary.BigEndian.Uint16(b[14:]),
+		options: b[20:size],
+	}, nil
+}
+
+// checksum is the Internet checksum of RFC 1071.
+func checksum(b []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	return ^uint16(sum)
+}
@@ -0,0 +1,221 @@
+package scan
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Report is the outcome of one scan: what was scanned, how, and which
+// hosts and ports answered.
+type Report struct {
+	XMLName     xml.Name  `json:"-" xml:"scan"`
+	ID          uint64    `json:"id,omitempty" xml:"id,attr,omitempty"`
+	Command     string    `json:"command" xml:"command,attr"`
+	Target      string    `json:"target" xml:"target,attr"`
+	Params      []Param   `json:"params,omitempty" xml:"param"`
+	Started     time.Time `json:"started" xml:"started,attr"`
+	Finished    time.Time `json:"finished" xml:"finished,attr"`
+	Interrupted bool      `json:"interrupted,omitempty" xml:"interrupted,attr,omitempty"`
+	Scanned     int       `json:"scanned" xml:"scanned,attr"` // hosts or ports probed
+	Hosts       []Host    `json:"hosts" xml:"host"`           // hosts that answered
+}
+
+// Param is one setting a scan ran with.
+type Param struct {
+	Name  string `json:"name" xml:"name,attr"`
+	Value string `json:"value" xml:"value,attr"`
+}
+
+// Host is a host that answered, with its open ports, whatever the
+// discovery protocols found out about it and a guess at its OS.
+type Host struct {
+	Address string        `json:"address" xml:"address,attr"`
+	TTL     int           `json:"ttl,omitempty" xml:"ttl,attr,omitempty"` // of the echo reply that found it, 0 if unknown
+	Ports   []Port        `json:"ports,omitempty" xml:"port"`
+	MDNS    []MDNSService `json:"mdns,omitempty" xml:"mdns"`
+	UPnP    []UPnPDevice  `json:"upnp,omitempty" xml:"upnp"`
+	NetBIOS *NetBIOSInfo  `json:"netbios,omitempty" xml:"netbios,omitempty"`
+	SMB     *SMBInfo      `json:"smb,omitempty" xml:"smb,omitempty"`
+	SNMP    *SNMPInfo     `json:"snmp,omitempty" xml:"snmp,omitempty"`
+	OS      *OSGuess      `json:"os,omitempty" xml:"os,omitempty"`
+}
+
+// Port is an open port on a host. The service fields are filled in only
+// when service detection was on.
+type Port struct {
+	Number      int        `json:"port" xml:"number,attr"`
+	Protocol    string     `json:"protocol" xml:"protocol,attr"`
+	State       string     `json:"state" xml:"state,attr"`
+	Service     string     `json:"service,omitempty" xml:"service,attr,omitempty"`
+	Version     string     `json:"version,omitempty" xml:"version,attr,omitempty"` // banner or HTTP Server header
+	CertSHA256  string     `json:"cert_sha256,omitempty" xml:"cert_sha256,attr,omitempty"`
+	CertExpires *time.Time `json:"cert_expires,omitempty" xml:"cert_expires,attr,omitempty"`
+}
+
+// NewReport starts a report for a scan beginning now.
+func NewReport(command, target string, params ...Param) *Report {
+	return &Report{
+		Command: command,
+		Target:  target,
+		Params:  params,
+		Started: time.Now(),
+	}
+}
+
+// Param returns the value of the named parameter, or "".
+func (r *Report) Param(name string) string {
+	for _, p := range r.Params {
+		if p.Name == name {
+			return p.Value
+		}
+	}
+	return ""
+}
+
+func (r *Report) host(address string) *Host {
+	for i := range r.Hosts {
+		if r.Hosts[i].Address == address {
+			return &r.Hosts[i]
+		}
+	}
+	r.Hosts = append(r.Hosts, Host{Address: address})
+	return &r.Hosts[len(r.Hosts)-1]
+}
+
+// AddHost records that address answered.
+func (r *Report) AddHost(address string) {
+	r.host(address)
+}
+
+// AddPinged records a host that answered a ping sweep, with the TTL of
+// its reply.
+func (r *Report) AddPinged(p PingResult) {
+	r.host(p.Host).TTL = p.TTL
+}
+
+// AddPort records an open port on address.
+func (r *Report) AddPort(address string, p Port) {
+	h := r.host(address)
+	h.Ports = append(h.Ports, p)
+}
+
+// AddMDNS records a service address announced over multicast DNS.
+func (r *Report) AddMDNS(address string, s MDNSService) {
+	h := r.host(address)
+	h.MDNS = append(h.MDNS, s)
+}
+
+// AddUPnP records a device that answered an SSDP search from address.
+func (r *Report) AddUPnP(address string, d UPnPDevice) {
+	h := r.host(address)
+	h.UPnP = append(h.UPnP, d)
+}
+
+// SetNetBIOS records the NetBIOS names address answered with.
+func (r *Report) SetNetBIOS(address string, n NetBIOSInfo) {
+	r.host(address).NetBIOS = &n
+}
+
+// SetSMB records the SMB dialects the server on address accepted.
+func (r *Report) SetSMB(address string, s SMBInfo) {
+	r.host(address).SMB = &s
+}
+
+// SetSNMP records what the SNMP agent on address reported.
+func (r *Report) SetSNMP(address string, s SNMPInfo) {
+	r.host(address).SNMP = &s
+}
+
+// SetOS records the operating system address most likely runs.
+func (r *Report) SetOS(address string, g OSGuess) {
+	r.host(address).OS = &g
+}
+
+// Finish stamps the end time and puts hosts and ports in order.
+func (r *Report) Finish(scanned int, interrupted bool) {
+	r.Finished = time.Now()
+	r.Scanned = scanned
+	r.Interrupted = interrupted
+
+	sort.Slice(r.Hosts, func(i, j int) bool {
+		return addressLess(r.Hosts[i].Address, r.Hosts[j].Address)
+	})
+	for _, h := range r.Hosts {
+		sort.Slice(h.Ports, func(i, j int) bool { return h.Ports[i].Number < h.Ports[j].Number })
+	}
+}
+
+// OpenPorts counts the open ports across all hosts.
+func (r *Report) OpenPorts() int {
+	n := 0
+	for _, h := range r.Hosts {
+		n += len(h.Ports)
+	}
+	return n
+}
+
+// addressLess orders IP addresses numerically and anything else by name
+// after them.
+func addressLess(a, b string) bool {
+	ipa, ipb := net.ParseIP(a), net.ParseIP(b)
+	switch {
+	case ipa != nil && ipb != nil:
+		return bytes.Compare(ipa.To16(), ipb.To16()) < 0
+	case ipa != nil:
+		return true
+	case ipb != nil:
+		return false
+	}
+	return a < b
+}
+
+// PortParams describes the ports a scan probes, for a report. How they were
+// probed is added with AddScanMode once a host has been scanned.
+func PortParams(ports string) []Param {
+	return []Param{{"ports", ports}}
+}
+
+// AddScanMode records in the scan_mode parameter that ports were probed in
+// mode, as returned by ScanPortList. A scan that used more than one mode
+// lists each, comma-separated.
+func (r *Report) AddScanMode(mode string) {
+	for i, p := range r.Params {
+		if p.Name != "scan_mode" {
+			continue
+		}
+		for _, m := range strings.Split(p.Value, ",") {
+			if m == mode {
+				return
+			}
+		}
+		r.Params[i].Value += "," + mode
+		return
+	}
+	r.Params = append(r.Params, Param{"scan_mode", mode})
+}
+
+// Params describes the engine settings for a report.
+func (e *Engine) Params() []Param {
+	t := e.Timing
+	params := []Param{
+		{"timing", t.Name},
+		{"concurrency", strconv.Itoa(t.Concurrency)},
+		{"timeout", t.Timeout.String()},
+		{"retries", strconv.Itoa(t.Retries)},
+	}
+	if t.Adaptive {
+		params = append(params, Param{"adaptive", "true"})
+	}
+	if t.MaxRate > 0 {
+		params = append(params, Param{"max_rate", strconv.FormatFloat(t.MaxRate, 'f', -1, 64)})
+	}
+	if e.Services {
+		params = append(params, Param{"services", "true"})
+	}
+	return params
+}
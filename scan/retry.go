@@ -0,0 +1,160 @@
+package scan
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProbeKind identifies the protocol a probe uses.
+type ProbeKind string
+
+const (
+	ProbeICMP ProbeKind = "icmp"
+	ProbeTCP  ProbeKind = "tcp"
+	ProbeUDP  ProbeKind = "udp"
+)
+
+// RetryPolicy says how often an unanswered probe is sent again and how long
+// to wait in between.
+type RetryPolicy struct {
+	// Retries overrides Timing.Retries for a probe kind.
+	Retries    map[ProbeKind]int
+	Backoff    time.Duration // wait before the first retry, doubled for each one after
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryPolicy uses the timing profile's retry count for every probe.
+var DefaultRetryPolicy = RetryPolicy{
+	Backoff:    100 * time.Millisecond,
+	MaxBackoff: 2 * time.Second,
+}
+
+// RetryCounts records how many results of one probe kind needed retries.
+type RetryCounts struct {
+	Results   int // probes that produced a result
+	Retried   int // results that needed at least one retry
+	Recovered int // retried results where a later attempt got an answer
+	Attempts  int // retries sent in total
+}
+
+type retryStats struct {
+	mu     sync.Mutex
+	counts map[ProbeKind]*RetryCounts
+}
+
+// record counts a result that took retries retries. Only a result the
+// target answered counts as recovered; one that ended in err does not.
+func (r *retryStats) record(kind ProbeKind, retries int, answered bool, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.counts == nil {
+		r.counts = make(map[ProbeKind]*RetryCounts)
+	}
+	c := r.counts[kind]
+	if c == nil {
+		c = &RetryCounts{}
+		r.counts[kind] = c
+	}
+	c.Results++
+	c.Attempts += retries
+	if retries > 0 {
+		c.Retried++
+		if answered && err == nil {
+			c.Recovered++
+		}
+	}
+}
+
+// retriesFor is how many retries a probe of kind may use.
+func (e *Engine) retriesFor(kind ProbeKind) int {
+	if n, ok := e.Retry.Retries[kind]; ok && n >= 0 {
+		return n
+	}
+	return e.Timing.Retries
+}
+
+func (e *Engine) backoff(retry int) time.Duration {
+	d := e.Retry.Backoff
+	for i := 1; i < retry && d < e.Retry.MaxBackoff; i++ {
+		d *= 2
+	}
+	if e.Retry.MaxBackoff > 0 && d > e.Retry.MaxBackoff {
+		d = e.Retry.MaxBackoff
+	}
+	return d
+}
+
+// retry calls attempt until the target answers, an attempt fails or the
+// retries for kind run out, and returns the last result. attempt reports
+// answered when the target replied (a refused connection counts) and an
+// error when trying again cannot help. Probes abandoned because ctx was
+// cancelled are not counted.
+func (e *Engine) retry(ctx context.Context, kind ProbeKind, attempt func() (ok, answered bool, err error)) bool {
+	max := e.retriesFor(kind)
+	for n := 0; ; n++ {
+		if n > 0 {
+			if sleep(ctx, e.backoff(n)) != nil {
+				return false
+			}
+		}
+		ok, answered, err := attempt()
+		if ctx.Err() != nil && !ok {
+			return false
+		}
+		if answered || err != nil || n >= max {
+			e.retries.record(kind, n, answered, err)
+			return ok
+		}
+	}
+}
+
+// udpAttempt gives retry the outcome of a UDP request that returned err: a
+// reply answers, a timeout is sent again and any other error ends it.
+func udpAttempt(ctx context.Context, err error) (ok, answered bool, _ error) {
+	switch {
+	case err == nil:
+		return true, true, nil
+	case isTimeout(err) && ctx.Err() == nil:
+		return false, false, nil
+	}
+	return false, false, err
+}
+
+// RetryStats returns the retry counters for every probe kind used so far.
+func (e *Engine) RetryStats() map[ProbeKind]RetryCounts {
+	e.retries.mu.Lock()
+	defer e.retries.mu.Unlock()
+	out := make(map[ProbeKind]RetryCounts, len(e.retries.counts))
+	for k, c := range e.retries.counts {
+		out[k] = *c
+	}
+	return out
+}
+
+// RetrySummary describes the retry counters in one line, or returns "" if
+// no result needed a retry.
+func (e *Engine) RetrySummary() string {
+	stats := e.RetryStats()
+	kinds := make([]string, 0, len(stats))
+	for k, c := range stats {
+		if c.Retried > 0 {
+			kinds = append(kinds, string(k))
+		}
+	}
+	if len(kinds) == 0 {
+		return ""
+	}
+	sort.Strings(kinds)
+
+	parts := make([]string, len(kinds))
+	for i, k := range kinds {
+		c := stats[ProbeKind(k)]
+		parts[i] = fmt.Sprintf("%s %d/%d results retried (%d recovered, %d retries sent)",
+			k, c.Retried, c.Results, c.Recovered, c.Attempts)
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,174 @@
+package scan
+
+import (
+	"context"
+	"fmt"
+	"net"
+)
+
+// Spec says what scan to run. It is the unit of work for the scheduler and
+// the API server.
+type Spec struct {
+	Command string `json:"command" yaml:"command"` // "portscan" or "netscan"
+	Target  string `json:"target" yaml:"target"`   // host for portscan, CIDR network for netscan
+	// Ports is a list such as "22,80,8000-8100": the ports to scan for
+	// portscan, and for netscan the ports to probe on every live host
+	// (none if empty).
+	Ports string `json:"ports,omitempty" yaml:"ports,omitempty"`
+}
+
+// Validate checks that spec can be run.
+func (s Spec) Validate() error {
+	switch s.Command {
+	case "portscan":
+		if s.Target == "" {
+			return fmt.Errorf("portscan needs a target host")
+		}
+		if s.Ports == "" {
+			return fmt.Errorf("portscan needs a port list")
+		}
+	case "netscan":
+		_, ipNet, err := net.ParseCIDR(s.Target)
+		if err != nil {
+			return fmt.Errorf("netscan target: %w", err)
+		}
+		if err := checkNetworkSize(ipNet); err != nil {
+			return fmt.Errorf("netscan target: %w", err)
+		}
+	default:
+		return fmt.Errorf("unknown scan command %q (want portscan or netscan)", s.Command)
+	}
+	if _, err := ParsePorts(s.Ports); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Event reports progress while Run works through a scan. Found is set for
+// a host that answered the sweep (Port nil) or a port found open.
+type Event struct {
+	Host  string `json:"host"`
+	Port  *Port  `json:"port,omitempty"`
+	Found bool   `json:"found"`
+	Done  int    `json:"done"`  // probes finished so far
+	Total int    `json:"total"` // probes planned so far; netscan adds the port probes once the sweep is done
+}
+
+// Run runs spec and returns its report. fn, if not nil, is called after
+// every probe; calls are serialized. When ctx is cancelled Run stops as
+// Sweep does and returns the partial report, marked interrupted, together
+// with ctx.Err().
+func (e *Engine) Run(ctx context.Context, spec Spec, fn func(Event)) (*Report, error) {
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+	if fn == nil {
+		fn = func(Event) {}
+	}
+	ports, _ := ParsePorts(spec.Ports)
+
+	params := e.Params()
+	if len(ports) > 0 {
+		params = append(params, PortParams(FormatPorts(ports))...)
+	}
+	report := NewReport(spec.Command, spec.Target, params...)
+	done, total := 0, 0
+
+	scanHost := func(host string) error {
+		mode, err := e.ScanPortList(ctx, host, ports, func(p Port, open bool) {
+			done++
+			ev := Event{Host: host, Done: done, Total: total}
+			if open {
+				report.AddPort(host, p)
+				ev.Port, ev.Found = &p, true
+			}
+			fn(ev)
+		})
+		report.AddScanMode(mode)
+		return err
+	}
+
+	var err error
+	switch spec.Command {
+	case "portscan":
+		report.AddHost(spec.Target)
+		total = len(ports)
+		err = scanHost(spec.Target)
+		report.Finish(done, err != nil)
+
+	case "netscan":
+		if _, err := e.ICMPMode(); err != nil {
+			return nil, err
+		}
+		ips, _ := CIDRHosts(spec.Target)
+		total = len(ips)
+		var alive []string
+		err = e.PingSweep(ctx, ips, func(r PingResult) {
+			done++
+			if r.Alive() {
+				alive = append(alive, r.Host)
+				report.AddPinged(r)
+			}
+			fn(Event{Host: r.Host, Found: r.Alive(), Done: done, Total: total})
+		})
+		swept := done
+		if err == nil && len(ports) > 0 {
+			total += len(alive) * len(ports)
+			for _, ip := range alive {
+				if err = scanHost(ip); err != nil {
+					break
+				}
+			}
+		}
+		report.Finish(swept, err != nil)
+	}
+	return report, err
+}
+
+// Networks with more host bits than these are refused: sweeping them
+// would take days, and listing an IPv6 /64 does not fit in memory.
+const (
+	maxHostBits4 = 16 // a /16
+	maxHostBits6 = 8  // a /120
+)
+
+// checkNetworkSize returns an error if ipNet is too large to sweep.
+func checkNetworkSize(ipNet *net.IPNet) error {
+	ones, bits := ipNet.Mask.Size()
+	limit := maxHostBits4
+	if bits == 8*net.IPv6len {
+		limit = maxHostBits6
+	}
+	if bits-ones > limit {
+		return fmt.Errorf("network %s is too large to scan (at most a /%d)", ipNet, bits-limit)
+	}
+	return nil
+}
+
+// CIDRHosts lists every address in a CIDR network. Networks larger than
+// an IPv4 /16 or an IPv6 /120 are an error.
+func CIDRHosts(network string) ([]string, error) {
+	_, ipNet, err := net.ParseCIDR(network)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkNetworkSize(ipNet); err != nil {
+		return nil, err
+	}
+
+	var ips []string
+	for ip := ipNet.IP.Mask(ipNet.Mask); ipNet.Contains(ip); IncIP(ip) {
+		ips = append(ips, ip.String())
+	}
+	return ips, nil
+}
+
+// IncIP advances ip in place to the next address.
+func IncIP(ip net.IP) {
+	for j := len(ip) - 1; j >= 0; j-- {
+		ip[j]++
+		if ip[j] > 0 {
+			break
+		}
+	}
+}
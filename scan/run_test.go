@@ -0,0 +1,47 @@
+package scan
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCIDRHosts(t *testing.T) {
+	tests := []struct {
+		network     string
+		first, last string
+		n           int
+	}{
+		{"192.168.1.0/30", "192.168.1.0", "192.168.1.3", 4},
+		{"192.168.1.77/24", "192.168.1.0", "192.168.1.255", 256},
+		{"255.255.0.0/16", "255.255.0.0", "255.255.255.255", 65536},
+		{"2001:db8::/120", "2001:db8::", "2001:db8::ff", 256},
+	}
+	for _, tt := range tests {
+		ips, err := CIDRHosts(tt.network)
+		if err != nil {
+			t.Errorf("CIDRHosts(%s): %v", tt.network, err)
+			continue
+		}
+		if len(ips) != tt.n || ips[0] != tt.first || ips[len(ips)-1] != tt.last {
+			t.Errorf("CIDRHosts(%s) = %d addresses %s..%s, want %d %s..%s",
+				tt.network, len(ips), ips[0], ips[len(ips)-1], tt.n, tt.first, tt.last)
+		}
+	}
+
+	for _, network := range []string{"0.0.0.0/0", "10.0.0.0/15", "2001:db8::/64", "2001:db8::/119"} {
+		if _, err := CIDRHosts(network); err == nil {
+			t.Errorf("CIDRHosts(%s) succeeded, want too large", network)
+		}
+		if err := (Spec{Command: "netscan", Target: network}).Validate(); err == nil {
+			t.Errorf("Validate accepted netscan of %s", network)
+		}
+	}
+}
+
+func TestScanPortsRange(t *testing.T) {
+	for _, r := range [][2]int{{100, 1}, {0, 10}, {1, 65536}} {
+		if _, err := testEngine().ScanPorts(context.Background(), "127.0.0.1", r[0], r[1], nil); err == nil {
+			t.Errorf("ScanPorts(%d, %d) succeeded, want an invalid range", r[0], r[1])
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package scan
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var wellKnownPorts = map[int]string{
+	21: "ftp", 22: "ssh", 23: "telnet", 25: "smtp", 53: "domain",
+	80: "http", 110: "pop3", 111: "rpcbind", 135: "msrpc", 139: "netbios-ssn",
+	143: "imap", 161: "snmp", 389: "ldap", 443: "https", 445: "microsoft-ds",
+	465: "smtps", 587: "submission", 636: "ldaps", 993: "imaps", 995: "pop3s",
+	1433: "ms-sql", 1521: "oracle", 3306: "mysql", 3389: "ms-wbt-server",
+	5432: "postgresql", 5900: "vnc", 6379: "redis", 8000: "http-alt",
+	8080: "http-proxy", 8443: "https-alt", 9200: "elasticsearch", 27017: "mongodb",
+}
+
+var tlsPorts = map[int]bool{443: true, 465: true, 636: true, 993: true, 995: true, 8443: true}
+
+var httpPorts = map[int]bool{80: true, 443: true, 8000: true, 8008: true, 8080: true, 8443: true, 8888: true}
+
+// ServiceName is the conventional service on a TCP port, or "".
+func ServiceName(port int) string {
+	return wellKnownPorts[port]
+}
+
+// WellKnownPorts lists the ports ServiceName knows, in order.
+func WellKnownPorts() []int {
+	ports := make([]int, 0, len(wellKnownPorts))
+	for p := range wellKnownPorts {
+		ports = append(ports, p)
+	}
+	sort.Ints(ports)
+	return ports
+}
+
+// identify connects to an open port again to read what the service
+// announces: its banner or HTTP Server header, and for TLS ports the
+// certificate it presents.
+func (e *Engine) identify(ctx context.Context, host string, port int) Port {
+	p := Port{Number: port, Protocol: "tcp", State: "open", Service: ServiceName(port)}
+	if err := e.send(ctx); err != nil {
+		return p
+	}
+
+	timeout := e.timeout(host)
+	if timeout < 2*time.Second {
+		timeout = 2 * time.Second
+	}
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return p
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	if tlsPorts[port] {
+		tc := tls.Client(conn, &tls.Config{InsecureSkipVerify: true, ServerName: host})
+		if err := tc.HandshakeContext(ctx); err != nil {
+			return p
+		}
+		if certs := tc.ConnectionState().PeerCertificates; len(certs) > 0 {
+			sum := sha256.Sum256(certs[0].Raw)
+			p.CertSHA256 = hex.EncodeToString(sum[:])
+			expires := certs[0].NotAfter.UTC()
+			p.CertExpires = &expires
+		}
+		conn = tc
+	}
+
+	if httpPorts[port] {
+		conn.Write([]byte("HEAD / HTTP/1.0\r\nHost: " + host + "\r\n\r\n"))
+	}
+	p.Version = readBanner(conn)
+	return p
+}
+
+// readBanner returns the first line a service sends, or the Server header
+// of an HTTP response.
+func readBanner(conn net.Conn) string {
+	r := bufio.NewReader(conn)
+	first, err := r.ReadString('\n')
+	if err != nil && first == "" {
+		return ""
+	}
+	first = cleanBanner(first)
+	if !strings.HasPrefix(first, "HTTP/") {
+		return first
+	}
+	for {
+		line, err := r.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if name, value, ok := strings.Cut(line, ":"); ok && strings.EqualFold(name, "server") {
+			return cleanBanner(value)
+		}
+		if err != nil || line == "" {
+			return first
+		}
+	}
+}
+
+// cleanBanner trims a banner to one printable line of at most 120 runes.
+func cleanBanner(s string) string {
+	s = strings.TrimSpace(s)
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsPrint(r) {
+			return r
+		}
+		return -1
+	}, s)
+	if r := []rune(s); len(r) > 120 {
+		s = string(r[:120])
+	}
+	return s
+}
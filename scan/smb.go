@@ -0,0 +1,215 @@
+package scan
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SMBInfo is what an SMB server on port 445 agreed to speak.
+type SMBInfo struct {
+	Dialects        []string `json:"dialects" xml:"dialect"` // "NT LM 0.12" is SMBv1; the others are SMB 2 and 3
+	SMBv1           bool     `json:"smbv1" xml:"smbv1,attr"`
+	SigningRequired bool     `json:"signing_required,omitempty" xml:"signing_required,attr,omitempty"`
+}
+
+func (s SMBInfo) String() string {
+	out := "dialects " + strings.Join(s.Dialects, ", ")
+	if s.SMBv1 {
+		out += "; SMBv1 enabled"
+	}
+	if s.SigningRequired {
+		out += "; signing required"
+	}
+	return out
+}
+
+const smbv1Dialect = "NT LM 0.12"
+
+// smb2Dialects are the SMB 2 and 3 revisions probed, oldest first.
+var smb2Dialects = []struct {
+	revision uint16
+	name     string
+}{
+	{0x0202, "2.0.2"},
+	{0x0210, "2.1"},
+	{0x0300, "3.0"},
+	{0x0302, "3.0.2"},
+	{0x0311, "3.1.1"},
+}
+
+var errNoSMB = errors.New("not an SMB server")
+
+// SMBSweep probes the SMB server on every address in ips,
+// Timing.Concurrency at a time, and calls fn for each that speaks SMB.
+// Calls to fn are serialized; cancellation works as for Sweep.
+func (e *Engine) SMBSweep(ctx context.Context, ips []string, fn func(ip string, info SMBInfo)) error {
+	var mu sync.Mutex
+	return e.each(ctx, len(ips), func(i int) {
+		info, err := e.ProbeSMB(ctx, ips[i])
+		if err != nil {
+			return
+		}
+		mu.Lock()
+		fn(ips[i], *info)
+		mu.Unlock()
+	})
+}
+
+// ProbeSMB negotiates with the SMB server on host's port 445 once per
+// dialect, since a server only names the one it picks, and reports every
+// dialect it accepted. It fails when the port is closed or what listens
+// there does not speak SMB.
+func (e *Engine) ProbeSMB(ctx context.Context, host string) (*SMBInfo, error) {
+	info := &SMBInfo{}
+	ok, _, err := e.smbNegotiate(ctx, host, smb1Negotiate())
+	if err != nil && !errors.Is(err, errNoSMB) {
+		return nil, err
+	}
+	if ok {
+		info.SMBv1 = true
+		info.Dialects = append(info.Dialects, smbv1Dialect)
+	}
+	for _, d := range smb2Dialects {
+		ok, signing, err := e.smbNegotiate(ctx, host, smb2Negotiate(d.revision))
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err == nil && ok {
+			info.Dialects = append(info.Dialects, d.name)
+			info.SigningRequired = info.SigningRequired || signing
+		}
+	}
+	if len(info.Dialects) == 0 {
+		return nil, errNoSMB
+	}
+	return info, nil
+}
+
+// smbNegotiate sends one negotiate request and reports whether the server
+// accepted the dialect offered and, for SMB 2, whether it requires
+// signing.
+func (e *Engine) smbNegotiate(ctx context.Context, host string, req []byte) (accepted, signing bool, err error) {
+	if err := e.send(ctx); err != nil {
+		return false, false, err
+	}
+	timeout := max(e.timeout(host), 2*time.Second)
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, "445"))
+	if err != nil {
+		return false, false, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	// Each message is framed by a NetBIOS session header: a zero byte and
+	// a 24-bit length.
+	frame := binary.BigEndian.AppendUint32(nil, uint32(len(req)))
+	if _, err := conn.Write(append(frame, req...)); err != nil {
+		return false, false, err
+	}
+	var hdr [4]byte
+	if _, err := io.ReadFull(conn, hdr[:]); err != nil {
+		// Servers with SMBv1 turned off hang up on an SMBv1 negotiate.
+		return false, false, errNoSMB
+	}
+	resp := make([]byte, min(binary.BigEndian.Uint32(hdr[:])&0xffffff, 1<<16))
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return false, false, errNoSMB
+	}
+
+	switch {
+	case bytes.HasPrefix(resp, []byte("\xffSMB")) && len(resp) >= 35:
+		// Status, then after the header the word count and the index of
+		// the dialect chosen, 0xffff for none.
+		status := binary.LittleEndian.Uint32(resp[5:])
+		return status == 0 && resp[4] == 0x72 && binary.LittleEndian.Uint16(resp[33:]) == 0, false, nil
+	case bytes.HasPrefix(resp, []byte("\xfeSMB")) && len(resp) >= 64+6:
+		status := binary.LittleEndian.Uint32(resp[8:])
+		body := resp[64:]
+		revision := binary.LittleEndian.Uint16(body[4:])
+		offered := binary.LittleEndian.Uint16(req[64+36:])
+		return status == 0 && revision == offered, body[2]&0x02 != 0, nil
+	}
+	return false, false, errNoSMB
+}
+
+// smb1Negotiate offers only the SMBv1 dialect.
+func smb1Negotiate() []byte {
+	b := []byte("\xffSMB")
+	b = append(b, 0x72)                // negotiate
+	b = append(b, 0, 0, 0, 0)          // status
+	b = append(b, 0x18)                // flags: case-insensitive, canonical paths
+	b = append(b, 0x01, 0xc8)          // flags2: long names, NT status, unicode
+	b = append(b, make([]byte, 12)...) // PID high, signature, reserved
+	b = append(b, 0xff, 0xff)          // tree ID
+	b = append(b, 0x2f, 0x4b)          // process ID
+	b = append(b, 0, 0, 0, 0)          // user ID, multiplex ID
+	dialects := append([]byte{0x02}, smbv1Dialect+"\x00"...)
+	b = append(b, 0) // word count
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(dialects)))
+	return append(b, dialects...)
+}
+
+// smb2Negotiate offers only the SMB 2 or 3 dialect revision. 3.1.1 needs
+// the pre-authentication integrity and encryption contexts alongside.
+func smb2Negotiate(revision uint16) []byte {
+	le := binary.LittleEndian
+	b := []byte("\xfeSMB")
+	b = le.AppendUint16(b, 64)        // header size
+	b = append(b, make([]byte, 6)...) // credit charge, status
+	b = le.AppendUint16(b, 0)         // negotiate
+	b = le.AppendUint16(b, 1)         // credits requested
+	b = append(b, make([]byte, 64-16)...)
+
+	b = le.AppendUint16(b, 36) // request size
+	b = le.AppendUint16(b, 1)  // one dialect
+	b = le.AppendUint16(b, 1)  // signing enabled
+	b = le.AppendUint16(b, 0)
+	b = le.AppendUint32(b, 0) // capabilities
+	guid := make([]byte, 16)
+	rand.Read(guid)
+	b = append(b, guid...)
+	contexts := len(b)
+	b = append(b, make([]byte, 8)...) // negotiate contexts, or a start time
+	b = le.AppendUint16(b, revision)
+	if revision < 0x0311 {
+		return b
+	}
+
+	for len(b)%8 != 0 {
+		b = append(b, 0)
+	}
+	le.PutUint32(b[contexts:], uint32(len(b)))
+	le.PutUint16(b[contexts+4:], 2)
+	salt := make([]byte, 32)
+	rand.Read(salt)
+	preauth := le.AppendUint16(nil, 1)         // one hash algorithm
+	preauth = le.AppendUint16(preauth, 32)     // salt length
+	preauth = le.AppendUint16(preauth, 0x0001) // SHA-512
+	preauth = append(preauth, salt...)
+	b = appendNegotiateContext(b, 1, preauth)
+	for len(b)%8 != 0 {
+		b = append(b, 0)
+	}
+	ciphers := le.AppendUint16(nil, 2)         // two ciphers
+	ciphers = le.AppendUint16(ciphers, 0x0002) // AES-128-GCM
+	ciphers = le.AppendUint16(ciphers, 0x0001) // AES-128-CCM
+	return appendNegotiateContext(b, 2, ciphers)
+}
+
+func appendNegotiateContext(b []byte, typ uint16, data []byte) []byte {
+	b = binary.LittleEndian.AppendUint16(b, typ)
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(data)))
+	b = append(b, 0, 0, 0, 0)
+	return append(b, data...)
+}
@@ -0,0 +1,585 @@
+package scan
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// SNMPInfo is what an SNMP agent told about its device once a community
+// string was accepted.
+type SNMPInfo struct {
+	Version    string          `json:"version" xml:"version,attr"` // v1 or v2c
+	Community  string          `json:"community" xml:"community,attr"`
+	Descr      string          `json:"descr,omitempty" xml:"descr,omitempty"`
+	Name       string          `json:"name,omitempty" xml:"name,attr,omitempty"`
+	Location   string          `json:"location,omitempty" xml:"location,attr,omitempty"`
+	Uptime     string          `json:"uptime,omitempty" xml:"uptime,attr,omitempty"`
+	Interfaces []SNMPInterface `json:"interfaces,omitempty" xml:"interface"`
+}
+
+// SNMPInterface is one row of the agent's interfaces table.
+type SNMPInterface struct {
+	Index  int    `json:"index" xml:"index,attr"`
+	Descr  string `json:"descr" xml:"descr,attr"`
+	Type   int    `json:"type,omitempty" xml:"type,attr,omitempty"`   // IANAifType, 6 for Ethernet
+	Speed  uint64 `json:"speed,omitempty" xml:"speed,attr,omitempty"` // bits per second
+	MAC    string `json:"mac,omitempty" xml:"mac,attr,omitempty"`
+	Status string `json:"status,omitempty" xml:"status,attr,omitempty"` // operational status: up, down, ...
+}
+
+func (s SNMPInfo) String() string {
+	parts := []string{fmt.Sprintf("%s community %q", s.Version, s.Community)}
+	if s.Name != "" {
+		parts = append(parts, "name "+s.Name)
+	}
+	if s.Descr != "" {
+		parts = append(parts, fmt.Sprintf("%q", cleanBanner(s.Descr)))
+	}
+	if s.Location != "" {
+		parts = append(parts, "location "+s.Location)
+	}
+	if s.Uptime != "" {
+		parts = append(parts, "up "+s.Uptime)
+	}
+	if len(s.Interfaces) > 0 {
+		parts = append(parts, fmt.Sprintf("%d interfaces", len(s.Interfaces)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (i SNMPInterface) String() string {
+	out := fmt.Sprintf("%d %s", i.Index, i.Descr)
+	if i.Status != "" {
+		out += " " + i.Status
+	}
+	if i.Speed > 0 {
+		out += " " + formatSpeed(i.Speed)
+	}
+	if i.MAC != "" {
+		out += " " + i.MAC
+	}
+	return out
+}
+
+func formatSpeed(bps uint64) string {
+	switch {
+	case bps >= 1e9 && bps%1e9 == 0:
+		return fmt.Sprintf("%dGb/s", bps/1e9)
+	case bps >= 1e6:
+		return fmt.Sprintf("%dMb/s", bps/1e6)
+	}
+	return fmt.Sprintf("%db/s", bps)
+}
+
+// DefaultCommunities are tried when no list is given: the factory
+// defaults most devices ship with.
+var DefaultCommunities = []string{"public", "private"}
+
+// ReadCommunities parses a comma-separated list of community strings, or
+// with a leading @ reads them from a file, one per line.
+func ReadCommunities(list string) ([]string, error) {
+	if !strings.HasPrefix(list, "@") {
+		var out []string
+		for _, c := range strings.Split(list, ",") {
+			if c = strings.TrimSpace(c); c != "" {
+				out = append(out, c)
+			}
+		}
+		return out, nil
+	}
+	f, err := os.Open(list[1:])
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var out []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if c := strings.TrimSpace(sc.Text()); c != "" && !strings.HasPrefix(c, "#") {
+			out = append(out, c)
+		}
+	}
+	return out, sc.Err()
+}
+
+// The objects read from an agent: the system group and the columns of the
+// interfaces table.
+var (
+	oidSysDescr    = mustOID("1.3.6.1.2.1.1.1.0")
+	oidSysUpTime   = mustOID("1.3.6.1.2.1.1.3.0")
+	oidSysName     = mustOID("1.3.6.1.2.1.1.5.0")
+	oidSysLocation = mustOID("1.3.6.1.2.1.1.6.0")
+	oidIfDescr     = mustOID("1.3.6.1.2.1.2.2.1.2")
+	oidIfType      = mustOID("1.3.6.1.2.1.2.2.1.3")
+	oidIfSpeed     = mustOID("1.3.6.1.2.1.2.2.1.5")
+	oidIfPhysAddr  = mustOID("1.3.6.1.2.1.2.2.1.6")
+	oidIfOper      = mustOID("1.3.6.1.2.1.2.2.1.8")
+)
+
+// maxInterfaces caps the interfaces table walk on very large devices.
+const maxInterfaces = 1000
+
+var ifStatus = map[int64]string{1: "up", 2: "down", 3: "testing", 4: "unknown", 5: "dormant", 6: "notPresent", 7: "lowerLayerDown"}
+
+// SNMPSweep probes the SNMP agent on every address in ips,
+// Timing.Concurrency at a time, and calls fn for each that accepts one of
+// communities. Calls to fn are serialized; cancellation works as for Sweep.
+func (e *Engine) SNMPSweep(ctx context.Context, ips, communities []string, fn func(ip string, info SNMPInfo)) error {
+	var mu sync.Mutex
+	return e.each(ctx, len(ips), func(i int) {
+		info, err := e.ProbeSNMP(ctx, ips[i], communities)
+		if err != nil {
+			return
+		}
+		mu.Lock()
+		fn(ips[i], *info)
+		mu.Unlock()
+	})
+}
+
+var errNoSNMP = errors.New("no community accepted")
+
+// ProbeSNMP tries each community string against the agent on host's UDP
+// port 161, with SNMPv2c and then SNMPv1, and with the first one accepted
+// reads sysDescr, sysName, sysLocation, sysUpTime and the interfaces
+// table. Agents ignore requests with a wrong community, so each guess
+// costs a timeout; guesses are not retried.
+func (e *Engine) ProbeSNMP(ctx context.Context, host string, communities []string) (*SNMPInfo, error) {
+	return e.probeSNMP(ctx, host, "161", communities)
+}
+
+func (e *Engine) probeSNMP(ctx context.Context, host, port string, communities []string) (*SNMPInfo, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", net.JoinHostPort(host, port))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	for _, community := range communities {
+		for _, version := range []int{snmpV2c, snmpV1} {
+			c := &snmpClient{e: e, conn: conn, host: host, version: version, community: community}
+			// Any answer, even an error, means the community was accepted.
+			vbs, err := c.request(ctx, pduGet, []oid{oidSysDescr})
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			var status snmpStatusError
+			if isTimeout(err) {
+				continue
+			}
+			if err != nil && !errors.As(err, &status) {
+				// Nothing listens, or the agent is broken: stop guessing.
+				return nil, err
+			}
+
+			info := &SNMPInfo{Version: c.versionName(), Community: community}
+			if len(vbs) == 1 {
+				info.Descr = vbs[0].text()
+			}
+			// One object per request: an SNMPv1 agent fails a whole
+			// request over one object it does not have.
+			info.Name = c.get(ctx, oidSysName).text()
+			info.Location = c.get(ctx, oidSysLocation).text()
+			if ticks, ok := c.get(ctx, oidSysUpTime).uint(); ok {
+				info.Uptime = (time.Duration(ticks) * 10 * time.Millisecond).Round(time.Second).String()
+			}
+			// A walk cut short keeps the rows read so far.
+			info.Interfaces, _ = c.interfaces(ctx)
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return info, nil
+		}
+	}
+	return nil, errNoSNMP
+}
+
+// get reads one object, retrying lost requests. It returns an empty
+// varbind if the agent does not have it.
+func (c *snmpClient) get(ctx context.Context, o oid) varbind {
+	var vbs []varbind
+	var err error
+	c.e.retry(ctx, ProbeUDP, func() (bool, bool, error) {
+		vbs, err = c.request(ctx, pduGet, []oid{o})
+		return udpAttempt(ctx, err)
+	})
+	if err != nil || len(vbs) != 1 {
+		return varbind{}
+	}
+	return vbs[0]
+}
+
+// interfaces walks the interesting columns of ifTable a row at a time.
+func (c *snmpClient) interfaces(ctx context.Context) ([]SNMPInterface, error) {
+	columns := []oid{oidIfDescr, oidIfType, oidIfSpeed, oidIfPhysAddr, oidIfOper}
+	next := append([]oid(nil), columns...)
+	var ifaces []SNMPInterface
+	for len(ifaces) < maxInterfaces {
+		var vbs []varbind
+		var err error
+		c.e.retry(ctx, ProbeUDP, func() (bool, bool, error) {
+			vbs, err = c.request(ctx, pduGetNext, next)
+			return udpAttempt(ctx, err)
+		})
+		if err != nil {
+			return ifaces, err
+		}
+		if len(vbs) != len(columns) || !vbs[0].oid.under(oidIfDescr) || len(vbs[0].oid) != len(oidIfDescr)+1 {
+			break // past the end of the table
+		}
+		index := vbs[0].oid[len(oidIfDescr)]
+		iface := SNMPInterface{Index: int(index), Descr: vbs[0].text()}
+		for i, vb := range vbs[1:] {
+			col := columns[i+1]
+			if !vb.oid.under(col) || len(vb.oid) != len(col)+1 || vb.oid[len(col)] != index {
+				continue
+			}
+			switch {
+			case col.equal(oidIfType):
+				n, _ := vb.int()
+				iface.Type = int(n)
+			case col.equal(oidIfSpeed):
+				iface.Speed, _ = vb.uint()
+			case col.equal(oidIfPhysAddr):
+				if len(vb.value) == 6 {
+					iface.MAC = net.HardwareAddr(vb.value).String()
+				}
+			case col.equal(oidIfOper):
+				n, _ := vb.int()
+				iface.Status = ifStatus[n]
+			}
+		}
+		ifaces = append(ifaces, iface)
+		for i, vb := range vbs {
+			next[i] = vb.oid
+		}
+	}
+	return ifaces, nil
+}
+
+const (
+	snmpV1  = 0
+	snmpV2c = 1
+
+	pduGet      = 0xa0
+	pduGetNext  = 0xa1
+	pduResponse = 0xa2
+)
+
+// snmpClient sends requests of one version and community to one agent.
+type snmpClient struct {
+	e         *Engine
+	conn      net.Conn
+	host      string
+	version   int
+	community string
+}
+
+func (c *snmpClient) versionName() string {
+	if c.version == snmpV1 {
+		return "v1"
+	}
+	return "v2c"
+}
+
+var errSNMPMismatch = errors.New("SNMP response does not match the request")
+
+// snmpStatusError is the error status of a response, such as noSuchName
+// (2), which ends an SNMPv1 walk the way endOfMibView ends a v2c one.
+type snmpStatusError int64
+
+func (e snmpStatusError) Error() string {
+	return fmt.Sprintf("SNMP error status %d", int64(e))
+}
+
+// request sends one PDU and waits for the response with the same request
+// ID.
+func (c *snmpClient) request(ctx context.Context, pdu byte, oids []oid) ([]varbind, error) {
+	if err := c.e.send(ctx); err != nil {
+		return nil, err
+	}
+	id := rand.Int31()
+	var list []byte
+	for _, o := range oids {
+		list = append(list, berTLV(0x30, append(berTLV(0x06, o.encode()), 0x05, 0x00))...)
+	}
+	body := berInt(int64(id))
+	body = append(body, berInt(0)...) // error status
+	body = append(body, berInt(0)...) // error index
+	body = append(body, berTLV(0x30, list)...)
+	msg := berInt(int64(c.version))
+	msg = append(msg, berTLV(0x04, []byte(c.community))...)
+	msg = append(msg, berTLV(pdu, body)...)
+
+	c.conn.SetDeadline(time.Now().Add(c.e.timeout(c.host)))
+	start := time.Now()
+	if _, err := c.conn.Write(berTLV(0x30, msg)); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 65535)
+	for {
+		n, err := c.conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		vbs, respID, err := c.parse(buf[:n])
+		if errors.Is(err, errSNMPMismatch) || respID != id {
+			continue // not for us, or garbage
+		}
+		c.e.rtt.observe(c.host, time.Since(start))
+		return vbs, err
+	}
+}
+
+// parse reads a response message, checking its version and community.
+func (c *snmpClient) parse(b []byte) ([]varbind, int32, error) {
+	var msg, field ber
+	var err error
+	if msg, _, err = readBER(b); err != nil || msg.tag != 0x30 {
+		return nil, 0, errSNMPMismatch
+	}
+	rest := msg.value
+	if field, rest, err = readBER(rest); err != nil || !field.integer() || field.int() != int64(c.version) {
+		return nil, 0, errSNMPMismatch
+	}
+	if field, rest, err = readBER(rest); err != nil || field.tag != 0x04 || string(field.value) != c.community {
+		return nil, 0, errSNMPMismatch
+	}
+	var pdu ber
+	if pdu, _, err = readBER(rest); err != nil || pdu.tag != pduResponse {
+		return nil, 0, errSNMPMismatch
+	}
+	// Request ID, error status and index, and the varbind list.
+	var fields [4]ber
+	rest = pdu.value
+	for i := range fields {
+		if fields[i], rest, err = readBER(rest); err != nil || (i < 3 && !fields[i].integer()) || (i == 3 && fields[i].tag != 0x30) {
+			return nil, 0, errSNMPMismatch
+		}
+	}
+	id := int32(fields[0].int())
+	if status := fields[1].int(); status != 0 {
+		return nil, id, snmpStatusError(status)
+	}
+	var vbs []varbind
+	list := fields[3].value
+	for len(list) > 0 {
+		var seq, name, value ber
+		if seq, list, err = readBER(list); err != nil || seq.tag != 0x30 {
+			return nil, id, errSNMPMismatch
+		}
+		if name, value.value, err = readBER(seq.value); err != nil || name.tag != 0x06 {
+			return nil, id, errSNMPMismatch
+		}
+		if value, _, err = readBER(value.value); err != nil {
+			return nil, id, errSNMPMismatch
+		}
+		o, err := decodeOID(name.value)
+		if err != nil {
+			return nil, id, errSNMPMismatch
+		}
+		vbs = append(vbs, varbind{oid: o, ber: value})
+	}
+	return vbs, id, nil
+}
+
+// ber is one BER-encoded element: its tag and contents.
+type ber struct {
+	tag   byte
+	value []byte
+}
+
+func readBER(b []byte) (ber, []byte, error) {
+	if len(b) < 2 {
+		return ber{}, nil, errSNMPMismatch
+	}
+	tag, n := b[0], int(b[1])
+	b = b[2:]
+	if n&0x80 != 0 {
+		size := n & 0x7f
+		if size == 0 || size > 4 || len(b) < size {
+			return ber{}, nil, errSNMPMismatch
+		}
+		n = 0
+		for _, x := range b[:size] {
+			n = n<<8 | int(x)
+		}
+		b = b[size:]
+	}
+	if n < 0 || len(b) < n {
+		return ber{}, nil, errSNMPMismatch
+	}
+	return ber{tag: tag, value: b[:n]}, b[n:], nil
+}
+
+func berTLV(tag byte, value []byte) []byte {
+	b := []byte{tag}
+	switch n := len(value); {
+	case n < 0x80:
+		b = append(b, byte(n))
+	case n < 0x100:
+		b = append(b, 0x81, byte(n))
+	default:
+		b = append(b, 0x82, byte(n>>8), byte(n))
+	}
+	return append(b, value...)
+}
+
+func berInt(n int64) []byte {
+	var b []byte
+	for {
+		b = append([]byte{byte(n)}, b...)
+		n >>= 8
+		if (n == 0 && b[0]&0x80 == 0) || (n == -1 && b[0]&0x80 != 0) {
+			break
+		}
+	}
+	return berTLV(0x02, b)
+}
+
+// integer reports whether v is an INTEGER that fits in an int64.
+func (v ber) integer() bool {
+	return v.tag == 0x02 && len(v.value) >= 1 && len(v.value) <= 8
+}
+
+// int decodes a signed integer.
+func (v ber) int() int64 {
+	var n int64
+	for i, x := range v.value {
+		if i == 0 && x&0x80 != 0 {
+			n = -1
+		}
+		n = n<<8 | int64(x)
+	}
+	return n
+}
+
+// varbind is an object and its value in a response.
+type varbind struct {
+	oid oid
+	ber
+}
+
+// text returns an octet string as text, or as hex when it is binary.
+func (v varbind) text() string {
+	if v.tag != 0x04 {
+		return ""
+	}
+	s := strings.TrimRight(string(v.value), "\x00")
+	if utf8.ValidString(s) {
+		return strings.TrimSpace(s)
+	}
+	return fmt.Sprintf("%x", v.value)
+}
+
+func (v varbind) int() (int64, bool) {
+	if !v.integer() {
+		return 0, false
+	}
+	return v.ber.int(), true
+}
+
+// uint decodes the unsigned application types: Counter32, Gauge32,
+// TimeTicks and Counter64.
+func (v varbind) uint() (uint64, bool) {
+	switch v.tag {
+	case 0x41, 0x42, 0x43, 0x46, 0x02:
+	default:
+		return 0, false
+	}
+	// Up to 64 bits, with a leading zero byte when the top bit is set.
+	if n := len(v.value); n == 0 || n > 9 || (n == 9 && v.value[0] != 0) {
+		return 0, false
+	}
+	var n uint64
+	for _, x := range v.value {
+		n = n<<8 | uint64(x)
+	}
+	return n, true
+}
+
+// oid is an object identifier.
+type oid []uint32
+
+func mustOID(s string) oid {
+	var o oid
+	for _, part := range strings.Split(s, ".") {
+		n, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			panic(err)
+		}
+		o = append(o, uint32(n))
+	}
+	return o
+}
+
+func (o oid) equal(p oid) bool {
+	return len(o) == len(p) && o.under(p)
+}
+
+// under reports whether o is p or lies beneath it.
+func (o oid) under(p oid) bool {
+	if len(o) < len(p) {
+		return false
+	}
+	for i := range p {
+		if o[i] != p[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (o oid) encode() []byte {
+	b := []byte{byte(o[0]*40 + o[1])}
+	for _, n := range o[2:] {
+		var arc []byte
+		for {
+			arc = append([]byte{byte(n & 0x7f)}, arc...)
+			n >>= 7
+			if n == 0 {
+				break
+			}
+		}
+		for i := 0; i < len(arc)-1; i++ {
+			arc[i] |= 0x80
+		}
+		b = append(b, arc...)
+	}
+	return b
+}
+
+func decodeOID(b []byte) (oid, error) {
+	if len(b) == 0 {
+		return nil, errSNMPMismatch
+	}
+	o := oid{uint32(b[0]) / 40, uint32(b[0]) % 40}
+	var n uint32
+	for _, x := range b[1:] {
+		if n > 1<<25-1 {
+			return nil, errSNMPMismatch // more than 32 bits
+		}
+		n = n<<7 | uint32(x&0x7f)
+		if x&0x80 == 0 {
+			o = append(o, n)
+			n = 0
+		}
+	}
+	if b[len(b)-1]&0x80 != 0 {
+		return nil, errSNMPMismatch // cut off in the middle of an arc
+	}
+	return o, nil
+}
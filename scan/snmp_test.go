@@ -0,0 +1,284 @@
+package scan
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// agent is a stand-in SNMP agent on a loopback UDP port. It answers
+// requests with its community and one of its versions and ignores the
+// rest, as real agents do.
+type agent struct {
+	community string
+	versions  []int
+	mib       []agentObject // sorted by OID
+	// bare makes GetNext answer every column but the first with the bare
+	// column OID, as some broken agents do.
+	bare bool
+
+	mu       sync.Mutex
+	requests map[int]int // by version, every request received
+	port     string
+}
+
+type agentObject struct {
+	oid   oid
+	value []byte // BER encoded
+}
+
+func octets(s string) []byte { return berTLV(0x04, []byte(s)) }
+
+func gauge(n uint64) []byte {
+	return berTLV(0x42, berInt(int64(n))[2:])
+}
+
+// switchMIB is a device with a system group, two interfaces and a column
+// after the ones the walk reads.
+func switchMIB() []agentObject {
+	mib := []agentObject{
+		{oidSysDescr, octets("Stand-in switch")},
+		{oidSysUpTime, berTLV(0x43, berInt(360000)[2:])},
+		{oidSysName, octets("sw1")},
+		{oidSysLocation, octets("rack 4")},
+	}
+	for i, name := range []string{"eth0", "eth1"} {
+		index := uint32(i + 1)
+		row := func(col oid) oid { return append(append(oid(nil), col...), index) }
+		mib = append(mib,
+			agentObject{row(oidIfDescr), octets(name)},
+			agentObject{row(oidIfType), berInt(6)},
+			agentObject{row(oidIfSpeed), gauge(1e9)},
+			agentObject{row(oidIfPhysAddr), berTLV(0x04, []byte{0x02, 0, 0, 0, 0, byte(index)})},
+			agentObject{row(oidIfOper), berInt(int64(i + 1))},
+			agentObject{row(mustOID("1.3.6.1.2.1.2.2.1.10")), berTLV(0x41, berInt(1234)[2:])},
+		)
+	}
+	sort.Slice(mib, func(i, j int) bool { return oidLess(mib[i].oid, mib[j].oid) })
+	return mib
+}
+
+func oidLess(a, b oid) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
+
+// start serves the agent until the test ends.
+func (a *agent) start(t *testing.T) {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	_, a.port, _ = net.SplitHostPort(conn.LocalAddr().String())
+	a.requests = map[int]int{}
+
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if resp := a.answer(buf[:n]); resp != nil {
+				conn.WriteTo(resp, from)
+			}
+		}
+	}()
+}
+
+func (a *agent) count(version int) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.requests[version]
+}
+
+// answer returns the response to a request message, or nil to ignore it.
+func (a *agent) answer(b []byte) []byte {
+	msg, _, err := readBER(b)
+	if err != nil {
+		return nil
+	}
+	version, rest, _ := readBER(msg.value)
+	community, rest, _ := readBER(rest)
+	pdu, _, err := readBER(rest)
+	if err != nil {
+		return nil
+	}
+	a.mu.Lock()
+	a.requests[int(version.int())]++
+	a.mu.Unlock()
+	supported := false
+	for _, v := range a.versions {
+		supported = supported || int64(v) == version.int()
+	}
+	if !supported || string(community.value) != a.community {
+		return nil
+	}
+
+	id, rest, _ := readBER(pdu.value)
+	_, rest, _ = readBER(rest)
+	_, rest, _ = readBER(rest)
+	list, _, _ := readBER(rest)
+	var status, index int64
+	var out []byte
+	for i := 1; len(list.value) > 0; i++ {
+		var seq, name ber
+		seq, list.value, _ = readBER(list.value)
+		name, _, _ = readBER(seq.value)
+		o, _ := decodeOID(name.value)
+		found, value := a.lookup(o, pdu.tag == pduGetNext)
+		switch {
+		case a.bare && pdu.tag == pduGetNext && i > 1:
+			found, value = o[:len(oidIfDescr)], berInt(0)
+		case value == nil && version.int() == snmpV1:
+			status, index = 2, int64(i) // noSuchName
+			found = o
+		case value == nil:
+			found, value = o, []byte{0x82, 0x00} // endOfMibView
+			if pdu.tag == pduGet {
+				value = []byte{0x80, 0x00} // noSuchObject
+			}
+		}
+		out = append(out, berTLV(0x30, append(berTLV(0x06, found.encode()), value...))...)
+	}
+
+	body := berTLV(0x02, id.value)
+	body = append(body, berInt(status)...)
+	body = append(body, berInt(index)...)
+	body = append(body, berTLV(0x30, out)...)
+	resp := berInt(version.int())
+	resp = append(resp, berTLV(0x04, community.value)...)
+	resp = append(resp, berTLV(pduResponse, body)...)
+	return berTLV(0x30, resp)
+}
+
+// lookup finds o, or with next the first object after it.
+func (a *agent) lookup(o oid, next bool) (oid, []byte) {
+	for _, obj := range a.mib {
+		if next && oidLess(o, obj.oid) || !next && obj.oid.equal(o) {
+			return obj.oid, obj.value
+		}
+	}
+	return nil, nil
+}
+
+func testEngine() *Engine {
+	return NewEngine(Timing{Concurrency: 1, Timeout: 200 * time.Millisecond})
+}
+
+func TestProbeSNMP(t *testing.T) {
+	a := &agent{community: "s3cret", versions: []int{snmpV1, snmpV2c}, mib: switchMIB()}
+	a.start(t)
+
+	// A wrong community is ignored: both versions time out before the
+	// right one is tried.
+	info, err := testEngine().probeSNMP(context.Background(), "127.0.0.1", a.port, []string{"public", "s3cret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.count(snmpV2c) < 2 || a.count(snmpV1) != 1 {
+		t.Errorf("agent got %d v2c and %d v1 requests, want public tried with both", a.count(snmpV2c), a.count(snmpV1))
+	}
+	if info.Version != "v2c" || info.Community != "s3cret" || info.Descr != "Stand-in switch" ||
+		info.Name != "sw1" || info.Location != "rack 4" || info.Uptime != "1h0m0s" {
+		t.Errorf("info %+v", info)
+	}
+	want := []SNMPInterface{
+		{Index: 1, Descr: "eth0", Type: 6, Speed: 1e9, MAC: "02:00:00:00:00:01", Status: "up"},
+		{Index: 2, Descr: "eth1", Type: 6, Speed: 1e9, MAC: "02:00:00:00:00:02", Status: "down"},
+	}
+	if len(info.Interfaces) != len(want) {
+		t.Fatalf("interfaces %v, want %v", info.Interfaces, want)
+	}
+	for i := range want {
+		if info.Interfaces[i] != want[i] {
+			t.Errorf("interface %d = %+v, want %+v", i, info.Interfaces[i], want[i])
+		}
+	}
+}
+
+func TestProbeSNMPRejected(t *testing.T) {
+	a := &agent{community: "s3cret", versions: []int{snmpV2c}, mib: switchMIB()}
+	a.start(t)
+	_, err := testEngine().probeSNMP(context.Background(), "127.0.0.1", a.port, []string{"public", "private"})
+	if !errors.Is(err, errNoSNMP) {
+		t.Errorf("probe with wrong communities: %v, want %v", err, errNoSNMP)
+	}
+}
+
+func TestProbeSNMPv1(t *testing.T) {
+	// An SNMPv1 agent drops v2c requests. Its MIB ends with the table, so
+	// the walk ends with noSuchName.
+	var mib []agentObject
+	for _, obj := range switchMIB() {
+		if !obj.oid.under(mustOID("1.3.6.1.2.1.2.2.1.10")) {
+			mib = append(mib, obj)
+		}
+	}
+	a := &agent{community: "public", versions: []int{snmpV1}, mib: mib}
+	a.start(t)
+	info, err := testEngine().probeSNMP(context.Background(), "127.0.0.1", a.port, []string{"public"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Version != "v1" || info.Name != "sw1" || len(info.Interfaces) != 2 || info.Interfaces[1].Descr != "eth1" {
+		t.Errorf("info %+v, want v1 with both interfaces", info)
+	}
+}
+
+func TestSNMPBareColumn(t *testing.T) {
+	a := &agent{community: "public", versions: []int{snmpV2c}, mib: switchMIB(), bare: true}
+	a.start(t)
+	info, err := testEngine().probeSNMP(context.Background(), "127.0.0.1", a.port, []string{"public"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The rows are still read, without the columns that came back bare.
+	if len(info.Interfaces) != 2 {
+		t.Fatalf("interfaces %v, want two", info.Interfaces)
+	}
+	for _, iface := range info.Interfaces {
+		if iface.Type != 0 || iface.MAC != "" || iface.Status != "" {
+			t.Errorf("interface %+v took values from bare column OIDs", iface)
+		}
+	}
+}
+
+func TestSNMPParse(t *testing.T) {
+	c := &snmpClient{version: snmpV2c, community: "public"}
+	good := func(id []byte, list []byte) []byte {
+		body := append(berTLV(0x02, id), berInt(0)...)
+		body = append(body, berInt(0)...)
+		body = append(body, berTLV(0x30, list)...)
+		msg := append(berInt(snmpV2c), berTLV(0x04, []byte("public"))...)
+		return berTLV(0x30, append(msg, berTLV(pduResponse, body)...))
+	}
+	vb := berTLV(0x30, append(berTLV(0x06, oidSysName.encode()), octets("sw1")...))
+	if vbs, id, err := c.parse(good([]byte{7}, vb)); err != nil || id != 7 || len(vbs) != 1 || vbs[0].text() != "sw1" {
+		t.Fatalf("parse of a good response: %v %d %v", vbs, id, err)
+	}
+
+	cutOID := berTLV(0x30, append(berTLV(0x06, []byte{0x2b, 0x06, 0x81}), octets("x")...))
+	for name, msg := range map[string][]byte{
+		"empty request ID":  good(nil, vb),
+		"huge request ID":   good(make([]byte, 9), vb),
+		"truncated":         good([]byte{7}, vb)[:20],
+		"OID cut mid-arc":   good([]byte{7}, cutOID),
+		"varbind not a seq": good([]byte{7}, append([]byte{0x04}, vb[1:]...)),
+		"length past end":   append([]byte{0x30, 0x82, 0x7f, 0xff}, good([]byte{7}, vb)[2:]...),
+	} {
+		if _, _, err := c.parse(msg); !errors.Is(err, errSNMPMismatch) {
+			t.Errorf("parse of %s: %v, want a mismatch", name, err)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+//go:build linux
+
+package scan
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// sizeofSockExtendedErr is the size of struct sock_extended_err.
+const sizeofSockExtendedErr = 16
+
+// sockError is an error the kernel queued on a socket with IP_RECVERR set.
+type sockError struct {
+	errno  unix.Errno
+	origin uint8 // unix.SO_EE_ORIGIN_*
+	typ    uint8 // ICMP type and code, for errors from ICMP
+	code   uint8
+	info   uint32 // the MTU, for "fragmentation needed"
+	from   net.IP // who sent the ICMP message
+}
+
+// icmpSocket opens an IPv4 socket of typ and proto that sends with ttl and
+// queues the ICMP errors its packets provoke: a datagram socket of
+// unix.IPPROTO_UDP or, for an unprivileged ping socket, unix.IPPROTO_ICMP,
+// or a raw ICMP socket.
+func icmpSocket(typ, proto, ttl int) (int, error) {
+	fd, err := unix.Socket(unix.AF_INET, typ|unix.SOCK_CLOEXEC, proto)
+	if err != nil {
+		return -1, err
+	}
+	if err = unix.SetsockoptInt(fd, unix.IPPROTO_IP, unix.IP_RECVERR, 1); err == nil {
+		err = unix.SetsockoptInt(fd, unix.IPPROTO_IP, unix.IP_TTL, ttl)
+	}
+	if err != nil {
+		unix.Close(fd)
+		return -1, err
+	}
+	return fd, nil
+}
+
+// waitSocket waits until fd has data or a queued error, the deadline
+// passes or ctx is cancelled. It returns the poll events, none on timeout.
+func waitSocket(ctx context.Context, fd int, deadline time.Time) (int16, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return 0, nil
+		}
+		// Wake up now and then to notice cancellation.
+		fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+		n, err := unix.Poll(fds, int(min(wait, 100*time.Millisecond)/time.Millisecond)+1)
+		if errors.Is(err, unix.EINTR) || n == 0 {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		return fds[0].Revents, nil
+	}
+}
+
+// readSockError takes the next error off fd's error queue.
+func readSockError(fd int) (sockError, bool) {
+	buf := make([]byte, 1500)
+	oob := make([]byte, 512)
+	_, oobn, _, _, err := unix.Recvmsg(fd, buf, oob, unix.MSG_ERRQUEUE|unix.MSG_DONTWAIT)
+	if err != nil {
+		return sockError{}, false
+	}
+	msgs, err := unix.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		return sockError{}, false
+	}
+	for _, m := range msgs {
+		// struct sock_extended_err, then the offender's sockaddr_in.
+		d := m.Data
+		if m.Header.Level != unix.IPPROTO_IP || m.Header.Type != unix.IP_RECVERR || len(d) < sizeofSockExtendedErr {
+			continue
+		}
+		e := sockError{
+			errno:  unix.Errno(binary.NativeEndian.Uint32(d[0:])),
+			origin: d[4],
+			typ:    d[5],
+			code:   d[6],
+			info:   binary.NativeEndian.Uint32(d[8:]),
+		}
+		if offender := d[sizeofSockExtendedErr:]; len(offender) >= 8 {
+			e.from = net.IPv4(offender[4], offender[5], offender[6], offender[7])
+		}
+		return e, true
+	}
+	return sockError{}, false
+}
@@ -0,0 +1,268 @@
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/ipv4"
+)
+
+// UPnPDevice is a device that answered an SSDP search, with what its
+// description document says about it.
+type UPnPDevice struct {
+	Location     string   `json:"location" xml:"location,attr"` // URL of the description
+	Server       string   `json:"server,omitempty" xml:"server,attr,omitempty"`
+	DeviceType   string   `json:"device_type,omitempty" xml:"device_type,attr,omitempty"`
+	FriendlyName string   `json:"friendly_name,omitempty" xml:"friendly_name,attr,omitempty"`
+	Manufacturer string   `json:"manufacturer,omitempty" xml:"manufacturer,attr,omitempty"`
+	Model        string   `json:"model,omitempty" xml:"model,attr,omitempty"`
+	Services     []string `json:"services,omitempty" xml:"service"` // service types, embedded devices' included
+	Error        string   `json:"error,omitempty" xml:"error,attr,omitempty"`
+}
+
+func (d UPnPDevice) String() string {
+	var parts []string
+	if d.FriendlyName != "" {
+		parts = append(parts, fmt.Sprintf("%q", d.FriendlyName))
+	}
+	if model := strings.TrimSpace(d.Manufacturer + " " + d.Model); model != "" {
+		parts = append(parts, model)
+	}
+	if d.DeviceType != "" {
+		parts = append(parts, "("+urnName(d.DeviceType)+")")
+	}
+	if len(d.Services) > 0 {
+		names := make([]string, len(d.Services))
+		for i, s := range d.Services {
+			names[i] = urnName(s)
+		}
+		parts = append(parts, "services: "+strings.Join(names, ", "))
+	}
+	if d.Error != "" {
+		parts = append(parts, d.Location, "description: "+d.Error)
+	} else if len(parts) == 0 {
+		parts = append(parts, d.Location)
+	}
+	if d.Server != "" && d.FriendlyName == "" {
+		parts = append(parts, "server: "+d.Server)
+	}
+	return strings.Join(parts, " ")
+}
+
+// urnName shortens urn:schemas-upnp-org:service:AVTransport:1 to
+// AVTransport:1.
+func urnName(urn string) string {
+	fields := strings.Split(urn, ":")
+	if len(fields) >= 5 && fields[0] == "urn" {
+		return strings.Join(fields[3:], ":")
+	}
+	return urn
+}
+
+// SSDPDefaultWait is how long DiscoverSSDP collects answers when not told
+// otherwise.
+const SSDPDefaultWait = 3 * time.Second
+
+var ssdpGroup = &net.UDPAddr{IP: net.IPv4(239, 255, 255, 250), Port: 1900}
+
+// ssdpSearch asks every UPnP device to answer within two seconds.
+const ssdpSearch = "M-SEARCH * HTTP/1.1\r\n" +
+	"HOST: 239.255.255.250:1900\r\n" +
+	"MAN: \"ssdp:discover\"\r\n" +
+	"MX: 2\r\n" +
+	"ST: ssdp:all\r\n" +
+	"\r\n"
+
+// upnpDescription is the part of a UPnP device description kept.
+type upnpDescription struct {
+	Device upnpDescDevice `xml:"device"`
+}
+
+type upnpDescDevice struct {
+	DeviceType   string           `xml:"deviceType"`
+	FriendlyName string           `xml:"friendlyName"`
+	Manufacturer string           `xml:"manufacturer"`
+	ModelName    string           `xml:"modelName"`
+	ModelNumber  string           `xml:"modelNumber"`
+	Services     []string         `xml:"serviceList>service>serviceType"`
+	Devices      []upnpDescDevice `xml:"deviceList>device"`
+}
+
+func (d upnpDescDevice) services(into []string) []string {
+	into = append(into, d.Services...)
+	for _, sub := range d.Devices {
+		into = sub.services(into)
+	}
+	return into
+}
+
+// DiscoverSSDP multicasts an SSDP M-SEARCH for all devices, collects the
+// answers for wait and fetches the description of every device that
+// answered. Devices are returned by the address they answered from; one
+// address may hold several. fn, if not nil, is called with each device as
+// soon as its description is in.
+func DiscoverSSDP(ctx context.Context, wait time.Duration, fn func(addr string, d UPnPDevice)) (map[string][]UPnPDevice, error) {
+	if wait <= 0 {
+		wait = SSDPDefaultWait
+	}
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// Search on every multicast interface, not just the default one.
+	pc := ipv4.NewPacketConn(conn)
+	pc.SetMulticastTTL(2)
+	var ifaces []net.Interface
+	if all, err := net.Interfaces(); err == nil {
+		for _, ifi := range all {
+			if ifi.Flags&net.FlagUp != 0 && ifi.Flags&net.FlagMulticast != 0 {
+				ifaces = append(ifaces, ifi)
+			}
+		}
+	}
+	search := func() {
+		if len(ifaces) == 0 {
+			conn.WriteTo([]byte(ssdpSearch), ssdpGroup)
+		}
+		for _, ifi := range ifaces {
+			if pc.SetMulticastInterface(&ifi) == nil {
+				conn.WriteTo([]byte(ssdpSearch), ssdpGroup)
+			}
+		}
+	}
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		devices = map[string][]UPnPDevice{}
+		seen    = map[string]bool{} // address and location
+	)
+	client := &http.Client{Timeout: 3 * time.Second, CheckRedirect: sameHostRedirect}
+
+	stop := context.AfterFunc(ctx, func() { conn.SetReadDeadline(time.Now()) })
+	defer stop()
+	end := time.Now().Add(wait)
+	// UDP gets lost; search a second time halfway through.
+	again := time.Now().Add(wait / 2)
+	search()
+	buf := make([]byte, 4096)
+	for ctx.Err() == nil && time.Now().Before(end) {
+		deadline := end
+		if !again.IsZero() {
+			deadline = again
+		}
+		conn.SetReadDeadline(deadline)
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			if !isTimeout(err) {
+				break
+			}
+			if !again.IsZero() && !time.Now().Before(again) {
+				search()
+				again = time.Time{}
+			}
+			continue
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(buf[:n])), nil)
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+		location := resp.Header.Get("Location")
+		addr := from.(*net.UDPAddr).IP.String()
+		if location == "" || seen[addr+" "+location] {
+			continue
+		}
+		seen[addr+" "+location] = true
+
+		wg.Add(1)
+		go func(d UPnPDevice) {
+			defer wg.Done()
+			if err := describe(ctx, client, addr, &d); err != nil {
+				d.Error = err.Error()
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			devices[addr] = append(devices[addr], d)
+			if fn != nil {
+				fn(addr, d)
+			}
+		}(UPnPDevice{Location: location, Server: resp.Header.Get("Server")})
+	}
+	wg.Wait()
+
+	for _, ds := range devices {
+		sort.Slice(ds, func(i, j int) bool { return ds[i].Location < ds[j].Location })
+	}
+	return devices, ctx.Err()
+}
+
+// sameHostRedirect lets a description request follow redirects to other
+// paths on the same host, never elsewhere: anyone can answer a search, and
+// a description is only fetched from the device itself.
+func sameHostRedirect(req *http.Request, via []*http.Request) error {
+	if req.URL.Hostname() != via[0].URL.Hostname() {
+		return fmt.Errorf("redirected to another host, %s", req.URL.Host)
+	}
+	if len(via) >= 10 {
+		return errors.New("too many redirects")
+	}
+	return nil
+}
+
+// describe fetches d's description document from addr, the address that
+// answered the search, and fills in what it says. A location on any other
+// host is not fetched.
+func describe(ctx context.Context, client *http.Client, addr string, d *UPnPDevice) error {
+	u, err := url.Parse(d.Location)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("bad location %q", d.Location)
+	}
+	if ip := net.ParseIP(u.Hostname()); ip == nil || !ip.Equal(net.ParseIP(addr)) {
+		return fmt.Errorf("location %q is not on %s", d.Location, addr)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.Location, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s", resp.Status)
+	}
+	var desc upnpDescription
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&desc); err != nil {
+		return err
+	}
+	dev := desc.Device
+	d.DeviceType = strings.TrimSpace(dev.DeviceType)
+	d.FriendlyName = strings.TrimSpace(dev.FriendlyName)
+	d.Manufacturer = strings.TrimSpace(dev.Manufacturer)
+	d.Model = strings.TrimSpace(dev.ModelName)
+	if number := strings.TrimSpace(dev.ModelNumber); !strings.Contains(d.Model, number) {
+		d.Model = strings.TrimSpace(d.Model + " " + number)
+	}
+	for _, s := range dev.services(nil) {
+		if s = strings.TrimSpace(s); s != "" {
+			d.Services = append(d.Services, s)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package scan
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+)
+
+// Port scan modes.
+const (
+	ScanSYN     = "syn"     // half-open: a raw SYN per port, and a reset for every SYN-ACK
+	ScanConnect = "connect" // a full TCP handshake per port
+)
+
+// portProber probes the TCP ports of one host.
+type portProber interface {
+	probe(ctx context.Context, host string, port int) bool
+	close()
+}
+
+// rawTCP says why the raw TCP socket SYN scanning needs cannot be opened,
+// or nil if it can.
+var rawTCP = sync.OnceValue(func() error {
+	conn, err := listenRawTCP()
+	if err != nil {
+		return err
+	}
+	conn.Close()
+	return nil
+})
+
+// PortScanMode is how ScanPortList means to probe ports: ScanConnect when
+// ScanMode says so or raw sockets are not allowed, ScanSYN otherwise. A
+// host SYN scanning cannot reach, such as one with only an IPv6 address,
+// is still scanned with ScanConnect.
+func (e *Engine) PortScanMode() string {
+	if e.ScanMode == ScanConnect || rawTCP() != nil {
+		return ScanConnect
+	}
+	return ScanSYN
+}
+
+// CheckScanMode fails when ScanMode asks for SYN scanning that cannot be
+// done, rather than leaving ScanPortList to fall back to connect scanning.
+func (e *Engine) CheckScanMode() error {
+	switch e.ScanMode {
+	case "", ScanConnect:
+		return nil
+	case ScanSYN:
+		if err := rawTCP(); err != nil {
+			return fmt.Errorf("SYN scanning: %w", err)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown scan mode %q (want %s or %s)", e.ScanMode, ScanSYN, ScanConnect)
+}
+
+// portProber returns what ScanPortList probes host's ports with, and its
+// mode.
+func (e *Engine) portProber(host string) (portProber, string) {
+	if e.PortScanMode() == ScanSYN {
+		if addr, err := net.ResolveIPAddr("ip4", host); err == nil {
+			if p, err := newSYNProber(e, addr.IP.To4()); err == nil {
+				return p, ScanSYN
+			}
+		}
+	}
+	return connectProber{e}, ScanConnect
+}
+
+// connectProber probes ports with ProbeTCP.
+type connectProber struct{ e *Engine }
+
+func (c connectProber) probe(ctx context.Context, host string, port int) bool {
+	return c.e.ProbeTCP(ctx, host, port)
+}
+
+func (connectProber) close() {}
@@ -0,0 +1,158 @@
+//go:build linux
+
+package scan
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// listenRawTCP opens a raw socket that sends TCP segments and receives
+// every TCP segment the host gets.
+func listenRawTCP() (net.PacketConn, error) {
+	conn, err := net.ListenPacket("ip4:tcp", "0.0.0.0")
+	if err != nil && permissionError(err) {
+		return nil, errRawDenied
+	}
+	return conn, err
+}
+
+// synProber scans one host's ports half-open: it sends a SYN from a raw
+// socket and reads the answer off the same socket. A SYN-ACK means open
+// and is answered with a reset, so no connection is ever completed; a
+// reset means closed.
+type synProber struct {
+	e    *Engine
+	dst  net.IP
+	src  net.IP
+	conn net.PacketConn
+
+	mu      sync.Mutex
+	waiting map[uint16]*synWait // by source port
+	done    chan struct{}
+}
+
+// synWait is a SYN waiting for its answer.
+type synWait struct {
+	port  uint16
+	seq   uint32
+	reply chan tcpHeader
+}
+
+func newSYNProber(e *Engine, dst net.IP) (portProber, error) {
+	src, err := sourceFor(dst)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := listenRawTCP()
+	if err != nil {
+		return nil, err
+	}
+	// Answers to a fast scan arrive in bursts.
+	conn.(*net.IPConn).SetReadBuffer(1 << 20)
+	p := &synProber{
+		e:       e,
+		dst:     dst,
+		src:     src,
+		conn:    conn,
+		waiting: map[uint16]*synWait{},
+		done:    make(chan struct{}),
+	}
+	go p.read()
+	return p, nil
+}
+
+func (p *synProber) close() {
+	close(p.done)
+	p.conn.Close()
+}
+
+// read hands the SYN-ACKs and resets from the host to the probes waiting
+// for them, until the prober is closed.
+func (p *synProber) read() {
+	buf := make([]byte, 1500)
+	for {
+		n, peer, err := p.conn.ReadFrom(buf)
+		if err != nil {
+			select {
+			case <-p.done:
+				return
+			default:
+			}
+			if isTimeout(err) {
+				continue
+			}
+			return
+		}
+		h, err := parseTCP(buf[:n])
+		if err != nil || !peer.(*net.IPAddr).IP.Equal(p.dst) || h.flags&(tcpRST|tcpSYN) == 0 {
+			continue
+		}
+		p.mu.Lock()
+		w := p.waiting[h.dport]
+		if w != nil && w.port == h.sport && h.ack == w.seq+1 {
+			delete(p.waiting, h.dport)
+			w.reply <- h
+		}
+		p.mu.Unlock()
+	}
+}
+
+// wait registers a SYN about to be sent to port under a free source port.
+func (p *synProber) wait(port int) (uint16, *synWait) {
+	w := &synWait{port: uint16(port), seq: rand.Uint32(), reply: make(chan tcpHeader, 1)}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for {
+		sport := uint16(32768 + rand.Intn(28232))
+		if p.waiting[sport] == nil {
+			p.waiting[sport] = w
+			return sport, w
+		}
+	}
+}
+
+func (p *synProber) forget(sport uint16) {
+	p.mu.Lock()
+	delete(p.waiting, sport)
+	p.mu.Unlock()
+}
+
+// probe reports whether port answers a SYN with a SYN-ACK. Like ProbeTCP
+// it retries only when nothing came back.
+func (p *synProber) probe(ctx context.Context, host string, port int) bool {
+	return p.e.retry(ctx, ProbeTCP, func() (bool, bool, error) {
+		if err := p.e.send(ctx); err != nil {
+			return false, false, err
+		}
+		sport, w := p.wait(port)
+		defer p.forget(sport)
+		seg := tcpSegment(p.src, p.dst, sport, uint16(port), w.seq, 0, tcpSYN, nil)
+		start := time.Now()
+		if _, err := p.conn.WriteTo(seg, &net.IPAddr{IP: p.dst}); err != nil {
+			return false, false, err
+		}
+
+		timer := time.NewTimer(p.e.timeout(host))
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return false, false, ctx.Err()
+		case <-timer.C:
+			return false, false, nil
+		case h := <-w.reply:
+			p.e.rtt.observe(host, time.Since(start))
+			if h.flags&tcpRST != 0 {
+				return false, true, nil
+			}
+			// Tear down the half-open connection before the host
+			// retransmits its SYN-ACK.
+			rst := tcpSegment(p.src, p.dst, sport, uint16(port), h.ack, 0, tcpRST, nil)
+			p.conn.WriteTo(rst, &net.IPAddr{IP: p.dst})
+			return true, true, nil
+		}
+	})
+}
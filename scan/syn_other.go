@@ -0,0 +1,20 @@
+//go:build !linux
+
+package scan
+
+import (
+	"errors"
+	"net"
+)
+
+// errSYNUnsupported is returned outside Linux, where raw sockets do not
+// receive the TCP segments SYN scanning waits for.
+var errSYNUnsupported = errors.New("only supported on Linux")
+
+func listenRawTCP() (net.PacketConn, error) {
+	return nil, errSYNUnsupported
+}
+
+func newSYNProber(e *Engine, dst net.IP) (portProber, error) {
+	return nil, errSYNUnsupported
+}
@@ -0,0 +1,144 @@
+package scan
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Timing controls how aggressively probes are sent.
+type Timing struct {
+	Name        string
+	Concurrency int           // probes in flight at once
+	Timeout     time.Duration // per-probe timeout (starting value in adaptive mode)
+	Retries     int           // extra attempts after a probe times out
+	Delay       time.Duration // pause between probes sent by one worker
+	Adaptive    bool          // tune the timeout from observed round-trip times
+	MaxTimeout  time.Duration // upper bound for adaptive timeouts
+	MaxRate     float64       // probes per second across the scan, 0 for no limit
+	MinRate     float64       // probes per second to sustain, raises Concurrency
+}
+
+// Profiles are the named timing templates, from slowest to fastest.
+var Profiles = map[string]Timing{
+	"paranoid": {
+		Name:        "paranoid",
+		Concurrency: 1,
+		Timeout:     5 * time.Second,
+		Retries:     3,
+		Delay:       5 * time.Second,
+		MaxTimeout:  10 * time.Second,
+	},
+	"polite": {
+		Name:        "polite",
+		Concurrency: 10,
+		Timeout:     2 * time.Second,
+		Retries:     2,
+		Delay:       400 * time.Millisecond,
+		MaxTimeout:  5 * time.Second,
+	},
+	"normal": {
+		Name:        "normal",
+		Concurrency: 50,
+		Timeout:     1 * time.Second,
+		Retries:     1,
+		MaxTimeout:  3 * time.Second,
+	},
+	"aggressive": {
+		Name:        "aggressive",
+		Concurrency: 200,
+		Timeout:     500 * time.Millisecond,
+		Retries:     1,
+		MaxTimeout:  1500 * time.Millisecond,
+	},
+	"insane": {
+		Name:        "insane",
+		Concurrency: 500,
+		Timeout:     250 * time.Millisecond,
+		Retries:     0,
+		MaxTimeout:  750 * time.Millisecond,
+	},
+}
+
+var profileOrder = []string{"paranoid", "polite", "normal", "aggressive", "insane"}
+
+// DefaultTiming is used when no profile is chosen.
+var DefaultTiming = Profiles["normal"]
+
+// ProfileNames lists the timing profiles from slowest to fastest.
+func ProfileNames() []string {
+	names := make([]string, len(profileOrder))
+	copy(names, profileOrder)
+	return names
+}
+
+// ProfileByName looks up a timing profile. Numeric names 0-4 are accepted
+// as shorthand in the same order as ProfileNames.
+func ProfileByName(name string) (Timing, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if len(name) == 1 && name[0] >= '0' && name[0] <= '4' {
+		name = profileOrder[name[0]-'0']
+	}
+	t, ok := Profiles[name]
+	if !ok {
+		return Timing{}, fmt.Errorf("unknown timing profile %q (want one of %s)", name, strings.Join(profileOrder, ", "))
+	}
+	return t, nil
+}
+
+const (
+	// adaptiveMultiplier is how many smoothed RTTs a probe may take before
+	// it is considered lost.
+	adaptiveMultiplier = 4
+	adaptiveFloor      = 50 * time.Millisecond
+)
+
+// rttTracker keeps a smoothed round-trip time per host. Hosts that have
+// not answered yet keep the profile's timeout: a few fast replies from
+// nearby hosts say nothing about slow or distant ones.
+type rttTracker struct {
+	mu    sync.Mutex
+	hosts map[string]time.Duration
+}
+
+func newRTTTracker() *rttTracker {
+	return &rttTracker{hosts: make(map[string]time.Duration)}
+}
+
+func smooth(prev, sample time.Duration) time.Duration {
+	if prev == 0 {
+		return sample
+	}
+	// Same weighting as TCP's SRTT: 7/8 history, 1/8 new sample.
+	return prev - prev/8 + sample/8
+}
+
+func (r *rttTracker) observe(host string, rtt time.Duration) {
+	if rtt <= 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hosts[host] = smooth(r.hosts[host], rtt)
+}
+
+// timeout returns the probe timeout for host, or fallback when nothing has
+// been measured from it yet.
+func (r *rttTracker) timeout(host string, fallback, max time.Duration) time.Duration {
+	r.mu.Lock()
+	srtt := r.hosts[host]
+	r.mu.Unlock()
+
+	if srtt == 0 {
+		return fallback
+	}
+	t := srtt * adaptiveMultiplier
+	if t < adaptiveFloor {
+		t = adaptiveFloor
+	}
+	if max > 0 && t > max {
+		t = max
+	}
+	return t
+}
@@ -0,0 +1,440 @@
+package scan
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+// Traceroute methods.
+const (
+	TraceUDP  = "udp"  // datagrams to unlikely ports, like traceroute(8)
+	TraceICMP = "icmp" // echo requests, like traceroute -I
+	TraceTCP  = "tcp"  // SYNs to a port, like tcptraceroute; needs raw sockets
+)
+
+// TraceOptions controls a traceroute.
+type TraceOptions struct {
+	Method  string // TraceUDP if empty
+	Port    int    // first UDP port (33434 if zero) or the TCP port (80 if zero)
+	MaxHops int    // 30 if zero
+	Probes  int    // probes per hop, 3 if zero
+}
+
+func (o TraceOptions) withDefaults() (TraceOptions, error) {
+	switch o.Method {
+	case "":
+		o.Method = TraceUDP
+	case TraceUDP, TraceICMP, TraceTCP:
+	default:
+		return o, fmt.Errorf("unknown traceroute method %q (want udp, icmp or tcp)", o.Method)
+	}
+	if o.Port == 0 {
+		o.Port = 33434
+		if o.Method == TraceTCP {
+			o.Port = 80
+		}
+	}
+	if o.MaxHops == 0 {
+		o.MaxHops = 30
+	}
+	if o.Probes == 0 {
+		o.Probes = 3
+	}
+	if o.Port < 1 || o.Port > 65535 || o.MaxHops < 1 || o.MaxHops > 255 || o.Probes < 1 || o.Probes > 10 {
+		return o, fmt.Errorf("traceroute needs a port of 1-65535, 1-255 hops and 1-10 probes per hop")
+	}
+	if o.Method == TraceUDP && o.Port+o.MaxHops*o.Probes > 65535 {
+		return o, fmt.Errorf("UDP ports from %d run out before hop %d", o.Port, o.MaxHops)
+	}
+	return o, nil
+}
+
+// Route is the path a traceroute found.
+type Route struct {
+	Host    string `json:"host"`
+	Addr    string `json:"addr"`
+	Method  string `json:"method"`
+	Hops    []Hop  `json:"hops"`
+	Reached bool   `json:"reached"` // the destination answered
+}
+
+// Hop is what came back from the probes sent with one TTL.
+type Hop struct {
+	TTL    int          `json:"ttl"`
+	Probes []TraceProbe `json:"probes"`
+}
+
+// TraceProbe is the answer to one probe.
+type TraceProbe struct {
+	Addr string        `json:"addr,omitempty"` // who answered, empty if nobody did
+	Name string        `json:"name,omitempty"` // reverse DNS name of Addr
+	RTT  time.Duration `json:"rtt,omitempty"`
+	// Flag marks an ICMP destination unreachable the way traceroute(8)
+	// does: !N network, !H host, !P protocol, !X administratively
+	// prohibited, or ! and the code.
+	Flag string `json:"flag,omitempty"`
+}
+
+// String formats the hop like a line of traceroute(8) output, without the
+// TTL: each answering address, with its name, before its round-trip times,
+// and * for probes nobody answered.
+func (h Hop) String() string {
+	var b strings.Builder
+	last := ""
+	for _, p := range h.Probes {
+		if b.Len() > 0 {
+			b.WriteString("  ")
+		}
+		if p.Addr == "" {
+			b.WriteString("*")
+			continue
+		}
+		if p.Addr != last {
+			if p.Name != "" {
+				fmt.Fprintf(&b, "%s (%s)  ", p.Name, p.Addr)
+			} else {
+				b.WriteString(p.Addr + "  ")
+			}
+			last = p.Addr
+		}
+		fmt.Fprintf(&b, "%.3f ms", float64(p.RTT)/float64(time.Millisecond))
+		if p.Flag != "" {
+			b.WriteString(" " + p.Flag)
+		}
+	}
+	return b.String()
+}
+
+// Traceroute sends probes to host with increasing TTLs until the host
+// answers, a router reports it unreachable or opts.MaxHops is reached. fn,
+// if not nil, is called with every hop as soon as its probes are done.
+// Raw sockets are used when permitted; otherwise UDP and ICMP traces fall
+// back to unprivileged sockets where the platform allows.
+func (e *Engine) Traceroute(ctx context.Context, host string, opts TraceOptions, fn func(Hop)) (*Route, error) {
+	opts, err := opts.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip4", host)
+	if err != nil {
+		return nil, err
+	}
+	dst := ips[0].To4()
+	route := &Route{Host: host, Addr: dst.String(), Method: opts.Method}
+
+	t, err := newTracer(opts, dst)
+	if err != nil {
+		return route, err
+	}
+	defer t.close()
+
+	names := map[string]string{}
+	seq := 0
+	for ttl := 1; ttl <= opts.MaxHops; ttl++ {
+		hop := Hop{TTL: ttl}
+		unreachable := false
+		for i := 0; i < opts.Probes; i++ {
+			if err := e.send(ctx); err != nil {
+				return route, err
+			}
+			p, err := t.probe(ctx, ttl, seq, e.timeout(host))
+			seq++
+			if err != nil {
+				return route, err
+			}
+			if p.Addr != "" {
+				if _, ok := names[p.Addr]; !ok {
+					names[p.Addr] = reverseName(ctx, p.Addr)
+				}
+				p.Name = names[p.Addr]
+				route.Reached = route.Reached || p.Addr == route.Addr
+			}
+			unreachable = unreachable || p.Flag != ""
+			hop.Probes = append(hop.Probes, p)
+		}
+		route.Hops = append(route.Hops, hop)
+		if fn != nil {
+			fn(hop)
+		}
+		if route.Reached || unreachable {
+			break
+		}
+	}
+	return route, nil
+}
+
+// reverseName looks up the name of addr, giving up quickly so a slow
+// resolver does not hold up the trace.
+func reverseName(ctx context.Context, addr string) string {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	names, err := net.DefaultResolver.LookupAddr(ctx, addr)
+	if err != nil || len(names) == 0 {
+		return ""
+	}
+	return strings.TrimSuffix(names[0], ".")
+}
+
+// tracer sends the probes of one traceroute.
+type tracer interface {
+	// probe sends probe number seq with ttl and waits up to timeout for
+	// the answer. A probe nobody answered has an empty Addr.
+	probe(ctx context.Context, ttl, seq int, timeout time.Duration) (TraceProbe, error)
+	close()
+}
+
+func newTracer(opts TraceOptions, dst net.IP) (tracer, error) {
+	t, err := newRawTracer(opts, dst)
+	if err == nil {
+		return t, nil
+	}
+	if !permissionError(err) {
+		return nil, err
+	}
+	if opts.Method == TraceTCP {
+		return nil, fmt.Errorf("TCP traceroute: %w", errRawDenied)
+	}
+	return newDgramTracer(opts, dst)
+}
+
+// unreachableFlag returns the flag for an ICMP destination unreachable
+// with code from from, or "" when it is the destination's port unreachable,
+// which is how a UDP trace ends.
+func unreachableFlag(code int, from, dst net.IP) string {
+	if code == 3 && from.Equal(dst) {
+		return ""
+	}
+	switch code {
+	case 0:
+		return "!N"
+	case 1:
+		return "!H"
+	case 2:
+		return "!P"
+	case 9, 10, 13:
+		return "!X"
+	}
+	return "!" + strconv.Itoa(code)
+}
+
+// tracePayload is the body of UDP and ICMP probes.
+var tracePayload = make([]byte, 32)
+
+// rawTracer probes with raw sockets, reading every ICMP message the host
+// receives and matching the ones that quote a probe.
+type rawTracer struct {
+	opts  TraceOptions
+	dst   net.IP
+	id    int // ICMP echo identifier
+	sport uint16
+	src   net.IP
+
+	icmp    *icmp.PacketConn
+	udp     *ipv4.PacketConn
+	tcp     *ipv4.PacketConn
+	conns   []net.PacketConn
+	replies chan traceReply
+	done    chan struct{}
+}
+
+// traceReply is an answer to probe seq.
+type traceReply struct {
+	seq  int
+	from net.IP
+	at   time.Time
+	flag string
+}
+
+func newRawTracer(opts TraceOptions, dst net.IP) (*rawTracer, error) {
+	c, err := icmp.ListenPacket("ip4:icmp", "0.0.0.0")
+	if err != nil {
+		return nil, err
+	}
+	t := &rawTracer{
+		opts:    opts,
+		dst:     dst,
+		id:      os.Getpid() & 0xffff,
+		icmp:    c,
+		conns:   []net.PacketConn{c},
+		replies: make(chan traceReply, 16),
+		done:    make(chan struct{}),
+	}
+
+	switch opts.Method {
+	case TraceUDP:
+		conn, err := net.ListenPacket("udp4", ":0")
+		if err != nil {
+			t.close()
+			return nil, err
+		}
+		t.conns = append(t.conns, conn)
+		t.udp = ipv4.NewPacketConn(conn)
+		t.sport = uint16(conn.LocalAddr().(*net.UDPAddr).Port)
+	case TraceTCP:
+		conn, err := net.ListenPacket("ip4:tcp", "0.0.0.0")
+		if err != nil {
+			t.close()
+			return nil, err
+		}
+		t.conns = append(t.conns, conn)
+		t.tcp = ipv4.NewPacketConn(conn)
+		if t.src, err = sourceFor(dst); err != nil {
+			t.close()
+			return nil, err
+		}
+		t.sport = uint16(32768 + rand.Intn(28232))
+		go t.readTCP(conn)
+	}
+	go t.readICMP()
+	return t, nil
+}
+
+func (t *rawTracer) close() {
+	close(t.done)
+	for _, c := range t.conns {
+		c.Close()
+	}
+}
+
+func (t *rawTracer) deliver(r traceReply) {
+	select {
+	case t.replies <- r:
+	case <-t.done:
+	}
+}
+
+// readICMP passes on echo replies to the probes and the errors that quote
+// them, until the tracer is closed.
+func (t *rawTracer) readICMP() {
+	buf := make([]byte, 1500)
+	for {
+		n, peer, err := t.icmp.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		at := time.Now()
+		msg, err := icmp.ParseMessage(1, buf[:n])
+		if err != nil {
+			continue
+		}
+		from := peer.(*net.IPAddr).IP
+		switch body := msg.Body.(type) {
+		case *icmp.Echo:
+			if msg.Type == ipv4.ICMPTypeEchoReply && t.opts.Method == TraceICMP && body.ID == t.id && from.Equal(t.dst) {
+				t.deliver(traceReply{seq: body.Seq, from: from, at: at})
+			}
+		case *icmp.TimeExceeded:
+			if seq, ok := t.quoted(body.Data); ok {
+				t.deliver(traceReply{seq: seq, from: from, at: at})
+			}
+		case *icmp.DstUnreach:
+			if seq, ok := t.quoted(body.Data); ok {
+				t.deliver(traceReply{seq: seq, from: from, at: at, flag: unreachableFlag(msg.Code, from, t.dst)})
+			}
+		}
+	}
+}
+
+// quoted finds which probe the IP header and first eight bytes quoted in an
+// ICMP error belong to.
+func (t *rawTracer) quoted(data []byte) (int, bool) {
+	if len(data) < 20 {
+		return 0, false
+	}
+	ihl := int(data[0]&0x0f) * 4
+	if len(data) < ihl+8 || !net.IP(data[16:20]).Equal(t.dst) {
+		return 0, false
+	}
+	inner := data[ihl:]
+	switch {
+	case t.opts.Method == TraceUDP && data[9] == 17:
+		if binary.BigEndian.Uint16(inner[0:]) != t.sport {
+			return 0, false
+		}
+		return int(binary.BigEndian.Uint16(inner[2:])) - t.opts.Port, true
+	case t.opts.Method == TraceICMP && data[9] == 1:
+		if inner[0] != 8 || int(binary.BigEndian.Uint16(inner[4:])) != t.id {
+			return 0, false
+		}
+		return int(binary.BigEndian.Uint16(inner[6:])), true
+	case t.opts.Method == TraceTCP && data[9] == 6:
+		if binary.BigEndian.Uint16(inner[0:]) != t.sport {
+			return 0, false
+		}
+		return int(binary.BigEndian.Uint32(inner[4:])), true
+	}
+	return 0, false
+}
+
+// readTCP passes on the SYN-ACKs and resets the destination answers SYN
+// probes with. The kernel resets the half-open connections itself.
+func (t *rawTracer) readTCP(conn net.PacketConn) {
+	buf := make([]byte, 1500)
+	for {
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		at := time.Now()
+		h, err := parseTCP(buf[:n])
+		if err != nil || !peer.(*net.IPAddr).IP.Equal(t.dst) || h.sport != uint16(t.opts.Port) || h.dport != t.sport {
+			continue
+		}
+		if h.flags&tcpRST != 0 || h.flags&(tcpSYN|tcpACK) == tcpSYN|tcpACK {
+			t.deliver(traceReply{seq: int(h.ack - 1), from: t.dst, at: at})
+		}
+	}
+}
+
+func (t *rawTracer) probe(ctx context.Context, ttl, seq int, timeout time.Duration) (TraceProbe, error) {
+	sent := time.Now()
+	var err error
+	switch t.opts.Method {
+	case TraceUDP:
+		if err = t.udp.SetTTL(ttl); err == nil {
+			_, err = t.udp.WriteTo(tracePayload, nil, &net.UDPAddr{IP: t.dst, Port: t.opts.Port + seq})
+		}
+	case TraceICMP:
+		msg := icmp.Message{Type: ipv4.ICMPTypeEcho, Body: &icmp.Echo{ID: t.id, Seq: seq, Data: tracePayload}}
+		var b []byte
+		if b, err = msg.Marshal(nil); err == nil {
+			if err = t.icmp.IPv4PacketConn().SetTTL(ttl); err == nil {
+				_, err = t.icmp.WriteTo(b, &net.IPAddr{IP: t.dst})
+			}
+		}
+	case TraceTCP:
+		seg := tcpSegment(t.src, t.dst, t.sport, uint16(t.opts.Port), uint32(seq), 0, tcpSYN, nil)
+		if err = t.tcp.SetTTL(ttl); err == nil {
+			_, err = t.tcp.WriteTo(seg, nil, &net.IPAddr{IP: t.dst})
+		}
+	}
+	if err != nil {
+		return TraceProbe{}, err
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return TraceProbe{}, ctx.Err()
+		case <-timer.C:
+			return TraceProbe{}, nil
+		case r := <-t.replies:
+			if r.seq != seq {
+				continue // late answer to an earlier probe
+			}
+			return TraceProbe{Addr: r.from.String(), RTT: r.at.Sub(sent), Flag: r.flag}, nil
+		}
+	}
+}
@@ -0,0 +1,91 @@
+//go:build linux
+
+package scan
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/sys/unix"
+)
+
+// dgramTracer probes with ordinary datagram sockets, one per probe, and
+// reads the ICMP errors the kernel queues on them with IP_RECVERR, like
+// tracepath(8). ICMP probes use the unprivileged ping socket, which
+// net.ipv4.ping_group_range must allow.
+type dgramTracer struct {
+	opts TraceOptions
+	dst  net.IP
+}
+
+func newDgramTracer(opts TraceOptions, dst net.IP) (tracer, error) {
+	t := &dgramTracer{opts: opts, dst: dst}
+	fd, err := t.socket(1)
+	if err != nil {
+		return nil, err
+	}
+	unix.Close(fd)
+	return t, nil
+}
+
+func (t *dgramTracer) close() {}
+
+func (t *dgramTracer) socket(ttl int) (int, error) {
+	if t.opts.Method == TraceICMP {
+		return icmpSocket(unix.SOCK_DGRAM, unix.IPPROTO_ICMP, ttl)
+	}
+	return icmpSocket(unix.SOCK_DGRAM, unix.IPPROTO_UDP, ttl)
+}
+
+func (t *dgramTracer) probe(ctx context.Context, ttl, seq int, timeout time.Duration) (TraceProbe, error) {
+	fd, err := t.socket(ttl)
+	if err != nil {
+		return TraceProbe{}, err
+	}
+	defer unix.Close(fd)
+
+	to := &unix.SockaddrInet4{Port: t.opts.Port + seq}
+	copy(to.Addr[:], t.dst)
+	payload := tracePayload
+	if t.opts.Method == TraceICMP {
+		// The kernel fills in the identifier and checksum.
+		to.Port = 0
+		msg := icmp.Message{Type: ipv4.ICMPTypeEcho, Body: &icmp.Echo{Seq: seq, Data: tracePayload}}
+		if payload, err = msg.Marshal(nil); err != nil {
+			return TraceProbe{}, err
+		}
+	}
+	sent := time.Now()
+	if err := unix.Sendto(fd, payload, 0, to); err != nil {
+		return TraceProbe{}, err
+	}
+
+	deadline := sent.Add(timeout)
+	buf := make([]byte, 1500)
+	for {
+		events, err := waitSocket(ctx, fd, deadline)
+		if err != nil || events == 0 {
+			return TraceProbe{}, err
+		}
+		at := time.Now()
+
+		if events&unix.POLLERR != 0 {
+			e, ok := readSockError(fd)
+			if !ok || e.origin != unix.SO_EE_ORIGIN_ICMP || e.from == nil {
+				continue
+			}
+			p := TraceProbe{Addr: e.from.String(), RTT: at.Sub(sent)}
+			if e.typ == 3 {
+				p.Flag = unreachableFlag(int(e.code), e.from, t.dst)
+			}
+			return p, nil
+		}
+		// An echo reply, or the destination answering the UDP datagram.
+		if _, _, err := unix.Recvfrom(fd, buf, unix.MSG_DONTWAIT); err == nil {
+			return TraceProbe{Addr: t.dst.String(), RTT: at.Sub(sent)}, nil
+		}
+	}
+}
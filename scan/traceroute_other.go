@@ -0,0 +1,15 @@
+//go:build !linux
+
+package scan
+
+import (
+	"fmt"
+	"net"
+)
+
+// newDgramTracer would trace without raw sockets. Only Linux reports the
+// ICMP errors a datagram socket provokes, so elsewhere traceroute needs
+// privileges.
+func newDgramTracer(opts TraceOptions, dst net.IP) (tracer, error) {
+	return nil, fmt.Errorf("traceroute: %w", errRawDenied)
+}
@@ -0,0 +1,75 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"network-scanner/scan"
+)
+
+func TestCronNext(t *testing.T) {
+	from := time.Date(2024, 5, 1, 10, 7, 30, 0, time.UTC) // a Wednesday
+	tests := []struct {
+		spec string
+		want []string // the first firings after from, in order
+	}{
+		{"*/15 * * * *", []string{"2024-05-01 10:15", "2024-05-01 10:30", "2024-05-01 10:45", "2024-05-01 11:00"}},
+		{"0 9-17/4 * * *", []string{"2024-05-01 13:00", "2024-05-01 17:00", "2024-05-02 09:00"}},
+		{"5,35 */12 * * *", []string{"2024-05-01 12:05", "2024-05-01 12:35", "2024-05-02 00:05"}},
+		{"30 2 * jan,JUL mon-fri", []string{"2024-07-01 02:30", "2024-07-02 02:30", "2024-07-03 02:30"}},
+		// Both day fields restricted: the 13th or any Friday.
+		{"0 0 13 * fri", []string{"2024-05-03 00:00", "2024-05-10 00:00", "2024-05-13 00:00", "2024-05-17 00:00"}},
+		{"0 0 1-7 * *", []string{"2024-05-02 00:00", "2024-05-03 00:00"}},
+		{"0 12 * * 7", []string{"2024-05-05 12:00", "2024-05-12 12:00"}},
+		{"0 12 * * 5-7", []string{"2024-05-03 12:00", "2024-05-04 12:00", "2024-05-05 12:00", "2024-05-10 12:00"}},
+		{"0 0 29 2 *", []string{"2028-02-29 00:00", "2032-02-29 00:00"}},
+		{"@weekly", []string{"2024-05-05 00:00", "2024-05-12 00:00"}},
+		{"@hourly", []string{"2024-05-01 11:00", "2024-05-01 12:00"}},
+		{"@every 90m", []string{"2024-05-01 11:37", "2024-05-01 13:07"}},
+	}
+	for _, tt := range tests {
+		c, err := ParseCron(tt.spec)
+		if err != nil {
+			t.Errorf("ParseCron(%q): %v", tt.spec, err)
+			continue
+		}
+		at := from
+		for i, want := range tt.want {
+			at = c.Next(at)
+			if got := at.Format("2006-01-02 15:04"); got != want {
+				t.Errorf("%q: firing %d = %s, want %s", tt.spec, i+1, got, want)
+				break
+			}
+		}
+	}
+}
+
+func TestParseCronRejects(t *testing.T) {
+	for _, spec := range []string{
+		"", "* * * *", "* * * * * *", "60 * * * *", "* 24 * * *", "0 0 0 * *", "0 0 * 13 *", "0 0 * * 8",
+		"5-1 * * * *", "*/0 * * * *", "*/x * * * *", "0 0 * foo *", "@every 30s", "@every soon", "@often",
+	} {
+		if _, err := ParseCron(spec); err == nil {
+			t.Errorf("ParseCron(%q) succeeded", spec)
+		}
+	}
+}
+
+func TestNeverFires(t *testing.T) {
+	// 31 February parses but never comes, so a job cannot use it.
+	c, err := ParseCron("0 0 31 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next := c.Next(time.Now()); !next.IsZero() {
+		t.Errorf("Next = %v, want never", next)
+	}
+	j := Job{Name: "never", Spec: scan.Spec{Command: "portscan", Target: "10.0.0.1", Ports: "22"}, Schedule: "0 0 31 2 *"}
+	if err := j.Validate(); err == nil {
+		t.Errorf("Validate accepted a schedule that never fires")
+	}
+	j.Schedule = "0 0 30 1,3 *"
+	if err := j.Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+}
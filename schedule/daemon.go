@@ -0,0 +1,253 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"network-scanner/history"
+	"network-scanner/scan"
+)
+
+// reloadInterval is how often the daemon looks for edits to the jobs file.
+const reloadInterval = 30 * time.Second
+
+// Daemon runs the jobs in a jobs file on their schedules. Every result is
+// stored in the history database and compared with the previous run of the
+// same scan.
+type Daemon struct {
+	JobsPath string
+	DBPath   string
+	Log      *log.Logger
+
+	// OnResult, if set, is called after each run has been saved. prev is
+	// the previous completed run of the same scan, or nil if there is none
+	// or this run was interrupted.
+	OnResult func(job Job, report *scan.Report, prev *scan.Report)
+
+	mu      sync.Mutex
+	jobs    []Job
+	next    map[string]time.Time
+	running map[string]bool
+	modTime time.Time
+	wg      sync.WaitGroup
+}
+
+// Run schedules jobs until ctx is cancelled, then waits for the scans in
+// progress to stop. The jobs file is reloaded whenever it changes; if an
+// edit breaks it, the jobs loaded before keep running.
+func (d *Daemon) Run(ctx context.Context) error {
+	if d.Log == nil {
+		d.Log = log.New(os.Stderr, "", log.LstdFlags)
+	}
+	d.next = map[string]time.Time{}
+	d.running = map[string]bool{}
+	if err := d.reload(true); err != nil {
+		return err
+	}
+	defer d.wg.Wait()
+
+	lastReload := time.Now()
+	for {
+		now := time.Now()
+		if now.Sub(lastReload) >= reloadInterval {
+			if err := d.reload(false); err != nil {
+				d.Log.Printf("keeping the previous jobs: %v", err)
+			}
+			lastReload = now
+		}
+
+		wake := lastReload.Add(reloadInterval)
+		for _, job := range d.jobs {
+			at := d.next[job.Name]
+			if at.IsZero() {
+				continue // never fires
+			}
+			if !at.After(now) {
+				d.start(ctx, job)
+				at = nextRun(job, now)
+				d.next[job.Name] = at
+			}
+			if !at.IsZero() && at.Before(wake) {
+				wake = at
+			}
+		}
+
+		t := time.NewTimer(time.Until(wake))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			d.Log.Printf("stopping; waiting for running scans")
+			return nil
+		case <-t.C:
+		}
+	}
+}
+
+// reload reads the jobs file again if it changed since the last read.
+func (d *Daemon) reload(first bool) error {
+	var modTime time.Time
+	info, err := os.Stat(d.JobsPath)
+	switch {
+	case os.IsNotExist(err):
+		if first {
+			d.Log.Printf("no jobs file at %s yet; waiting for one", d.JobsPath)
+		}
+	case err != nil:
+		return err
+	default:
+		modTime = info.ModTime()
+	}
+	if !first && modTime.Equal(d.modTime) {
+		return nil
+	}
+
+	jobs, err := LoadJobs(d.JobsPath)
+	if err != nil {
+		return err
+	}
+	d.modTime = modTime
+
+	now := time.Now()
+	next := map[string]time.Time{}
+	var active []Job
+	for _, job := range jobs {
+		if job.Disabled {
+			continue
+		}
+		active = append(active, job)
+		if old, ok := d.next[job.Name]; ok && d.unchanged(job) {
+			next[job.Name] = old
+		} else {
+			next[job.Name] = nextRun(job, now)
+		}
+	}
+	d.jobs, d.next = active, next
+	d.Log.Printf("loaded %d active jobs from %s", len(active), d.JobsPath)
+	for _, job := range active {
+		d.Log.Printf("  %s: %s %s, next run %s", job.Name, job.Command, job.Target, d.next[job.Name].Format(time.RFC3339))
+	}
+	return nil
+}
+
+// unchanged reports whether job is scheduled exactly as before.
+func (d *Daemon) unchanged(job Job) bool {
+	for _, old := range d.jobs {
+		if old.Name == job.Name {
+			return old.Schedule == job.Schedule
+		}
+	}
+	return false
+}
+
+// nextRun works out when job runs next after now.
+func nextRun(job Job, now time.Time) time.Time {
+	c, err := ParseCron(job.Schedule)
+	if err != nil {
+		return time.Time{}
+	}
+	return c.Next(now)
+}
+
+// start runs job in the background unless its previous run is still going.
+func (d *Daemon) start(ctx context.Context, job Job) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.running[job.Name] {
+		d.Log.Printf("%s: previous run still in progress; skipping this one", job.Name)
+		return
+	}
+	d.running[job.Name] = true
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		d.run(ctx, job)
+		d.mu.Lock()
+		delete(d.running, job.Name)
+		d.mu.Unlock()
+	}()
+}
+
+// run performs one scan for job, saves it and logs the changes.
+func (d *Daemon) run(ctx context.Context, job Job) {
+	engine, err := job.Engine()
+	if err != nil {
+		d.Log.Printf("%s: %v", job.Name, err)
+		return
+	}
+	d.Log.Printf("%s: starting %s %s", job.Name, job.Command, job.Target)
+	report, err := engine.Run(ctx, job.Spec, nil)
+	if report == nil {
+		d.Log.Printf("%s: %v", job.Name, err)
+		return
+	}
+	report.Params = append(report.Params, scan.Param{Name: "job", Value: job.Name})
+	if report.Interrupted {
+		d.Log.Printf("%s: interrupted after %d probes", job.Name, report.Scanned)
+	} else {
+		d.Log.Printf("%s: done in %s, %d hosts, %d open ports", job.Name,
+			report.Finished.Sub(report.Started).Round(time.Millisecond), len(report.Hosts), report.OpenPorts())
+	}
+
+	prev, err := d.save(report)
+	if err != nil {
+		d.Log.Printf("%s: saving to history: %v", job.Name, err)
+	}
+	if prev != nil {
+		logChanges(d.Log, job.Name, scan.Compare(prev, report))
+	}
+	if d.OnResult != nil {
+		d.OnResult(job, report, prev)
+	}
+}
+
+// save stores report and returns the previous completed run of the same
+// scan to compare it with. The database is only held open for as long as
+// that takes, so the CLI and GUI can use it between runs.
+func (d *Daemon) save(report *scan.Report) (*scan.Report, error) {
+	store, err := history.Open(d.DBPath)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	if _, err := store.Save(report); err != nil {
+		return nil, err
+	}
+	prev, err := store.Previous(report)
+	if errors.Is(err, history.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if prev.Interrupted || report.Interrupted {
+		return nil, nil
+	}
+	return prev, nil
+}
+
+func logChanges(l *log.Logger, name string, d *scan.Diff) {
+	if d.Empty() {
+		l.Printf("%s: no changes since scan #%d", name, d.Old.ID)
+		return
+	}
+	l.Printf("%s: changes since scan #%d:", name, d.Old.ID)
+	for _, h := range d.NewHosts {
+		l.Printf("%s:   + host %s", name, h)
+	}
+	for _, h := range d.GoneHosts {
+		l.Printf("%s:   - host %s", name, h)
+	}
+	for _, c := range d.Opened {
+		l.Printf("%s:   + port %s", name, c)
+	}
+	for _, c := range d.Closed {
+		l.Printf("%s:   - port %s", name, c)
+	}
+	for _, c := range d.Changed {
+		l.Printf("%s:   ~ %s", name, c)
+	}
+}
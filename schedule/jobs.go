@@ -0,0 +1,136 @@
+package schedule
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"network-scanner/scan"
+)
+
+// Job is a scan that runs on a schedule.
+//
+//	jobs:
+//	  - name: office-lan
+//	    command: netscan
+//	    target: 192.168.1.0/24
+//	    ports: 22,80,443
+//	    schedule: "*/30 * * * *"
+//	    timing: polite
+type Job struct {
+	Name      string `yaml:"name"`
+	scan.Spec `yaml:",inline"`
+	Schedule  string `yaml:"schedule"`
+	Timing    string `yaml:"timing,omitempty"` // profile name, normal if empty
+	Services  bool   `yaml:"services,omitempty"`
+	Disabled  bool   `yaml:"disabled,omitempty"`
+}
+
+// jobsFile is the layout of the jobs file.
+type jobsFile struct {
+	Jobs []Job `yaml:"jobs"`
+}
+
+// DefaultPath is where the serve command and the GUI keep the jobs file
+// unless told otherwise: jobs.yaml under the user's configuration directory.
+func DefaultPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = "."
+	}
+	return filepath.Join(dir, "network-scanner", "jobs.yaml")
+}
+
+// Validate checks that j can be scheduled and run.
+func (j *Job) Validate() error {
+	if j.Name == "" {
+		return fmt.Errorf("job has no name")
+	}
+	if err := j.Spec.Validate(); err != nil {
+		return fmt.Errorf("job %s: %w", j.Name, err)
+	}
+	c, err := ParseCron(j.Schedule)
+	if err != nil {
+		return fmt.Errorf("job %s: %w", j.Name, err)
+	}
+	if c.Next(time.Now()).IsZero() {
+		return fmt.Errorf("job %s: schedule %q never fires", j.Name, j.Schedule)
+	}
+	if _, err := j.timing(); err != nil {
+		return fmt.Errorf("job %s: %w", j.Name, err)
+	}
+	return nil
+}
+
+func (j *Job) timing() (scan.Timing, error) {
+	if j.Timing == "" {
+		return scan.DefaultTiming, nil
+	}
+	return scan.ProfileByName(j.Timing)
+}
+
+// Engine returns a fresh engine configured for one run of j.
+func (j *Job) Engine() (*scan.Engine, error) {
+	timing, err := j.timing()
+	if err != nil {
+		return nil, err
+	}
+	engine := scan.NewEngine(timing)
+	engine.Services = j.Services
+	return engine, nil
+}
+
+// LoadJobs reads and checks the jobs file at path. A missing file holds no
+// jobs.
+func LoadJobs(path string) ([]Job, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var f jobsFile
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&f); err != nil && len(bytes.TrimSpace(data)) > 0 {
+		return nil, fmt.Errorf("jobs %s: %w", path, err)
+	}
+
+	names := map[string]bool{}
+	for i := range f.Jobs {
+		if err := f.Jobs[i].Validate(); err != nil {
+			return nil, fmt.Errorf("jobs %s: %w", path, err)
+		}
+		if names[f.Jobs[i].Name] {
+			return nil, fmt.Errorf("jobs %s: duplicate job name %q", path, f.Jobs[i].Name)
+		}
+		names[f.Jobs[i].Name] = true
+	}
+	return f.Jobs, nil
+}
+
+// SaveJobs writes jobs to path, replacing the file atomically so a running
+// serve command never reads half of it.
+func SaveJobs(path string, jobs []Job) error {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(jobsFile{Jobs: jobs}); err != nil {
+		return err
+	}
+	data := buf.Bytes()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}